@@ -0,0 +1,299 @@
+package pie
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+// validateCalls returns an error if the statement contains an unknown
+// function, a function with the wrong arguments or a misplaced wildcard.
+func validateCalls(stmt *pieql.SelectStatement) error {
+	v := &callValidator{}
+	pieql.Walk(v, stmt)
+	return v.err
+}
+
+// callValidator is a visitor that validates calls and wildcards.
+type callValidator struct {
+	err error
+}
+
+// Visit validates a node. Call arguments are validated by validateCall.
+func (v *callValidator) Visit(n pieql.Node) pieql.Visitor {
+	if v.err != nil {
+		return nil
+	}
+
+	switch n := n.(type) {
+	case *pieql.Call:
+		v.err = validateCall(n)
+		return nil
+	case *pieql.Wildcard:
+		v.err = errors.New("wildcard can only be used as a field or in count()")
+	}
+	return v
+}
+
+// validateCall returns an error if the call is not a valid aggregate call.
+func validateCall(call *pieql.Call) error {
+	switch call.Name {
+	case "count", "sum", "avg", "min", "max":
+	default:
+		return fmt.Errorf("undefined function: %s()", call.Name)
+	}
+
+	// Every aggregate requires exactly one argument.
+	if len(call.Args) != 1 {
+		return fmt.Errorf("invalid number of arguments for %s, expected 1, got %d", call.Name, len(call.Args))
+	}
+	arg := call.Args[0]
+
+	// Only count() accepts a wildcard, and only without DISTINCT.
+	if _, ok := arg.(*pieql.Wildcard); ok {
+		if call.Name != "count" || call.Distinct {
+			return fmt.Errorf("invalid argument to %s: *", call.Name)
+		}
+		return nil
+	}
+
+	// Aggregates cannot be nested.
+	if pieql.HasCall(arg) {
+		return fmt.Errorf("aggregate functions cannot be nested: %s", call)
+	}
+
+	// Wildcards cannot appear within an argument expression.
+	return validateWildcards(arg)
+}
+
+// validateWildcards returns an error if expr contains a wildcard.
+func validateWildcards(expr pieql.Expr) (err error) {
+	pieql.WalkFunc(expr, func(n pieql.Node) {
+		if _, ok := n.(*pieql.Wildcard); ok && err == nil {
+			err = errors.New("wildcard can only be used as a field or in count()")
+		}
+	})
+	return
+}
+
+// findUngroupedRef returns the first column reference in expr that is
+// neither inside an aggregate call nor part of the GROUP BY clause.
+func findUngroupedRef(expr pieql.Expr, groupBy []pieql.Expr) *pieql.VarRef {
+	// Expressions matching a grouping expression are always valid.
+	for _, e := range groupBy {
+		if e.String() == expr.String() {
+			return nil
+		}
+	}
+
+	switch expr := expr.(type) {
+	case *pieql.VarRef:
+		return expr
+	case *pieql.BinaryExpr:
+		if ref := findUngroupedRef(expr.LHS, groupBy); ref != nil {
+			return ref
+		}
+		return findUngroupedRef(expr.RHS, groupBy)
+	case *pieql.UnaryExpr:
+		return findUngroupedRef(expr.Expr, groupBy)
+	case *pieql.ParenExpr:
+		return findUngroupedRef(expr.Expr, groupBy)
+	}
+	return nil
+}
+
+// aggregate combines records into groups based on the statement's GROUP BY
+// clause and computes the aggregate calls for each group. Groups are returned
+// in the order they first appear and are filtered by the HAVING condition.
+func aggregate(stmt *pieql.SelectStatement, records []pieql.Valuer) []pieql.Valuer {
+	// Group records by the value of the grouping expressions.
+	var groups [][]pieql.Valuer
+	indexes := make(map[string]int)
+	for _, v := range records {
+		key := groupKey(stmt.GroupBy, v)
+
+		// Create the group if it doesn't exist yet.
+		index, ok := indexes[key]
+		if !ok {
+			index = len(groups)
+			indexes[key] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], v)
+	}
+
+	// Aggregating without grouping always returns a single row.
+	if len(stmt.GroupBy) == 0 && len(groups) == 0 {
+		groups = append(groups, nil)
+	}
+
+	// Compute the aggregates for each group.
+	calls := aggregateCalls(stmt)
+	var a []pieql.Valuer
+	for _, group := range groups {
+		v := &groupValuer{values: make(map[string]interface{})}
+		if len(group) > 0 {
+			v.first = group[0]
+		}
+		for _, call := range calls {
+			v.values[call.String()] = evalCall(call, group)
+		}
+
+		// Remove groups that don't match the HAVING condition.
+		if pieql.EvalBool(stmt.Having, v) {
+			a = append(a, v)
+		}
+	}
+	return a
+}
+
+// aggregateCalls returns all the calls used by the statement's fields and
+// HAVING condition.
+func aggregateCalls(stmt *pieql.SelectStatement) []*pieql.Call {
+	var calls []*pieql.Call
+	for _, node := range []pieql.Node{stmt.Fields, stmt.Having} {
+		pieql.WalkFunc(node, func(n pieql.Node) {
+			if call, ok := n.(*pieql.Call); ok {
+				calls = append(calls, call)
+			}
+		})
+	}
+	return calls
+}
+
+// groupKey returns a key identifying the group a record belongs to.
+func groupKey(exprs []pieql.Expr, v pieql.Valuer) string {
+	values := make([]string, len(exprs))
+	for i, expr := range exprs {
+		values[i] = formatValue(pieql.Eval(expr, v))
+	}
+	return strings.Join(values, "\x00")
+}
+
+// evalCall computes an aggregate call over a group of records.
+// Empty values are ignored by every aggregate except count(*).
+func evalCall(call *pieql.Call, records []pieql.Valuer) interface{} {
+	_, wildcard := call.Args[0].(*pieql.Wildcard)
+
+	// Evaluate the argument against each record.
+	var values []interface{}
+	seen := make(map[string]bool)
+	for _, v := range records {
+		if wildcard {
+			values = append(values, nil)
+			continue
+		}
+
+		value := pieql.Eval(call.Args[0], v)
+		if value == nil || value == "" {
+			continue
+		}
+
+		// Skip values that have already been seen, if distinct.
+		if call.Distinct {
+			key := formatValue(value)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		values = append(values, value)
+	}
+
+	switch call.Name {
+	case "count":
+		return float64(len(values))
+	case "sum":
+		if len(values) == 0 {
+			return nil
+		}
+		var sum float64
+		for _, value := range values {
+			f, _ := toNumber(value)
+			sum += f
+		}
+		return sum
+	case "avg":
+		if len(values) == 0 {
+			return nil
+		}
+		var sum float64
+		for _, value := range values {
+			f, _ := toNumber(value)
+			sum += f
+		}
+		return sum / float64(len(values))
+	case "min":
+		return extremeValue(values, -1)
+	case "max":
+		return extremeValue(values, 1)
+	}
+	return nil
+}
+
+// extremeValue returns the smallest value if dir is -1 or the largest if dir is 1.
+// Values are compared numerically if they are all numbers, otherwise by type.
+func extremeValue(values []interface{}, dir int) interface{} {
+	numeric := true
+	for _, value := range values {
+		if _, ok := toNumber(value); !ok {
+			numeric = false
+			break
+		}
+	}
+
+	var result interface{}
+	for _, value := range values {
+		if result == nil {
+			result = value
+			continue
+		}
+
+		// Compare the value to the current result.
+		var cmp int
+		if numeric {
+			x, _ := toNumber(value)
+			y, _ := toNumber(result)
+			if x < y {
+				cmp = -1
+			} else if x > y {
+				cmp = 1
+			}
+		} else {
+			cmp = compareValues(value, result)
+		}
+
+		if cmp == dir {
+			result = value
+		}
+	}
+	return result
+}
+
+// groupValuer resolves values for a group of records.
+// Aggregates are looked up by their string representation. Columns are
+// resolved against the first record in the group.
+type groupValuer struct {
+	first  pieql.Valuer
+	values map[string]interface{}
+}
+
+// Value returns the aggregate or column value for name.
+func (v *groupValuer) Value(name string) (interface{}, bool) {
+	if value, ok := v.values[name]; ok {
+		return value, true
+	} else if v.first != nil {
+		return v.first.Value(name)
+	}
+	return nil, false
+}
+
+// cell returns the stored cell of a column in the group's first record.
+func (v *groupValuer) cell(key string) (string, bool) {
+	if cv, ok := v.first.(cellValuer); ok {
+		return cv.cell(key)
+	}
+	return "", false
+}
@@ -0,0 +1,411 @@
+package pie
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+const (
+	// DefaultPageSize is the default number of rows returned per page by the API.
+	DefaultPageSize = 100
+
+	// MaxPageSize is the maximum number of rows returned per page by the API.
+	MaxPageSize = 1000
+)
+
+// Machine-readable codes returned in API error responses.
+const (
+	ErrCodeNotFound           = "not_found"
+	ErrCodeMethodNotAllowed   = "method_not_allowed"
+	ErrCodeInvalidParameter   = "invalid_parameter"
+	ErrCodeParseError         = "parse_error"
+	ErrCodeQueryFailed        = "query_failed"
+	ErrCodeQueryTimeout       = "query_timeout"
+	ErrCodeTableNotFound      = "table_not_found"
+	ErrCodeTableExists        = "table_exists"
+	ErrCodeTableNameRequired  = "table_name_required"
+	ErrCodeColumnNotFound     = "column_not_found"
+	ErrCodeInvalidTableName   = "invalid_table_name"
+	ErrCodeIndexExists        = "index_exists"
+	ErrCodeIndexNameRequired  = "index_name_required"
+	ErrCodeInvalidIndexName   = "invalid_index_name"
+	ErrCodeInvalidSchema      = "invalid_schema"
+	ErrCodeInvalidValue       = "invalid_value"
+	ErrCodeConstraintViolated = "constraint_violated"
+	ErrCodeNotOpen            = "database_not_open"
+	ErrCodeInternal           = "internal_error"
+)
+
+// registerAPI adds the JSON API routes to the handler's router.
+func (h *Handler) registerAPI() {
+	api := h.mux.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/tables", h.serveAPITables).Methods("GET")
+	api.HandleFunc("/tables/{name}", h.serveAPITable).Methods("GET")
+	api.HandleFunc("/tables/{name}", h.serveAPIDeleteTable).Methods("DELETE")
+	api.HandleFunc("/tables/{name}", h.serveAPIRenameTable).Methods("PATCH")
+	api.HandleFunc("/tables/{name}/rows", h.serveAPITableRows).Methods("GET")
+	api.HandleFunc("/query", h.serveAPIQuery).Methods("POST")
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, &apiError{Code: ErrCodeNotFound, Message: "not found"})
+	})
+	api.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, &apiError{Code: ErrCodeMethodNotAllowed, Message: "method not allowed"})
+	})
+}
+
+// serveAPITables returns the schema of every table.
+func (h *Handler) serveAPITables(w http.ResponseWriter, r *http.Request) {
+	tx, err := h.db.Begin(false)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	resp := &apiTablesResponse{Tables: []*apiTable{}}
+	for _, t := range tx.Tables() {
+		resp.Tables = append(resp.Tables, newAPITable(t))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveAPITable returns the schema of a table.
+func (h *Handler) serveAPITable(w http.ResponseWriter, r *http.Request) {
+	tx, err := h.db.Begin(false)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	t := tx.Table(mux.Vars(r)["name"])
+	if t == nil {
+		writeAPIError(w, ErrTableNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPITable(t))
+}
+
+// serveAPIDeleteTable deletes a table.
+func (h *Handler) serveAPIDeleteTable(w http.ResponseWriter, r *http.Request) {
+	if err := h.db.DeleteTable(mux.Vars(r)["name"]); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveAPIRenameTable renames a table to the name in the JSON request body
+// and returns the table's schema.
+func (h *Handler) serveAPIRenameTable(w http.ResponseWriter, r *http.Request) {
+	var req apiRenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, &apiError{Code: ErrCodeInvalidParameter, Message: fmt.Sprintf("invalid request body: %s", err)})
+		return
+	}
+
+	tx, err := h.db.Begin(true)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := tx.RenameTable(mux.Vars(r)["name"], req.Name); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	t := tx.Table(req.Name)
+	if err := tx.Commit(); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPITable(t))
+}
+
+// serveAPITableRows returns a page of a table's rows. The page is selected
+// by the "offset" & "limit" query parameters.
+func (h *Handler) serveAPITableRows(w http.ResponseWriter, r *http.Request) {
+	offset, err := intParam(r, "offset", 0, 0)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	limit, err := intParam(r, "limit", DefaultPageSize, 1)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	// Read the table & its rows from the same snapshot.
+	tx, err := h.db.Begin(false)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	name := mux.Vars(r)["name"]
+	t := tx.Table(name)
+	if t == nil {
+		writeAPIError(w, ErrTableNotFound)
+		return
+	}
+
+	itr, err := tx.TableRowIterator(name)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer itr.Close()
+
+	// Skip rows before the offset and read one row past the limit to
+	// determine if there's another page.
+	resp := &apiRowsResponse{Rows: [][]string{}, Offset: offset, Limit: limit}
+	for _, c := range t.Columns {
+		resp.Columns = append(resp.Columns, c.Name)
+	}
+	for i := 0; ; i++ {
+		row, err := itr.Next()
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		} else if row == nil {
+			break
+		} else if i < offset {
+			continue
+		} else if len(resp.Rows) == limit {
+			next := offset + limit
+			resp.NextOffset = &next
+			break
+		}
+		resp.Rows = append(resp.Rows, row)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveAPIQuery executes one or more statements and returns the result of
+// each statement. Errors without a more specific code are reported as a
+// failed query.
+func (h *Handler) serveAPIQuery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeAPIError(w, &apiError{Code: ErrCodeInvalidParameter, Message: err.Error()})
+		return
+	}
+	defer cancel()
+
+	stmts, err := pieql.NewParser(r.Body).ParseStatementsContext(ctx)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	results, err := h.executeStatements(ctx, stmts)
+	if err != nil {
+		e := newAPIError(err)
+		if e.Code == ErrCodeInternal {
+			e.Code = ErrCodeQueryFailed
+		}
+		writeAPIError(w, e)
+		return
+	}
+
+	resp := &apiQueryResponse{Results: []*apiResult{}}
+	for _, res := range results {
+		ar := &apiResult{Columns: res.Columns, Rows: res.Rows, RowsAffected: res.RowsAffected}
+		if ar.Columns == nil {
+			ar.Columns = []string{}
+		}
+		if ar.Rows == nil {
+			ar.Rows = [][]string{}
+		}
+		resp.Results = append(resp.Results, ar)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// intParam returns the value of an integer query parameter. Returns def if
+// the parameter isn't set or an *apiError if it's less than min.
+func intParam(r *http.Request, name string, def, min int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min {
+		return 0, &apiError{Code: ErrCodeInvalidParameter, Message: fmt.Sprintf("invalid %s: %q", name, s)}
+	}
+	return n, nil
+}
+
+// apiTable represents the JSON encoding of a table's schema.
+type apiTable struct {
+	Name       string             `json:"name"`
+	Columns    []*Column          `json:"columns"`
+	PrimaryKey []string           `json:"primary_key,omitempty"`
+	Indexes    []*IndexDefinition `json:"indexes,omitempty"`
+}
+
+// newAPITable returns the JSON encoding of a table's schema.
+func newAPITable(t *Table) *apiTable {
+	at := &apiTable{Name: t.Name, Columns: t.Columns, PrimaryKey: t.PrimaryKey, Indexes: t.Indexes}
+	if at.Columns == nil {
+		at.Columns = []*Column{}
+	}
+	return at
+}
+
+// apiRenameRequest represents the JSON body of a request to rename a table.
+type apiRenameRequest struct {
+	Name string `json:"name"`
+}
+
+// apiTablesResponse represents the JSON encoding of the list of tables.
+type apiTablesResponse struct {
+	Tables []*apiTable `json:"tables"`
+}
+
+// apiRowsResponse represents the JSON encoding of a page of a table's rows.
+// The next offset is omitted on the last page.
+type apiRowsResponse struct {
+	Columns    []string   `json:"columns"`
+	Rows       [][]string `json:"rows"`
+	Offset     int        `json:"offset"`
+	Limit      int        `json:"limit"`
+	NextOffset *int       `json:"next_offset,omitempty"`
+}
+
+// apiQueryResponse represents the JSON encoding of the results of a query.
+type apiQueryResponse struct {
+	Results []*apiResult `json:"results"`
+}
+
+// apiResult represents the JSON encoding of a statement's result.
+type apiResult struct {
+	Columns      []string   `json:"columns"`
+	Rows         [][]string `json:"rows"`
+	RowsAffected int        `json:"rows_affected"`
+}
+
+// apiError represents an error returned by the API. Every error response is
+// an object with the error under the "error" key.
+type apiError struct {
+	Code     string       `json:"code"`
+	Message  string       `json:"message"`
+	Position *apiPosition `json:"position,omitempty"`
+}
+
+// Error returns the error message.
+func (e *apiError) Error() string { return e.Message }
+
+// apiPosition represents the position of a parse error within a query.
+type apiPosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// apiErrorResponse represents the JSON encoding of an error response.
+type apiErrorResponse struct {
+	Error *apiError `json:"error"`
+}
+
+// newAPIError returns the API error for err. Wrapped errors are matched so
+// that a row's constraint violation or invalid value gets its own code.
+func newAPIError(err error) *apiError {
+	var (
+		apiErr        *apiError
+		parseErr      *pieql.ParseError
+		schemaErr     *SchemaError
+		importErr     *ImportError
+		constraintErr *ConstraintError
+		rowErr        *RowError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &parseErr):
+		return &apiError{Code: ErrCodeParseError, Message: err.Error(), Position: &apiPosition{
+			Offset: parseErr.Pos.Offset,
+			Line:   parseErr.Pos.Line,
+			Column: parseErr.Pos.Column,
+		}}
+	case errors.As(err, &schemaErr):
+		return &apiError{Code: ErrCodeInvalidSchema, Message: err.Error()}
+	case errors.As(err, &importErr):
+		return &apiError{Code: ErrCodeInvalidValue, Message: err.Error()}
+	case errors.As(err, &constraintErr):
+		return &apiError{Code: ErrCodeConstraintViolated, Message: err.Error()}
+	case errors.As(err, &rowErr):
+		// Other errors with a row are values that don't match the table.
+		return &apiError{Code: ErrCodeInvalidValue, Message: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &apiError{Code: ErrCodeQueryTimeout, Message: errQueryTimeout.Error()}
+	}
+
+	code := ErrCodeInternal
+	switch {
+	case errors.Is(err, ErrTableNotFound):
+		code = ErrCodeTableNotFound
+	case errors.Is(err, ErrTableExists):
+		code = ErrCodeTableExists
+	case errors.Is(err, ErrTableNameRequired):
+		code = ErrCodeTableNameRequired
+	case errors.Is(err, ErrInvalidTableName):
+		code = ErrCodeInvalidTableName
+	case errors.Is(err, ErrColumnNotFound):
+		code = ErrCodeColumnNotFound
+	case errors.Is(err, ErrIndexExists):
+		code = ErrCodeIndexExists
+	case errors.Is(err, ErrIndexNameRequired):
+		code = ErrCodeIndexNameRequired
+	case errors.Is(err, ErrInvalidIndexName):
+		code = ErrCodeInvalidIndexName
+	case errors.Is(err, ErrNotOpen):
+		code = ErrCodeNotOpen
+	}
+	return &apiError{Code: code, Message: err.Error()}
+}
+
+// status returns the HTTP status code for the error.
+func (e *apiError) status() int {
+	switch e.Code {
+	case ErrCodeNotFound, ErrCodeTableNotFound:
+		return http.StatusNotFound
+	case ErrCodeTableExists, ErrCodeIndexExists:
+		return http.StatusConflict
+	case ErrCodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case ErrCodeNotOpen, ErrCodeQueryTimeout:
+		return http.StatusServiceUnavailable
+	case ErrCodeInternal:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// writeAPIError writes err to the response in the JSON error envelope.
+func writeAPIError(w http.ResponseWriter, err error) {
+	e := newAPIError(err)
+	writeJSON(w, e.status(), &apiErrorResponse{Error: e})
+}
+
+// writeJSON writes v to the response as JSON with a status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		warn("write json:", err)
+	}
+}
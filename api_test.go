@@ -0,0 +1,128 @@
+package pie_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure the API returns tables, schemas, rows & query results as JSON.
+func TestHandler_API(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "id", Type: pie.IntegerType, Unique: true}, {Name: "name"}}, "id")
+	db.CreateTable("bar", nil)
+	db.SetTableRows("foo", [][]string{{"1", "a"}, {"2", "b"}, {"3", "c"}})
+
+	for i, tt := range []struct {
+		method string
+		url    string
+		body   string
+		code   int
+		exp    string
+	}{
+		{method: "GET", url: "/api/v1/tables", code: http.StatusOK, exp: `{"tables":[{"name":"bar","columns":[]},{"name":"foo","columns":[{"name":"id","type":"integer","unique":true},{"name":"name"}],"primary_key":["id"]}]}`},
+		{method: "GET", url: "/api/v1/tables/foo", code: http.StatusOK, exp: `{"name":"foo","columns":[{"name":"id","type":"integer","unique":true},{"name":"name"}],"primary_key":["id"]}`},
+		{method: "GET", url: "/api/v1/tables/foo/rows", code: http.StatusOK, exp: `{"columns":["id","name"],"rows":[["1","a"],["2","b"],["3","c"]],"offset":0,"limit":100}`},
+		{method: "GET", url: "/api/v1/tables/foo/rows?limit=2", code: http.StatusOK, exp: `{"columns":["id","name"],"rows":[["1","a"],["2","b"]],"offset":0,"limit":2,"next_offset":2}`},
+		{method: "GET", url: "/api/v1/tables/foo/rows?offset=2&limit=2", code: http.StatusOK, exp: `{"columns":["id","name"],"rows":[["3","c"]],"offset":2,"limit":2}`},
+		{method: "GET", url: "/api/v1/tables/foo/rows?offset=5", code: http.StatusOK, exp: `{"columns":["id","name"],"rows":[],"offset":5,"limit":100}`},
+		{method: "POST", url: "/api/v1/query", body: `SELECT name FROM foo WHERE id > 1; INSERT INTO bar VALUES ()`, code: http.StatusBadRequest, exp: `{"error":{"code":"parse_error","message":"found \")\", expected expression at line 1, column 60","position":{"offset":59,"line":1,"column":60}}}`},
+		{method: "POST", url: "/api/v1/query", body: `SELECT name FROM foo WHERE id > 1; CREATE TABLE baz (n)`, code: http.StatusOK, exp: `{"results":[{"columns":["name"],"rows":[["b"],["c"]],"rows_affected":0},{"columns":[],"rows":[],"rows_affected":0}]}`},
+		{method: "PATCH", url: "/api/v1/tables/baz", body: `{"name":"qux"}`, code: http.StatusOK, exp: `{"name":"qux","columns":[{"name":"n"}]}`},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, w.Code)
+		} else if typ := w.Header().Get("Content-Type"); typ != "application/json" {
+			t.Fatalf("%d. unexpected content type: %s", i, typ)
+		} else if w.Body.String() != tt.exp+"\n" {
+			t.Fatalf("%d. unexpected body: %s", i, w.Body.String())
+		}
+	}
+}
+
+// Ensure API errors are returned in a JSON envelope with a code.
+func TestHandler_API_Err(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "id", Type: pie.IntegerType, Unique: true}})
+
+	for i, tt := range []struct {
+		method string
+		url    string
+		body   string
+		code   int
+		exp    string
+	}{
+		{method: "GET", url: "/api/v1/tables/bar", code: http.StatusNotFound, exp: `{"error":{"code":"table_not_found","message":"table not found"}}`},
+		{method: "GET", url: "/api/v1/tables/bar/rows", code: http.StatusNotFound, exp: `{"error":{"code":"table_not_found","message":"table not found"}}`},
+		{method: "GET", url: "/api/v1/tables/foo/rows?limit=0", code: http.StatusBadRequest, exp: `{"error":{"code":"invalid_parameter","message":"invalid limit: \"0\""}}`},
+		{method: "GET", url: "/api/v1/tables/foo/rows?offset=x", code: http.StatusBadRequest, exp: `{"error":{"code":"invalid_parameter","message":"invalid offset: \"x\""}}`},
+		{method: "GET", url: "/api/v1/nothing", code: http.StatusNotFound, exp: `{"error":{"code":"not_found","message":"not found"}}`},
+		{method: "GET", url: "/api/v1/query", code: http.StatusMethodNotAllowed, exp: `{"error":{"code":"method_not_allowed","message":"method not allowed"}}`},
+		{method: "POST", url: "/api/v1/query", body: `CREATE TABLE foo (n)`, code: http.StatusConflict, exp: `{"error":{"code":"table_exists","message":"table already exists"}}`},
+		{method: "POST", url: "/api/v1/query", body: `SELECT x FROM foo`, code: http.StatusBadRequest, exp: `{"error":{"code":"column_not_found","message":"column not found: x"}}`},
+		{method: "POST", url: "/api/v1/query", body: `UPDATE foo SET x = 1`, code: http.StatusBadRequest, exp: `{"error":{"code":"column_not_found","message":"column not found: x"}}`},
+		{method: "POST", url: "/api/v1/query", body: `INSERT INTO foo VALUES ('x')`, code: http.StatusBadRequest, exp: `{"error":{"code":"invalid_value","message":"row 1: column \"id\": invalid integer: \"x\""}}`},
+		{method: "POST", url: "/api/v1/query", body: `INSERT INTO foo VALUES (1), (1)`, code: http.StatusBadRequest, exp: `{"error":{"code":"constraint_violated","message":"row 2, column \"id\": duplicate value \"1\", also in row 1"}}`},
+		{method: "DELETE", url: "/api/v1/tables/bar", code: http.StatusNotFound, exp: `{"error":{"code":"table_not_found","message":"table not found"}}`},
+		{method: "PATCH", url: "/api/v1/tables/foo", body: `{"name":"foo"}`, code: http.StatusConflict, exp: `{"error":{"code":"table_exists","message":"table already exists"}}`},
+		{method: "PATCH", url: "/api/v1/tables/foo", body: `{`, code: http.StatusBadRequest, exp: `{"error":{"code":"invalid_parameter","message":"invalid request body: unexpected EOF"}}`},
+		{method: "POST", url: "/api/v1/query", body: `CREATE INDEX "" ON foo (id)`, code: http.StatusBadRequest, exp: `{"error":{"code":"index_name_required","message":"index name required"}}`},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, w.Code)
+		} else if w.Body.String() != tt.exp+"\n" {
+			t.Fatalf("%d. unexpected body: %s", i, w.Body.String())
+		}
+	}
+}
+
+// Ensure a table can be deleted through the API.
+func TestHandler_API_DeleteTable(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", nil)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/api/v1/tables/foo", nil)
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Body.Len() != 0 {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	} else if db.Table("foo") != nil {
+		t.Fatal("unexpected table")
+	}
+}
+
+// Ensure a query that times out returns a timeout error code.
+func TestHandler_API_QueryTimeout(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/api/v1/query", strings.NewReader(`SHOW TABLES`))
+	r.Header.Set(pie.QueryTimeoutHeader, "1ns")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Body.String() != `{"error":{"code":"query_timeout","message":"query timeout exceeded"}}`+"\n" {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"os/user"
 	"path/filepath"
 	"strings"
@@ -43,6 +48,8 @@ func main() {
 		runServer(args)
 	case "exec", "execute":
 		runExecute(args)
+	case "migrate":
+		runMigrate(args)
 	default:
 		log.Fatalf("invalid command: %s", cmd)
 	}
@@ -53,19 +60,26 @@ func runServer(args []string) {
 	fs := flag.NewFlagSet("pie", flag.ExitOnError)
 	dir := fs.String("d", "", "data directory")
 	addr := fs.String("addr", DefaultBindAddress, "bind address")
+	storage := fs.String("storage", "row", "storage backend (row, columnar or memory)")
+	queryTimeout := fs.Duration("query-timeout", 0, "maximum time a query can run (0 for no limit)")
 	fs.Parse(args)
 
 	// Set data directory to user directory if not set.
 	if *dir == "" {
-		usr, err := user.Current()
-		if err != nil {
-			log.Fatal(err)
-		}
-		*dir = filepath.Join(usr.HomeDir, ".pie")
+		*dir = defaultDataDir()
 	}
 
 	// Open database.
 	db := pie.NewDatabase()
+	switch *storage {
+	case "row":
+	case "columnar":
+		db.Storage = pie.NewColumnarStorage()
+	case "memory":
+		db.Storage = pie.NewMemStorage()
+	default:
+		log.Fatalf("invalid storage backend: %s", *storage)
+	}
 	if err := db.Open(*dir); err != nil {
 		log.Fatalf("open: %s", err)
 	}
@@ -73,6 +87,7 @@ func runServer(args []string) {
 
 	// Initialize handler.
 	h := pie.NewHandler(db)
+	h.QueryTimeout = *queryTimeout
 
 	// Start HTTP handler.
 	log.Printf("Listening on http://localhost%s", *addr)
@@ -80,23 +95,89 @@ func runServer(args []string) {
 	http.ListenAndServe(*addr, h)
 }
 
+func runMigrate(args []string) {
+	// Parse command line flags.
+	fs := flag.NewFlagSet("pie", flag.ExitOnError)
+	dir := fs.String("d", "", "data directory")
+	dryRun := fs.Bool("dry-run", false, "print the migration steps without applying them")
+	fs.Parse(args)
+
+	// Set data directory to user directory if not set.
+	if *dir == "" {
+		*dir = defaultDataDir()
+	}
+
+	// Upgrade the database files. The server must not be running.
+	steps, err := pie.Migrate(*dir, *dryRun)
+	if err != nil {
+		log.Fatalf("migrate: %s", err)
+	} else if len(steps) == 0 {
+		fmt.Printf("Database is up to date (format version %d)\n", pie.FormatVersion)
+		return
+	}
+
+	// Report each step applied or pending.
+	for _, step := range steps {
+		fmt.Printf("version %d: %s\n", step.Version, step.Description)
+	}
+	if *dryRun {
+		fmt.Printf("Dry run: %d step(s) not applied\n", len(steps))
+	} else {
+		fmt.Printf("Migrated to format version %d\n", pie.FormatVersion)
+	}
+}
+
 func runExecute(args []string) {
 	// Parse command line flags.
 	fs := flag.NewFlagSet("pie", flag.ExitOnError)
 	addr := fs.String("addr", DefaultBindAddress, "bind address")
+	format := fs.String("format", string(pie.FormatTable), "output format (table, csv, tsv, json, ndjson, markdown, html or xlsx)")
+	timeout := fs.Duration("timeout", 0, "maximum time the query can run (0 for the server's limit)")
 	fs.Parse(args)
 
-	// Read query string from arguments.
+	// Read query string from arguments or from STDIN if no arguments passed.
 	str := strings.Join(fs.Args(), " ")
+	if fs.NArg() == 0 {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		str = string(b)
+	}
+
+	// Cancel the query on the server if interrupted.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
 	// Execute POST against remote pie.
-	u := fmt.Sprintf("http://localhost%s/query", *addr)
-	resp, err := http.Post(u, "application/pieql", strings.NewReader(str))
+	u := fmt.Sprintf("http://localhost%s/query?format=%s", *addr, url.QueryEscape(*format))
+	req, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(str))
 	if err != nil {
 		log.Fatal(err)
 	}
+	req.Header.Set("Content-Type", "application/pieql")
+	if *timeout > 0 {
+		req.Header.Set(pie.QueryTimeoutHeader, timeout.String())
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if ctx.Err() != nil {
+		log.Fatal("query canceled")
+	} else if err != nil {
+		log.Fatal(err)
+	}
 	defer resp.Body.Close()
 
+	// Report parse errors with the location of the error.
+	if resp.StatusCode != http.StatusOK && resp.Header.Get("Content-Type") == "application/json" {
+		var e parseError
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintln(os.Stderr, e.Error)
+		fmt.Fprint(os.Stderr, e.underline(str))
+		os.Exit(-1)
+	}
+
 	// Report non-200 status code.
 	if resp.StatusCode != http.StatusOK {
 		io.Copy(os.Stderr, resp.Body)
@@ -104,5 +185,48 @@ func runExecute(args []string) {
 	}
 
 	// Write out response body.
-	io.Copy(os.Stdout, resp.Body)
+	if _, err := io.Copy(os.Stdout, resp.Body); ctx.Err() != nil {
+		log.Fatal("query canceled")
+	} else if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// defaultDataDir returns the data directory within the user's home directory.
+func defaultDataDir() string {
+	usr, err := user.Current()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return filepath.Join(usr.HomeDir, ".pie")
+}
+
+// parseError represents a parse error returned by the server.
+type parseError struct {
+	Error  string `json:"error"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// underline returns the line of the query containing the error followed by
+// a line with a caret under the error's column.
+func (e *parseError) underline(query string) string {
+	lines := strings.Split(query, "\n")
+	if e.Line < 1 || e.Line > len(lines) {
+		return ""
+	}
+	line := strings.TrimRight(lines[e.Line-1], "\r")
+
+	// Keep tabs in the padding so the caret lines up with the query.
+	var pad []rune
+	for i, ch := range []rune(line) {
+		if i >= e.Column-1 {
+			break
+		} else if ch == '\t' {
+			pad = append(pad, ch)
+		} else {
+			pad = append(pad, ' ')
+		}
+	}
+	return line + "\n" + string(pad) + "^\n"
 }
@@ -0,0 +1,609 @@
+package pie
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultBlockSize is the default number of rows stored in each block.
+	DefaultBlockSize = 1024
+)
+
+// ColumnarStorage stores each column of a table in a separate file so that
+// queries only read the columns they reference.
+//
+// Rows are split into blocks. Each column file holds one line per block with
+// the block's distinct values and the run lengths of each value. A separate
+// stats file holds the row count and the minimum & maximum value of every
+// column in each block so that blocks which can't match a query's condition
+// are skipped without being decoded.
+type ColumnarStorage struct {
+	root string // database root directory
+	path string // data directory
+
+	// Maximum number of rows in each block.
+	BlockSize int
+}
+
+// NewColumnarStorage returns a new instance of ColumnarStorage.
+func NewColumnarStorage() *ColumnarStorage {
+	return &ColumnarStorage{BlockSize: DefaultBlockSize}
+}
+
+// Name returns the name of the backend.
+func (s *ColumnarStorage) Name() string { return "columnar" }
+
+// Open creates the root & data directories for the database and migrates
+// files written by older versions.
+func (s *ColumnarStorage) Open(path string) error {
+	if path == "" {
+		return errors.New("path required")
+	} else if err := os.MkdirAll(filepath.Join(path, "data"), 0700); err != nil {
+		return err
+	}
+	s.root, s.path = path, filepath.Join(path, "data")
+
+	// Finish replacing any table directories and appends that were
+	// interrupted.
+	if err := s.recover(); err != nil {
+		s.root, s.path = "", ""
+		return err
+	} else if err := replayWAL(filepath.Join(s.root, "wal"), s.path, s.appendRows); err != nil {
+		s.root, s.path = "", ""
+		return err
+	} else if _, err := Migrate(s.root, false); err != nil {
+		s.root, s.path = "", ""
+		return err
+	}
+	return nil
+}
+
+// recover restores table directories left behind by an interrupted WriteRows.
+// A new directory is only moved into place once it's complete so it's used
+// if it exists. Otherwise the previous directory is restored.
+func (s *ColumnarStorage) recover() error {
+	olds, err := filepath.Glob(filepath.Join(s.path, "*.old"))
+	if err != nil {
+		return err
+	}
+
+	for _, old := range olds {
+		path := strings.TrimSuffix(old, ".old")
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if _, err := os.Stat(path + ".tmp"); err == nil {
+				if err := os.Rename(path+".tmp", path); err != nil {
+					return err
+				}
+			} else if err := os.Rename(old, path); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if err := os.RemoveAll(old); err != nil {
+			return err
+		}
+	}
+
+	return syncDir(s.path)
+}
+
+// Close closes the backend.
+func (s *ColumnarStorage) Close() error {
+	s.root, s.path = "", ""
+	return nil
+}
+
+// LoadMeta reads the tables from the meta file.
+func (s *ColumnarStorage) LoadMeta() ([]*Table, error) {
+	if s.root == "" {
+		return nil, ErrNotOpen
+	}
+	return loadMetaFile(s.root, s.Name())
+}
+
+// SaveMeta writes the tables to the meta file.
+func (s *ColumnarStorage) SaveMeta(tables []*Table) error {
+	if s.root == "" {
+		return ErrNotOpen
+	}
+	return saveMetaFile(s.root, s.Name(), tables)
+}
+
+// tablePath returns the directory holding a table's column files.
+func (s *ColumnarStorage) tablePath(name string) string {
+	return filepath.Join(s.path, name)
+}
+
+// RowIterator returns a cursor over the rows of a table. Only the requested
+// columns are decoded and blocks without any required rows or that can't
+// match the condition are skipped.
+func (s *ColumnarStorage) RowIterator(t *Table, opt IteratorOptions) (RowIterator, error) {
+	if s.path == "" {
+		return nil, ErrNotOpen
+	}
+	path := s.tablePath(t.dataKey())
+
+	// Tables without a data directory have no rows.
+	itr := &columnarIterator{table: t, opt: opt}
+	f, err := os.Open(filepath.Join(path, "stats"))
+	if os.IsNotExist(err) {
+		return &rowSliceIterator{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	itr.files = append(itr.files, f)
+	itr.stats = bufio.NewReader(f)
+
+	// Open a file for each requested column.
+	itr.columns = make([]*bufio.Reader, len(t.Columns))
+	for i := range t.Columns {
+		if !opt.hasColumn(i) {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(path, strconv.Itoa(i)))
+		if err != nil {
+			_ = itr.Close()
+			return nil, err
+		}
+		itr.files = append(itr.files, f)
+		itr.columns[i] = bufio.NewReader(f)
+	}
+
+	return itr, nil
+}
+
+// WriteRows writes the rows to a temporary directory and then replaces the
+// table's data directory.
+func (s *ColumnarStorage) WriteRows(t *Table, itr RowIterator) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+	path := s.tablePath(t.dataKey())
+
+	// Write the new rows alongside the existing directory.
+	tmp := path + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	} else if err := os.MkdirAll(tmp, 0700); err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	w, err := s.newColumnarWriter(t, tmp, os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = w.Close() }()
+
+	for {
+		row, err := itr.Next()
+		if err != nil {
+			return err
+		} else if row == nil {
+			break
+		} else if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// Move the existing directory out of the way before replacing it.
+	old := path + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	} else if err := os.Rename(path, old); err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err := os.Rename(tmp, path); err != nil {
+		return err
+	} else if err := syncDir(s.path); err != nil {
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// AppendRows appends new blocks to the end of the table's column files.
+func (s *ColumnarStorage) AppendRows(t *Table, rows [][]string) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+
+	// Log the append so it can be completed if the process stops.
+	paths := []string{filepath.Join(t.dataKey(), "stats")}
+	for i := range t.Columns {
+		paths = append(paths, filepath.Join(t.dataKey(), strconv.Itoa(i)))
+	}
+	e, err := newWALEntry(t, s.path, paths, rows)
+	if err != nil {
+		return err
+	}
+	return writeAhead(filepath.Join(s.root, "wal", t.dataKey()), s.path, e, func() error {
+		return s.appendRows(t, rows)
+	})
+}
+
+// appendRows writes rows as new blocks at the end of the table's files.
+func (s *ColumnarStorage) appendRows(t *Table, rows [][]string) error {
+	path := s.tablePath(t.dataKey())
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+
+	w, err := s.newColumnarWriter(t, path, os.O_CREATE|os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = w.Close() }()
+
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// MoveRows renames the table's data directory to key, replacing any
+// existing directory. Nothing is changed if the table has no data directory.
+func (s *ColumnarStorage) MoveRows(t *Table, key string) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+	path, dst := s.tablePath(t.dataKey()), s.tablePath(key)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if err := moveIndexFiles(s.root, t.dataKey(), key); err != nil {
+		return err
+	}
+
+	// Move the existing directory out of the way before replacing it.
+	old := dst + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	} else if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err := os.Rename(path, dst); err != nil {
+		return err
+	} else if err := syncDir(s.path); err != nil {
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// DeleteTable removes the table's data directory & index files.
+func (s *ColumnarStorage) DeleteTable(t *Table) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+	path, err := childPath(s.path, t.dataKey())
+	if err != nil {
+		return err
+	} else if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return deleteIndexFiles(s.root, t.dataKey())
+}
+
+// ReadIndex reads one of the table's index files.
+func (s *ColumnarStorage) ReadIndex(t *Table, name string) (*IndexData, error) {
+	if s.root == "" {
+		return nil, ErrNotOpen
+	}
+	path, err := indexPath(s.root, t.dataKey(), name)
+	if err != nil {
+		return nil, err
+	}
+	return readIndexFile(path)
+}
+
+// WriteIndex replaces one of the table's index files.
+func (s *ColumnarStorage) WriteIndex(t *Table, name string, data *IndexData) error {
+	if s.root == "" {
+		return ErrNotOpen
+	}
+	path, err := indexPath(s.root, t.dataKey(), name)
+	if err != nil {
+		return err
+	}
+	return writeIndexFile(path, data)
+}
+
+// columnBlock represents the values of one column within a block.
+// Values are stored as a dictionary of distinct cells and a list of runs.
+// Each run is a pair of a dictionary index and the number of repeated cells.
+type columnBlock struct {
+	Dict []string `json:"dict"`
+	Runs []int    `json:"runs"`
+}
+
+// blockStats represents the row count & value range of each column in a block.
+type blockStats struct {
+	N      int           `json:"n"`
+	Ranges []columnRange `json:"ranges"`
+}
+
+// columnarWriter buffers rows and writes them to column files in blocks.
+type columnarWriter struct {
+	table     *Table
+	blockSize int
+	rows      [][]string
+
+	files   []*os.File
+	stats   *bufio.Writer
+	columns []*bufio.Writer
+}
+
+// newColumnarWriter opens the stats & column files within a directory.
+func (s *ColumnarStorage) newColumnarWriter(t *Table, path string, flag int) (*columnarWriter, error) {
+	w := &columnarWriter{table: t, blockSize: s.BlockSize}
+	if w.blockSize <= 0 {
+		w.blockSize = DefaultBlockSize
+	}
+
+	names := []string{"stats"}
+	for i := range t.Columns {
+		names = append(names, strconv.Itoa(i))
+	}
+	for i, name := range names {
+		f, err := os.OpenFile(filepath.Join(path, name), os.O_WRONLY|flag, 0666)
+		if err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+		w.files = append(w.files, f)
+
+		if i == 0 {
+			w.stats = bufio.NewWriter(f)
+		} else {
+			w.columns = append(w.columns, bufio.NewWriter(f))
+		}
+	}
+
+	return w, nil
+}
+
+// WriteRow adds a row to the current block. Missing cells are left blank and
+// cells beyond the table's columns are dropped.
+func (w *columnarWriter) WriteRow(row []string) error {
+	w.rows = append(w.rows, row)
+	if len(w.rows) >= w.blockSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush encodes the buffered rows as a block.
+func (w *columnarWriter) flush() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+
+	stats := &blockStats{N: len(w.rows), Ranges: make([]columnRange, len(w.table.Columns))}
+	for i, c := range w.table.Columns {
+		// Build dictionary & runs for the column.
+		var blk columnBlock
+		indices := make(map[string]int)
+		for _, row := range w.rows {
+			var cell string
+			if i < len(row) {
+				cell = row[i]
+			}
+			stats.Ranges[i].add(c, cell)
+
+			index, ok := indices[cell]
+			if !ok {
+				index = len(blk.Dict)
+				indices[cell] = index
+				blk.Dict = append(blk.Dict, cell)
+			}
+
+			if n := len(blk.Runs); n > 0 && blk.Runs[n-2] == index {
+				blk.Runs[n-1]++
+			} else {
+				blk.Runs = append(blk.Runs, index, 1)
+			}
+		}
+
+		if err := json.NewEncoder(w.columns[i]).Encode(&blk); err != nil {
+			return err
+		}
+	}
+	if err := json.NewEncoder(w.stats).Encode(stats); err != nil {
+		return err
+	}
+
+	w.rows = w.rows[:0]
+	return nil
+}
+
+// Close writes any buffered rows, syncs the files to disk and closes them.
+// Calling Close after the files are closed is a no-op.
+func (w *columnarWriter) Close() error {
+	if w.files == nil {
+		return nil
+	}
+
+	err := w.flush()
+	for _, bw := range append([]*bufio.Writer{w.stats}, w.columns...) {
+		if bw == nil {
+			continue
+		} else if e := bw.Flush(); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, f := range w.files {
+		if e := f.Sync(); e != nil && err == nil {
+			err = e
+		}
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	w.files = nil
+	return err
+}
+
+// columnarIterator reads rows from the column files of a table one block
+// at a time.
+type columnarIterator struct {
+	table *Table
+	opt   IteratorOptions
+
+	files   []*os.File
+	stats   *bufio.Reader
+	columns []*bufio.Reader // nil for columns that aren't read
+
+	rows [][]string // decoded rows remaining in the current block
+	pos  int        // position of the first row in the next block
+}
+
+// Next returns the next row.
+func (itr *columnarIterator) Next() ([]string, error) {
+	for len(itr.rows) == 0 {
+		if err := itr.nextBlock(); err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	row := itr.rows[0]
+	itr.rows = itr.rows[1:]
+	return row, nil
+}
+
+// nextBlock decodes the next block that may match the condition.
+// Returns io.EOF when there are no more blocks.
+func (itr *columnarIterator) nextBlock() error {
+	t := itr.table
+	if itr.opt.rowsDone(itr.pos) {
+		return io.EOF
+	}
+
+	line, err := itr.stats.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return io.EOF
+	} else if err != nil && err != io.EOF {
+		return err
+	}
+
+	var stats blockStats
+	if err := json.Unmarshal(line, &stats); err != nil {
+		return fmt.Errorf("invalid block stats: %s", err)
+	}
+
+	// Skip the block if none of its rows are required or can match.
+	start := itr.pos
+	itr.pos += stats.N
+	if !itr.opt.hasRowIn(start, itr.pos) || (itr.opt.Condition != nil && canSkipRange(t, stats.Ranges, itr.opt.Condition)) {
+		for _, r := range itr.columns {
+			if r == nil {
+				continue
+			} else if err := skipLine(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Decode each column read into the block's rows.
+	rows := make([][]string, stats.N)
+	for i := range rows {
+		rows[i] = make([]string, len(t.Columns))
+	}
+	for i, r := range itr.columns {
+		if r == nil {
+			continue
+		} else if err := decodeColumnBlock(r, rows, i); err != nil {
+			return fmt.Errorf("column %q: %s", t.Columns[i].Name, err)
+		}
+	}
+
+	// Keep only the required rows.
+	if itr.opt.Rows != nil {
+		a := rows[:0]
+		for i, row := range rows {
+			if itr.opt.hasRowIn(start+i, start+i+1) {
+				a = append(a, row)
+			}
+		}
+		rows = a
+	}
+	itr.rows = rows
+
+	return nil
+}
+
+// Close closes the column files.
+func (itr *columnarIterator) Close() error {
+	var err error
+	for _, f := range itr.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	itr.files = nil
+	return err
+}
+
+// decodeColumnBlock reads the next block of a column and sets each row's cell
+// at index. Returns an error if the block doesn't match the number of rows.
+func decodeColumnBlock(r *bufio.Reader, rows [][]string, index int) error {
+	line, err := r.ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return errors.New("unexpected end of column")
+	} else if err != nil && err != io.EOF {
+		return err
+	}
+
+	var blk columnBlock
+	if err := json.Unmarshal(line, &blk); err != nil {
+		return fmt.Errorf("invalid block: %s", err)
+	}
+
+	// Expand each run into the rows.
+	var n int
+	for i := 0; i+1 < len(blk.Runs); i += 2 {
+		value, count := blk.Runs[i], blk.Runs[i+1]
+		if value < 0 || value >= len(blk.Dict) || count < 0 || n+count > len(rows) {
+			return errors.New("invalid block: run out of range")
+		}
+		for j := 0; j < count; j++ {
+			rows[n][index] = blk.Dict[value]
+			n++
+		}
+	}
+	if n != len(rows) {
+		return fmt.Errorf("invalid block: expected %d values, got %d", len(rows), n)
+	}
+
+	return nil
+}
+
+// skipLine discards the reader's input up to and including the next newline.
+func skipLine(r *bufio.Reader) error {
+	for {
+		_, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		} else if err == io.EOF {
+			return errors.New("unexpected end of column")
+		}
+		return err
+	}
+}
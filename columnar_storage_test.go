@@ -0,0 +1,172 @@
+package pie_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure the columnar storage engine can write, append, rewrite and read rows.
+func TestColumnarStorage(t *testing.T) {
+	db := OpenColumnarDatabase(2)
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n", Type: pie.IntegerType}, {Name: "name"}})
+
+	if err := db.SetTableRows("foo", [][]string{{"1", "susy"}, {"2", "susy"}, {"3", "bob"}}); err != nil {
+		t.Fatal(err)
+	} else if err := db.AppendTableRows("foo", [][]string{{"4", "jim"}, {"", ""}}); err != nil {
+		t.Fatal(err)
+	} else if rows, err := db.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1", "susy"}, {"2", "susy"}, {"3", "bob"}, {"4", "jim"}, {"", ""}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+
+	// Modify rows in place.
+	if _, err := db.Execute(MustParseStatement(`UPDATE foo SET name = 'sue' WHERE name = 'susy'`)); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Execute(MustParseStatement(`DELETE FROM foo WHERE n = 3`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		s    string
+		rows [][]string
+	}{
+		{s: `SELECT name FROM foo`, rows: [][]string{{"sue"}, {"sue"}, {"jim"}, {""}}},
+		{s: `SELECT COUNT(*) FROM foo`, rows: [][]string{{"4"}}},
+		{s: `SELECT n FROM foo WHERE n > 1 AND n <= 4`, rows: [][]string{{"2"}, {"4"}}},
+		{s: `SELECT n FROM foo WHERE foo.n = 1 OR name = 'jim'`, rows: [][]string{{"1"}, {"4"}}},
+		{s: `SELECT n FROM foo WHERE 4 <= n`, rows: [][]string{{"4"}}},
+		{s: `SELECT n FROM foo WHERE n = 10`, rows: nil},
+	} {
+		if res, err := db.Execute(MustParseStatement(tt.s)); err != nil {
+			t.Errorf("%d. %s: unexpected error: %s", i, tt.s, err)
+		} else if !reflect.DeepEqual(res.Rows, tt.rows) {
+			t.Errorf("%d. %s: unexpected rows: %#v", i, tt.s, res.Rows)
+		}
+	}
+
+	// Deleting the table removes its data directory.
+	if err := db.DeleteTable("foo"); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(filepath.Join(db.Path(), "data", "foo")); !os.IsNotExist(err) {
+		t.Fatalf("expected data directory to be removed: %v", err)
+	}
+}
+
+// Ensure removing a table never removes files outside the data & index
+// directories, even if the table's name was stored before names were checked.
+func TestColumnarStorage_DeleteTable_InvalidName(t *testing.T) {
+	db := OpenColumnarDatabase(0)
+	defer db.Close()
+	path := db.Path()
+	db.Database.Close()
+
+	meta := fmt.Sprintf(`{"format":%d,"storage":"columnar","tables":[{"name":".."}]}`, pie.FormatVersion)
+	if err := ioutil.WriteFile(filepath.Join(path, "meta"), []byte(meta), 0666); err != nil {
+		t.Fatal(err)
+	} else if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	} else if err := db.DeleteTable(".."); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(path, "meta")); err != nil {
+		t.Fatalf("expected database to remain: %v", err)
+	} else if _, err := os.Stat(filepath.Join(path, "data")); err != nil {
+		t.Fatalf("expected data directory to remain: %v", err)
+	}
+}
+
+// Ensure the columnar storage engine only reads the columns a query uses.
+func TestColumnarStorage_Columns(t *testing.T) {
+	db := OpenColumnarDatabase(2)
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}, {Name: "b"}})
+	db.CreateTable("bar", []*pie.Column{{Name: "a"}, {Name: "c"}})
+	db.SetTableRows("foo", [][]string{{"1", "x"}, {"2", "y"}, {"3", "z"}})
+	db.SetTableRows("bar", [][]string{{"1", "p"}, {"3", "q"}})
+
+	// Corrupt the second column of the source table.
+	if err := ioutil.WriteFile(filepath.Join(db.Path(), "data", "foo", "1"), []byte("!!!\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := db.Execute(MustParseStatement(`SELECT foo.a, c FROM foo JOIN bar ON foo.a = bar.a ORDER BY foo.a`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"1", "p"}, {"3", "q"}}) {
+		t.Fatalf("unexpected rows: %#v", res.Rows)
+	} else if res, err := db.Execute(MustParseStatement(`SELECT COUNT(*) FROM foo`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"3"}}) {
+		t.Fatalf("unexpected rows: %#v", res.Rows)
+	}
+
+	// Reading the corrupt column returns an error.
+	if _, err := db.Execute(MustParseStatement(`SELECT b FROM foo`)); err == nil || !strings.HasPrefix(err.Error(), `column "b": invalid block`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the columnar storage engine skips blocks that can't match a condition.
+func TestColumnarStorage_SkipBlocks(t *testing.T) {
+	db := OpenColumnarDatabase(2)
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n", Type: pie.IntegerType}})
+	db.SetTableRows("foo", [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}, {"6"}})
+
+	// Corrupt the values of the second block.
+	path := filepath.Join(db.Path(), "data", "foo", "0")
+	if b, err := ioutil.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if lines := strings.SplitAfter(string(b), "\n"); len(lines) != 4 {
+		t.Fatalf("unexpected block count: %d", len(lines)-1)
+	} else if err := ioutil.WriteFile(path, []byte(lines[0]+"!!!\n"+lines[2]), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := db.Execute(MustParseStatement(`SELECT n FROM foo WHERE (n < 2 OR n >= 5) AND n != 6`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"1"}, {"5"}}) {
+		t.Fatalf("unexpected rows: %#v", res.Rows)
+	}
+
+	// Blocks are read if they may contain a match.
+	if _, err := db.Execute(MustParseStatement(`SELECT n FROM foo WHERE n = 3 OR n = 6`)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// Ensure a database can't be reopened with a different storage engine.
+func TestColumnarStorage_ErrStorageMismatch(t *testing.T) {
+	db := OpenColumnarDatabase(0)
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}})
+
+	if err := pie.NewDatabase().Open(db.Path()); err == nil || err.Error() != `database uses columnar storage` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// OpenColumnarDatabase returns a new, opened database using columnar storage.
+// Uses the default block size if blockSize is zero.
+func OpenColumnarDatabase(blockSize int) *Database {
+	s := pie.NewColumnarStorage()
+	if blockSize > 0 {
+		s.BlockSize = blockSize
+	}
+
+	db := pie.NewDatabase()
+	db.Storage = s
+	if err := db.Open(tempfile()); err != nil {
+		panic(err.Error())
+	}
+	return &Database{db}
+}
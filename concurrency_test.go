@@ -0,0 +1,110 @@
+package pie_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure the database can be used by many goroutines at once.
+// This test is most useful when run with the race detector enabled.
+func TestDatabase_Concurrent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		db   *Database
+	}{
+		{name: "row", db: OpenDatabase()},
+		{name: "columnar", db: OpenColumnarDatabase(4)},
+		{name: "memory", db: OpenMemDatabase()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.db
+			defer db.Close()
+			if err := db.CreateTable("shared", []*pie.Column{{Name: "n", Type: pie.IntegerType}}); err != nil {
+				t.Fatal(err)
+			}
+			h := pie.NewHandler(db.Database)
+
+			const n = 20
+			var wg sync.WaitGroup
+			errs := make(chan error, 100)
+			run := func(fn func(i int) error) {
+				for i := 0; i < 4; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						for j := 0; j < n; j++ {
+							if err := fn(i); err != nil {
+								errs <- err
+								return
+							}
+						}
+					}(i)
+				}
+			}
+
+			// Append to a shared table.
+			run(func(i int) error {
+				_, err := db.Execute(MustParseStatement(`INSERT INTO shared VALUES (` + strconv.Itoa(i) + `)`))
+				return err
+			})
+
+			// Query the shared table while it's being written.
+			run(func(i int) error {
+				res, err := db.Execute(MustParseStatement(`SELECT COUNT(*), SUM(n) FROM shared WHERE n >= 0`))
+				if err != nil {
+					return err
+				} else if len(res.Rows) != 1 {
+					return fmt.Errorf("unexpected rows: %#v", res.Rows)
+				}
+				return nil
+			})
+
+			// Create, fill, read & drop separate tables.
+			run(func(i int) error {
+				name := "t" + strconv.Itoa(i)
+				if err := db.CreateTable(name, []*pie.Column{{Name: "a"}}); err != nil {
+					return err
+				} else if err := db.SetTableRows(name, [][]string{{"x"}}); err != nil {
+					return err
+				} else if err := db.AppendTableRows(name, [][]string{{"y"}}); err != nil {
+					return err
+				} else if rows, err := db.TableRows(name); err != nil {
+					return err
+				} else if len(rows) != 2 {
+					return fmt.Errorf("unexpected rows: %#v", rows)
+				}
+				return db.DeleteTable(name)
+			})
+
+			// List tables over HTTP.
+			run(func(i int) error {
+				w := httptest.NewRecorder()
+				r, _ := http.NewRequest("GET", "/tables", nil)
+				h.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					return fmt.Errorf("unexpected status: %d", w.Code)
+				}
+				return nil
+			})
+
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			// Verify every insert was written.
+			if rows, err := db.TableRows("shared"); err != nil {
+				t.Fatal(err)
+			} else if len(rows) != 4*n {
+				t.Fatalf("unexpected row count: %d", len(rows))
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package pie
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Schema represents the columns & primary key declared for a table.
+type Schema struct {
+	Columns    []*Column `json:"columns"`
+	PrimaryKey []string  `json:"primary_key,omitempty"`
+}
+
+// SchemaError represents an invalid column definition or primary key.
+type SchemaError struct {
+	Column string
+	Err    error
+}
+
+// Error returns the error message with the column name.
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("column %q: %s", e.Column, e.Err)
+}
+
+// validateSchema returns an error if a column's default doesn't match its
+// type or if the primary key references a missing or repeated column.
+func validateSchema(columns []*Column, primaryKey []string) error {
+	for _, c := range columns {
+		if !c.Type.IsValid() {
+			return &SchemaError{Column: c.Name, Err: fmt.Errorf("invalid column type: %s", c.Type)}
+		} else if _, err := c.ParseValue(c.Default); err != nil {
+			return &SchemaError{Column: c.Name, Err: fmt.Errorf("invalid default: %s", err)}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range primaryKey {
+		var found bool
+		for _, c := range columns {
+			found = found || c.Name == name
+		}
+		if !found {
+			return &SchemaError{Column: name, Err: errors.New("primary key column not found")}
+		} else if seen[name] {
+			return &SchemaError{Column: name, Err: errors.New("duplicate primary key column")}
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// ConstraintError represents a row that violates a table's constraints.
+type ConstraintError struct {
+	Row    int // position of the row, starting from one
+	Column string
+	Err    error
+}
+
+// Error returns the error message with the row number & column name.
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("row %d, column %q: %s", e.Row, e.Column, e.Err)
+}
+
+// constraintChecker fills in default values and verifies rows against a
+// table's constraints. Rows are compared against every row checked or
+// seeded before.
+type constraintChecker struct {
+	t          *Table
+	primaryKey []int  // positions of the primary key columns
+	unit       string // name of the numbers passed to check
+
+	unique map[int]map[string]int // row number of each value by column
+	keys   map[string]int         // row number of each primary key
+}
+
+// newConstraintChecker returns a checker for a table's rows.
+func newConstraintChecker(t *Table) *constraintChecker {
+	chk := &constraintChecker{
+		t:      t,
+		unit:   "row",
+		unique: make(map[int]map[string]int),
+		keys:   make(map[string]int),
+	}
+	for _, name := range t.PrimaryKey {
+		chk.primaryKey = append(chk.primaryKey, t.ColumnIndex(name))
+	}
+	for i, c := range t.Columns {
+		if c.Unique {
+			chk.unique[i] = make(map[string]int)
+		}
+	}
+	return chk
+}
+
+// check returns the row with defaults in place of empty cells. Returns a
+// *ConstraintError if a required cell is empty or a unique value repeats
+// an earlier row. n is the row number reported in errors.
+func (chk *constraintChecker) check(row []string, n int) ([]string, error) {
+	columns := chk.t.Columns
+
+	// Replace empty cells with their column's default on a copy of the row.
+	copied := false
+	for i, c := range columns {
+		if c.Default == "" || !isEmptyCell(cellAt(row, i)) {
+			continue
+		}
+		if !copied {
+			other := make([]string, len(columns))
+			copy(other, row)
+			row, copied = other, true
+		}
+		row[i] = c.Default
+	}
+
+	// Verify required cells have values & unique values aren't repeated.
+	for i, c := range columns {
+		cell := cellAt(row, i)
+		if isEmptyCell(cell) {
+			if c.NotNull || chk.isPrimaryKey(i) {
+				return nil, &ConstraintError{Row: n, Column: c.Name, Err: errors.New("value required")}
+			}
+			continue
+		}
+
+		values := chk.unique[i]
+		if values == nil {
+			continue
+		}
+		key := cellKey(c, cell)
+		if prev, ok := values[key]; ok {
+			return nil, &ConstraintError{Row: n, Column: c.Name, Err: fmt.Errorf("duplicate value %q, also in %s", cell, chk.describe(prev))}
+		}
+		values[key] = n
+	}
+
+	// Verify the primary key isn't repeated.
+	if len(chk.primaryKey) > 0 {
+		key := chk.primaryKeyOf(row)
+		if prev, ok := chk.keys[key]; ok {
+			return nil, &ConstraintError{Row: n, Column: strings.Join(chk.t.PrimaryKey, ", "), Err: fmt.Errorf("duplicate primary key, also in %s", chk.describe(prev))}
+		}
+		chk.keys[key] = n
+	}
+
+	return row, nil
+}
+
+// seed records the unique values & primary keys of rows already in the
+// table so that checked rows can't repeat them.
+func (chk *constraintChecker) seed(itr RowIterator) error {
+	for n := 1; ; n++ {
+		row, err := itr.Next()
+		if err != nil {
+			return err
+		} else if row == nil {
+			return nil
+		}
+		chk.seedRow(row, n)
+	}
+}
+
+// seedRow records the unique values & primary key of the existing row at
+// position n, numbered from one. Existing rows are recorded with negative
+// numbers.
+func (chk *constraintChecker) seedRow(row []string, n int) {
+	for i, values := range chk.unique {
+		if cell := cellAt(row, i); !isEmptyCell(cell) {
+			values[cellKey(chk.t.Columns[i], cell)] = -n
+		}
+	}
+	if len(chk.primaryKey) > 0 {
+		chk.keys[chk.primaryKeyOf(row)] = -n
+	}
+}
+
+// comparesRows returns true if rows are checked against other rows, in
+// which case existing rows must be seeded before checking new rows.
+func (chk *constraintChecker) comparesRows() bool {
+	return len(chk.unique) > 0 || len(chk.primaryKey) > 0
+}
+
+// primaryKeyOf returns a key for comparing the primary key of rows.
+func (chk *constraintChecker) primaryKeyOf(row []string) string {
+	keys := make([]string, len(chk.primaryKey))
+	for i, index := range chk.primaryKey {
+		keys[i] = cellKey(chk.t.Columns[index], cellAt(row, index))
+	}
+	return strings.Join(keys, "\x00")
+}
+
+// describe returns the position of a checked row for error messages.
+func (chk *constraintChecker) describe(n int) string {
+	if n < 0 {
+		return fmt.Sprintf("existing row %d", -n)
+	}
+	return fmt.Sprintf("%s %d", chk.unit, n)
+}
+
+// isPrimaryKey returns true if the column at index is part of the primary key.
+func (chk *constraintChecker) isPrimaryKey(index int) bool {
+	for _, i := range chk.primaryKey {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRows returns the rows with defaults filled in. Returns a
+// *ConstraintError for the first row that violates the table's constraints.
+func checkRows(t *Table, rows [][]string) ([][]string, error) {
+	if !t.hasConstraints() {
+		return rows, nil
+	}
+
+	return newConstraintChecker(t).checkAll(rows)
+}
+
+// checkAll checks each row, numbered from one, and returns the rows with
+// defaults filled in.
+func (chk *constraintChecker) checkAll(rows [][]string) ([][]string, error) {
+	a := make([][]string, len(rows))
+	for i, row := range rows {
+		row, err := chk.check(row, i+1)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = row
+	}
+	return a, nil
+}
+
+// cellAt returns the cell at index. Returns a blank cell if the row is short.
+func cellAt(row []string, index int) string {
+	if index >= len(row) {
+		return ""
+	}
+	return row[index]
+}
+
+// isEmptyCell returns true if a cell holds no value.
+func isEmptyCell(s string) bool { return strings.TrimSpace(s) == "" }
+
+// cellKey returns a key for comparing cells so that cells with the same
+// value in a typed column are equal. Invalid cells are compared as text.
+func cellKey(c *Column, s string) string {
+	if v, err := c.ParseValue(s); err == nil && v != nil {
+		return formatValue(v)
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package pie_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure rows are checked against column constraints & the primary key.
+func TestDatabase_SetTableRows_Constraints(t *testing.T) {
+	for i, tt := range []struct {
+		rows [][]string
+		exp  [][]string
+		err  string
+	}{
+		{rows: [][]string{{"1", "a", "x", ""}, {"2", "b", "", "y"}}, exp: [][]string{{"1", "a", "x", "new"}, {"2", "b", "", "y"}}},
+		{rows: [][]string{{"1", "a", "", ""}, {"2", " ", "", ""}}, err: `row 2, column "name": value required`},
+		{rows: [][]string{{"1", "a", "x", ""}, {"2", "b", "y", ""}, {"3", "c", "x", ""}}, err: `row 3, column "email": duplicate value "x", also in row 1`},
+		{rows: [][]string{{"1", "a", "", ""}, {"01", "a", "", ""}}, err: `row 2, column "id, name": duplicate primary key, also in row 1`},
+		{rows: [][]string{{"1", "a", "", ""}, {"1", "b", "", ""}}, exp: [][]string{{"1", "a", "", "new"}, {"1", "b", "", "new"}}},
+		{rows: [][]string{{"", "a", "", ""}}, err: `row 1, column "id": value required`},
+	} {
+		db := OpenMemDatabase()
+		if err := db.CreateTable("foo", []*pie.Column{
+			{Name: "id", Type: pie.IntegerType},
+			{Name: "name", NotNull: true},
+			{Name: "email", Unique: true},
+			{Name: "status", Default: "new"},
+		}, "id", "name"); err != nil {
+			t.Fatal(err)
+		}
+
+		err := db.SetTableRows("foo", tt.rows)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("%d. unexpected error: %v", i, err)
+			} else if _, ok := err.(*pie.ConstraintError); !ok {
+				t.Fatalf("%d. unexpected error type: %#v", i, err)
+			}
+		} else if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		} else if rows, _ := db.TableRows("foo"); !reflect.DeepEqual(rows, tt.exp) {
+			t.Fatalf("%d. unexpected rows: %#v", i, rows)
+		}
+		db.Close()
+	}
+}
+
+// Ensure inserted & updated rows are checked against column constraints &
+// the primary key, including the rows already in the table.
+func TestDatabase_Execute_Constraints(t *testing.T) {
+	initial := [][]string{{"1", "a", "x", "new"}, {"2", "b", "y", "new"}}
+	for i, tt := range []struct {
+		s   string
+		exp [][]string
+		err string
+	}{
+		{s: `INSERT INTO foo (id, name) VALUES (3, 'c')`, exp: append(initial, []string{"3", "c", "", "new"})},
+		{s: `INSERT INTO foo VALUES (1, 'c', '', '')`, err: `row 1, column "id": duplicate primary key, also in existing row 1`},
+		{s: `INSERT INTO foo (id) VALUES (3)`, err: `row 1, column "name": value required`},
+		{s: `INSERT INTO foo VALUES (3, 'c', 'z', ''), (4, 'd', 'y', '')`, err: `row 2, column "email": duplicate value "y", also in existing row 2`},
+		{s: `INSERT INTO foo VALUES (3, 'c', '', ''), (3, 'd', '', '')`, err: `row 2, column "id": duplicate primary key, also in row 1`},
+		{s: `UPDATE foo SET id = id + 1, status = ''`, exp: [][]string{{"2", "a", "x", "new"}, {"3", "b", "y", "new"}}},
+		{s: `UPDATE foo SET name = ''`, err: `row 1, column "name": value required`},
+		{s: `UPDATE foo SET id = 1 WHERE id = 2`, err: `row 2, column "id": duplicate primary key, also in existing row 1`},
+		{s: `UPDATE foo SET id = 5`, err: `row 2, column "id": duplicate primary key, also in row 1`},
+		{s: `UPDATE foo SET email = 'y' WHERE id = 1`, err: `row 1, column "email": duplicate value "y", also in existing row 2`},
+	} {
+		db := OpenMemDatabase()
+		if err := db.CreateTable("foo", []*pie.Column{
+			{Name: "id", Type: pie.IntegerType},
+			{Name: "name", NotNull: true},
+			{Name: "email", Unique: true},
+			{Name: "status", Default: "new"},
+		}, "id"); err != nil {
+			t.Fatal(err)
+		} else if err := db.SetTableRows("foo", initial); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := db.Execute(MustParseStatement(tt.s))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("%d. %s: unexpected error: %v", i, tt.s, err)
+			} else if _, ok := err.(*pie.ConstraintError); !ok {
+				t.Fatalf("%d. %s: unexpected error type: %#v", i, tt.s, err)
+			} else if rows, _ := db.TableRows("foo"); !reflect.DeepEqual(rows, initial) {
+				t.Fatalf("%d. %s: unexpected rows: %#v", i, tt.s, rows)
+			}
+		} else if err != nil {
+			t.Fatalf("%d. %s: unexpected error: %s", i, tt.s, err)
+		} else if rows, _ := db.TableRows("foo"); !reflect.DeepEqual(rows, tt.exp) {
+			t.Fatalf("%d. %s: unexpected rows: %#v", i, tt.s, rows)
+		}
+		db.Close()
+	}
+}
+
+// Ensure invalid defaults & primary keys are rejected.
+func TestDatabase_CreateTable_ErrSchema(t *testing.T) {
+	db := OpenMemDatabase()
+	defer db.Close()
+
+	for i, tt := range []struct {
+		columns    []*pie.Column
+		primaryKey []string
+		err        string
+	}{
+		{columns: []*pie.Column{{Name: "n", Type: pie.IntegerType, Default: "x"}}, err: `column "n": invalid default: invalid integer: "x"`},
+		{columns: []*pie.Column{{Name: "n", Type: "blob"}}, err: `column "n": invalid column type: blob`},
+		{columns: []*pie.Column{{Name: "n"}}, primaryKey: []string{"x"}, err: `column "x": primary key column not found`},
+		{columns: []*pie.Column{{Name: "n"}}, primaryKey: []string{"n", "n"}, err: `column "n": duplicate primary key column`},
+	} {
+		if err := db.CreateTable("foo", tt.columns, tt.primaryKey...); err == nil || err.Error() != tt.err {
+			t.Fatalf("%d. unexpected error: %v", i, err)
+		} else if _, ok := err.(*pie.SchemaError); !ok {
+			t.Fatalf("%d. unexpected error type: %#v", i, err)
+		}
+	}
+}
+
+// Ensure constraints are stored in the metadata.
+func TestDatabase_Constraints_Reopen(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "id", Unique: true}, {Name: "name", NotNull: true, Default: "x"}}, "id")
+
+	path := db.Path()
+	db.Database.Close()
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if tbl := db.Table("foo"); !reflect.DeepEqual(tbl.PrimaryKey, []string{"id"}) {
+		t.Fatalf("unexpected primary key: %v", tbl.PrimaryKey)
+	} else if !reflect.DeepEqual(tbl.Columns, []*pie.Column{{Name: "id", Unique: true}, {Name: "name", NotNull: true, Default: "x"}}) {
+		t.Fatalf("unexpected columns: %#v", tbl.Columns)
+	} else if err := db.SetTableRows("foo", [][]string{{"1", ""}, {"1", "y"}}); err == nil || err.Error() != `row 2, column "id": duplicate value "1", also in row 1` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -2,45 +2,352 @@ package pie
 
 import (
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 )
 
+// DefaultSampleSize is the default number of rows used to infer column types.
+const DefaultSampleSize = 100
+
+// DefaultBatchSize is the default number of rows written to disk at a time.
+const DefaultBatchSize = 1000
+
 // CSVImporter creates a table by importing from a CSV reader into a database.
-type CSVImporter struct{}
+type CSVImporter struct {
+	// Number of rows read to infer the type of each column.
+	SampleSize int
+
+	// Number of rows buffered in memory before being written to disk.
+	BatchSize int
+
+	// Optional constraints & primary key for the imported table. Declared
+	// columns replace the file's column of the same name. Column types left
+	// blank are inferred. The schema is only used when a table is created.
+	Schema *Schema
+
+	// What to do if the table already exists. Defaults to ImportFail.
+	Mode ImportMode
+}
+
+// ImportMode specifies how an import handles a table that already exists.
+type ImportMode string
+
+// Import modes.
+const (
+	ImportFail    ImportMode = "fail"    // return ErrTableExists
+	ImportReplace ImportMode = "replace" // replace the table & its rows
+	ImportAppend  ImportMode = "append"  // append rows to the table
+)
+
+// IsValid returns true if the mode is blank or a known import mode.
+func (m ImportMode) IsValid() bool {
+	switch m {
+	case "", ImportFail, ImportReplace, ImportAppend:
+		return true
+	}
+	return false
+}
 
 // NewCSVImporter returns a new instance of CSVImporter.
 func NewCSVImporter() *CSVImporter {
-	return &CSVImporter{}
+	return &CSVImporter{
+		SampleSize: DefaultSampleSize,
+		BatchSize:  DefaultBatchSize,
+	}
 }
 
-// Import creates a new table in the database from data in the CSV reader.
+// Import creates a new table in the database from data in the CSV reader
+// within a single transaction. Nothing is written if an error occurs.
 func (i *CSVImporter) Import(db *Database, name string, r *csv.Reader) error {
+	return db.update(func(tx *Tx) error {
+		return i.ImportTx(tx, name, r)
+	})
+}
+
+// ImportTx creates a new table within a transaction from data in the CSV
+// reader. Column types are inferred from a sample of the rows. Remaining rows
+// are written to disk in batches as they are read. Returns an *ImportError if
+// any value doesn't match its column's type or violates a constraint.
+//
+// If the table exists then it's replaced or appended to depending on the
+// import mode. A new table is removed on error but replaced & appended
+// tables are only restored once the transaction is rolled back.
+func (i *CSVImporter) ImportTx(tx *Tx, name string, r *csv.Reader) error {
+	if !i.Mode.IsValid() {
+		return fmt.Errorf("invalid import mode: %q", i.Mode)
+	}
+
 	// Read CSV headers.
 	record, err := r.Read()
 	if err != nil {
 		return err
 	}
 
+	// Handle an existing table according to the import mode.
+	if t := tx.Table(name); t != nil {
+		switch i.Mode {
+		case ImportAppend:
+			return i.appendRows(tx, t, record, &importReader{r: r})
+		case ImportReplace:
+			if err := tx.DeleteTable(name); err != nil {
+				return err
+			}
+		default:
+			return ErrTableExists
+		}
+	}
+
 	// Create columns from headers.
 	var columns []*Column
 	for _, name := range record {
 		columns = append(columns, &Column{Name: name})
 	}
 
-	// Create table in database.
-	if err := db.CreateTable(name, columns); err != nil {
-		return err
+	// Apply the declared schema to the columns of the same name.
+	var primaryKey []string
+	if i.Schema != nil {
+		for _, sc := range i.Schema.Columns {
+			index := indexOfColumn(columns, sc.Name)
+			if index == -1 {
+				return &SchemaError{Column: sc.Name, Err: errors.New("column not found in file")}
+			}
+			c := *sc
+			columns[index] = &c
+		}
+		primaryKey = i.Schema.PrimaryKey
 	}
 
-	// Read remaining rows into Table.Rows.
-	rows, err := r.ReadAll()
-	if err != nil {
+	// Read a sample of the rows to infer column types from.
+	ir := &importReader{r: r}
+	var sample [][]string
+	for i.SampleSize <= 0 || len(sample) < i.SampleSize {
+		row, err := ir.read()
+		if err != nil {
+			return err
+		} else if row == nil {
+			break
+		}
+		sample = append(sample, row)
+	}
+	for index, c := range columns {
+		if c.Type == "" {
+			c.Type = inferColumnType(sample, index)
+		}
+	}
+
+	// Create table in database and write an empty data file so the table
+	// exists even without rows.
+	if err := tx.CreateTable(name, columns, primaryKey...); err != nil {
+		return err
+	} else if err := tx.SetTableRows(name, nil); err != nil {
 		return err
 	}
 
-	// Write table rows to disk.
-	if err := db.SetTableRows(name, rows); err != nil {
+	// Write rows to disk. Remove the table if any row can't be imported.
+	t := tx.Table(name)
+	if err := i.importRows(tx, t, newImportChecker(t), sample, ir); err != nil {
+		_ = tx.DeleteTable(name)
 		return err
 	}
 
 	return nil
 }
+
+// appendRows appends the rows in the reader to an existing table. The file
+// must have the same columns as the table but they can be in any order.
+// Constraints are checked against the table's existing rows.
+func (i *CSVImporter) appendRows(tx *Tx, t *Table, header []string, ir *importReader) error {
+	// Map each table column to its position in the file.
+	for _, name := range header {
+		if t.ColumnIndex(name) == -1 {
+			return &SchemaError{Column: name, Err: errors.New("column not found in table")}
+		}
+	}
+	ir.indices = make([]int, len(t.Columns))
+	for index, c := range t.Columns {
+		if ir.indices[index] = indexOf(header, c.Name); ir.indices[index] == -1 {
+			return &SchemaError{Column: c.Name, Err: errors.New("column not found in file")}
+		}
+	}
+
+	chk := newImportChecker(t)
+	if t.hasConstraints() {
+		itr, err := tx.TableRowIterator(t.Name)
+		if err != nil {
+			return err
+		}
+		err = chk.seed(itr)
+		_ = itr.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return i.importRows(tx, t, chk, nil, ir)
+}
+
+// newImportChecker returns a constraint checker that reports rows by the
+// line number they were read from.
+func newImportChecker(t *Table) *constraintChecker {
+	chk := newConstraintChecker(t)
+	chk.unit = "line"
+	return chk
+}
+
+// importRows validates the sampled rows & the remaining rows in the reader
+// against the checker and appends them to the table in batches.
+func (i *CSVImporter) importRows(tx *Tx, t *Table, chk *constraintChecker, sample [][]string, ir *importReader) error {
+	batchSize := i.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	var batch [][]string
+	for j := 0; ; j++ {
+		// Read rows from the sample first and then from the reader.
+		var row []string
+		if j < len(sample) {
+			row = sample[j]
+		} else if r, err := ir.read(); err != nil {
+			return err
+		} else {
+			row = r
+		}
+
+		// Write the current batch once it's full or there are no more rows.
+		if row == nil || len(batch) == batchSize {
+			if err := tx.appendTableRows(t.Name, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if row == nil {
+			return nil
+		}
+
+		// Fill in defaults & verify the row's constraints.
+		row, err := chk.check(row, ir.lines[j])
+		if e, ok := err.(*ConstraintError); ok {
+			return &ImportError{Line: ir.lines[j], Column: e.Column, Err: e.Err}
+		} else if err != nil {
+			return err
+		}
+
+		// Verify every value matches its column's type.
+		for index, c := range t.Columns {
+			if _, err := c.ParseValue(row[index]); err != nil {
+				return &ImportError{Line: ir.lines[j], Column: c.Name, Err: err}
+			}
+		}
+		batch = append(batch, row)
+	}
+}
+
+// indexOfColumn returns the position of a column by name.
+// Returns -1 if the column is not found.
+func indexOfColumn(columns []*Column, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOf returns the position of s in a. Returns -1 if s is not found.
+func indexOf(a []string, s string) int {
+	for i := range a {
+		if a[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// importReader reads CSV rows and records the line number of each row.
+type importReader struct {
+	r     *csv.Reader
+	lines []int
+
+	// Position in the file of each column, if the file's columns are in a
+	// different order than the table's.
+	indices []int
+}
+
+// read returns the next row. Returns nil at the end of the file.
+func (ir *importReader) read() ([]string, error) {
+	row, err := ir.r.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	line, _ := ir.r.FieldPos(0)
+	ir.lines = append(ir.lines, line)
+
+	if ir.indices != nil {
+		other := make([]string, len(ir.indices))
+		for i, index := range ir.indices {
+			other[i] = row[index]
+		}
+		row = other
+	}
+	return row, nil
+}
+
+// inferColumnType returns the narrowest type that every non-empty value in
+// the column can be parsed as. Returns TextType if there are no values or if
+// any number has a leading zero, such as a zip code or an ID.
+func inferColumnType(rows [][]string, index int) ColumnType {
+	candidates := []ColumnType{IntegerType, FloatType, BooleanType, TimestampType}
+
+	var empty = true
+	for _, row := range rows {
+		value := row[index]
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		empty = false
+
+		if hasLeadingZero(value) {
+			return TextType
+		}
+
+		// Remove candidate types that can't parse the value.
+		var a []ColumnType
+		for _, typ := range candidates {
+			c := &Column{Type: typ}
+			if _, err := c.ParseValue(value); err == nil {
+				a = append(a, typ)
+			}
+		}
+		candidates = a
+	}
+
+	// Use the narrowest remaining type.
+	if empty || len(candidates) == 0 {
+		return TextType
+	}
+	return candidates[0]
+}
+
+// hasLeadingZero returns true if the integer part of a number is written
+// with a leading zero. A single zero, such as in "0.5", isn't leading.
+func hasLeadingZero(value string) bool {
+	s := strings.TrimLeft(strings.TrimSpace(value), "+-")
+	return len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9'
+}
+
+// ImportError represents an error importing a value from a CSV file.
+type ImportError struct {
+	Line   int
+	Column string
+	Err    error
+}
+
+// Error returns the error message with the line number & column name.
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("line %d, column %q: %s", e.Line, e.Column, e.Err)
+}
@@ -2,6 +2,8 @@ package pie_test
 
 import (
 	"encoding/csv"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -36,6 +38,8 @@ bob,smith,ford
 		t.Fatal("unexpected table name(0)")
 	} else if tbl.Columns[2].Name != "company" {
 		t.Fatal("unexpected table name(0)")
+	} else if tbl.Columns[0].Type != pie.TextType {
+		t.Fatalf("unexpected column type(0): %s", tbl.Columns[0].Type)
 	}
 
 	if rows, err := db.TableRows("my_peeps"); err != nil {
@@ -48,3 +52,190 @@ bob,smith,ford
 		t.Fatalf("unexpected row(0): %#v", rows[1])
 	}
 }
+
+// Ensure the importer can infer column types from the data.
+func TestCSVImporter_Import_InferTypes(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	// Create incoming data.
+	data := strings.TrimSpace(`
+id,price,active,created_at,name,notes,zip,ratio
+1,10,true,2015-01-02,susy,,02134,0.5
+2,2.5,FALSE,2015-01-02T10:00:00Z,bob,,80202,0
+,,,,300,,,-0.25
+`)
+
+	// Import CSV data.
+	if err := pie.NewCSVImporter().Import(db.Database, "items", csv.NewReader(strings.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify column types.
+	tbl := db.Table("items")
+	for i, typ := range []pie.ColumnType{pie.IntegerType, pie.FloatType, pie.BooleanType, pie.TimestampType, pie.TextType, pie.TextType, pie.TextType, pie.FloatType} {
+		if tbl.Columns[i].Type != typ {
+			t.Errorf("unexpected column type(%d): exp=%s got=%s", i, typ, tbl.Columns[i].Type)
+		}
+	}
+}
+
+// Ensure the importer returns an error when a value doesn't match its column type.
+func TestCSVImporter_Import_ErrInvalidValue(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	// Create incoming data with an invalid value after the sample.
+	data := strings.TrimSpace(`
+name,age
+susy,10
+bob,11
+jim,twelve
+`)
+
+	// Import CSV data using a small sample.
+	i := pie.NewCSVImporter()
+	i.SampleSize = 2
+	if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader(data))); err == nil {
+		t.Fatal("expected error")
+	} else if err.Error() != `line 4, column "age": invalid integer: "twelve"` {
+		t.Fatalf("unexpected error: %s", err)
+	} else if e, ok := err.(*pie.ImportError); !ok || e.Line != 4 || e.Column != "age" {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+
+	// Verify the table wasn't created.
+	if db.Table("peeps") != nil {
+		t.Fatal("unexpected table")
+	}
+}
+
+// Ensure the importer applies a declared schema and reports constraint
+// violations by line number.
+func TestCSVImporter_Import_Schema(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	i := pie.NewCSVImporter()
+	i.SampleSize, i.BatchSize = 1, 1
+	i.Schema = &pie.Schema{
+		Columns:    []*pie.Column{{Name: "code", Type: pie.TextType}, {Name: "state", Default: "CO"}},
+		PrimaryKey: []string{"id"},
+	}
+	if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader("id,code,state\n1,01,NY\n2,02,\n"))); err != nil {
+		t.Fatal(err)
+	} else if tbl := db.Table("peeps"); !reflect.DeepEqual(tbl.Columns, []*pie.Column{
+		{Name: "id", Type: pie.IntegerType},
+		{Name: "code", Type: pie.TextType},
+		{Name: "state", Type: pie.TextType, Default: "CO"},
+	}) || !reflect.DeepEqual(tbl.PrimaryKey, []string{"id"}) {
+		t.Fatalf("unexpected table: %#v", tbl)
+	} else if rows, _ := db.TableRows("peeps"); !reflect.DeepEqual(rows, [][]string{{"1", "01", "NY"}, {"2", "02", "CO"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+
+	// Import a file with a repeated key after the first batch is written.
+	if err := i.Import(db.Database, "dups", csv.NewReader(strings.NewReader("id,code,state\n1,01,\n2,02,\n1,03,\n"))); err == nil || err.Error() != `line 4, column "id": duplicate primary key, also in line 2` {
+		t.Fatalf("unexpected error: %v", err)
+	} else if db.Table("dups") != nil {
+		t.Fatal("unexpected table")
+	}
+
+	// Import a file without a declared column.
+	i.Schema = &pie.Schema{Columns: []*pie.Column{{Name: "x"}}}
+	if err := i.Import(db.Database, "missing", csv.NewReader(strings.NewReader("id\n1\n"))); err == nil || err.Error() != `column "x": column not found in file` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the import mode controls how an existing table is handled.
+func TestCSVImporter_Import_Mode(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	i := pie.NewCSVImporter()
+	i.SampleSize, i.BatchSize = 1, 1
+	i.Schema = &pie.Schema{PrimaryKey: []string{"id"}}
+	if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader("id,name\n1,bob\n"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Importing an existing table fails by default.
+	i.Schema = nil
+	if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader("id,name\n2,susy\n"))); err != pie.ErrTableExists {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Append rows with the columns in a different order.
+	i.Mode = pie.ImportAppend
+	if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader("name,id\nsusy,2\njim,3\n"))); err != nil {
+		t.Fatal(err)
+	} else if rows, _ := db.TableRows("peeps"); !reflect.DeepEqual(rows, [][]string{{"1", "bob"}, {"2", "susy"}, {"3", "jim"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+
+	// Appended rows are checked against the existing rows and nothing is
+	// appended if any row fails.
+	for j, tt := range []struct {
+		data string
+		err  string
+	}{
+		{data: "id,name\n4,ann\n2,sam\n", err: `line 3, column "id": duplicate primary key, also in existing row 2`},
+		{data: "id\n4\n", err: `column "name": column not found in file`},
+		{data: "id,name,age\n4,ann,20\n", err: `column "age": column not found in table`},
+	} {
+		if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader(tt.data))); err == nil || err.Error() != tt.err {
+			t.Fatalf("%d. unexpected error: %v", j, err)
+		} else if rows, _ := db.TableRows("peeps"); len(rows) != 3 {
+			t.Fatalf("%d. unexpected row count: %d", j, len(rows))
+		}
+	}
+
+	// Replace the table & its schema.
+	i.Mode = pie.ImportReplace
+	if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader("state\nCO\n"))); err != nil {
+		t.Fatal(err)
+	} else if tbl := db.Table("peeps"); len(tbl.Columns) != 1 || tbl.PrimaryKey != nil {
+		t.Fatalf("unexpected table: %#v", tbl)
+	} else if rows, _ := db.TableRows("peeps"); !reflect.DeepEqual(rows, [][]string{{"CO"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+
+	// Replacing a missing table creates it.
+	if err := i.Import(db.Database, "new", csv.NewReader(strings.NewReader("a\n1\n"))); err != nil {
+		t.Fatal(err)
+	} else if db.Table("new") == nil {
+		t.Fatal("expected table")
+	}
+
+	i.Mode = "merge"
+	if err := i.Import(db.Database, "peeps", csv.NewReader(strings.NewReader("state\nCO\n"))); err == nil || err.Error() != `invalid import mode: "merge"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the importer writes rows in batches and removes the table if a
+// later batch fails.
+func TestCSVImporter_Import_Batches(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	i := pie.NewCSVImporter()
+	i.SampleSize, i.BatchSize = 1, 2
+	if err := i.Import(db.Database, "nums", csv.NewReader(strings.NewReader("n\n1\n2\n3\n4\n5\n"))); err != nil {
+		t.Fatal(err)
+	} else if rows, err := db.TableRows("nums"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"5"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+
+	// Import a file with an invalid value after the first batch is written.
+	if err := i.Import(db.Database, "bad", csv.NewReader(strings.NewReader("n\n1\n2\n3\nx\n"))); err == nil || err.Error() != `line 5, column "n": invalid integer: "x"` {
+		t.Fatalf("unexpected error: %v", err)
+	} else if db.Table("bad") != nil {
+		t.Fatal("unexpected table")
+	} else if _, err := os.Stat(filepath.Join(db.Path(), "data", "bad")); !os.IsNotExist(err) {
+		t.Fatalf("expected data file to be removed: %v", err)
+	}
+}
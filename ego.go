@@ -47,7 +47,7 @@ func TableIndex(w io.Writer, tables []*Table) error {
 }
 
 //line show.ego:1
-func TableShow(w io.Writer, t *Table, rows [][]string) error {
+func TableShow(w io.Writer, t *Table, itr RowIterator) error {
 //line show.ego:2
 	_, _ = fmt.Fprintf(w, "\n\n<html>\n<head>\n  <title>pie : ")
 //line show.ego:5
@@ -71,24 +71,36 @@ func TableShow(w io.Writer, t *Table, rows [][]string) error {
 //line show.ego:16
 	_, _ = fmt.Fprintf(w, "\n\t\t</tr>\n\n\t\t")
 //line show.ego:18
-	for _, row := range rows {
+	for {
 //line show.ego:19
-		_, _ = fmt.Fprintf(w, "\n\t\t\t<tr>\n\t\t\t\t")
+		_, _ = fmt.Fprintf(w, "\n\t\t\t")
+//line show.ego:19
+		row, err := itr.Next()
 //line show.ego:20
-		for _, value := range row {
+		_, _ = fmt.Fprintf(w, "\n\t\t\t")
+//line show.ego:20
+		if err != nil {
+			return err
+		} else if row == nil {
+			break
+		}
 //line show.ego:21
+		_, _ = fmt.Fprintf(w, "\n\t\t\t<tr>\n\t\t\t\t")
+//line show.ego:22
+		for _, value := range row {
+//line show.ego:23
 			_, _ = fmt.Fprintf(w, "\n\t\t\t\t\t<td>")
-//line show.ego:21
+//line show.ego:23
 			_, _ = fmt.Fprintf(w, "%v", value)
-//line show.ego:21
+//line show.ego:23
 			_, _ = fmt.Fprintf(w, "</td>\n\t\t\t\t")
-//line show.ego:22
+//line show.ego:24
 		}
-//line show.ego:23
+//line show.ego:25
 		_, _ = fmt.Fprintf(w, "\n\t\t\t</tr>\n\t\t")
-//line show.ego:24
+//line show.ego:26
 	}
-//line show.ego:25
+//line show.ego:27
 	_, _ = fmt.Fprintf(w, "\n\t</table>\n</body>\n</html>\n\n")
 	return nil
 }
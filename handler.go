@@ -1,23 +1,44 @@
 package pie
 
 import (
+	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"mime"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/turingschool-examples/pie/assets"
 	"github.com/turingschool-examples/pie/pieql"
 )
 
+// DefaultFlushInterval is the default time that streamed query results are
+// buffered before being flushed to the client.
+const DefaultFlushInterval = 100 * time.Millisecond
+
+// QueryTimeoutHeader is the request header that sets a timeout for a query,
+// such as "30s". The handler's query timeout can't be extended by the header.
+const QueryTimeoutHeader = "X-Query-Timeout"
+
 // Handler represents the HTTP handler.
 type Handler struct {
 	db  *Database
 	mux *mux.Router
+
+	// Maximum time that streamed query results are buffered.
+	FlushInterval time.Duration
+
+	// Maximum time a query can run. No limit if zero.
+	QueryTimeout time.Duration
 }
 
 // NewHandler returns a new instance of Handler associated with a database.
@@ -26,6 +47,8 @@ func NewHandler(db *Database) *Handler {
 	h := &Handler{
 		db:  db,
 		mux: mux.NewRouter(),
+
+		FlushInterval: DefaultFlushInterval,
 	}
 
 	// Setup request multiplexer.
@@ -34,7 +57,10 @@ func NewHandler(db *Database) *Handler {
 	h.mux.HandleFunc("/tables", h.serveTables).Methods("GET")
 	h.mux.HandleFunc("/tables", h.serveCreateTable).Methods("POST")
 	h.mux.HandleFunc("/tables/{name}", h.serveTable).Methods("GET")
+	h.mux.HandleFunc("/tables/{name}", h.serveDeleteTable).Methods("DELETE")
+	h.mux.HandleFunc("/tables/{name}", h.serveRenameTable).Methods("PATCH")
 	h.mux.HandleFunc("/query", h.serveQuery).Methods("POST")
+	h.registerAPI()
 
 	return h
 }
@@ -70,7 +96,14 @@ func (h *Handler) serveAsset(w http.ResponseWriter, r *http.Request) {
 
 // serveTables processes a request to list tables in the database.
 func (h *Handler) serveTables(w http.ResponseWriter, r *http.Request) {
-	TableIndex(w, h.db.Tables())
+	tx, err := h.db.Begin(false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	TableIndex(w, tx.Tables())
 }
 
 // serveTable serves the contents of the table.
@@ -78,25 +111,55 @@ func (h *Handler) serveTable(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
+	// Read the table & its rows from the same snapshot.
+	tx, err := h.db.Begin(false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	// Find table and return error if it doesn't exist.
-	t := h.db.Table(name)
+	t := tx.Table(name)
 	if t == nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	// Retrieve rows.
-	rows, err := h.db.TableRows(name)
+	// Open a cursor over the rows.
+	itr, err := tx.TableRowIterator(name)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer itr.Close()
+
+	// Render the table as rows are read.
+	if err := TableShow(w, t, itr); err != nil {
+		warn("render table:", err)
+	}
+}
+
+// serveDeleteTable processes a request to delete a table from the database.
+func (h *Handler) serveDeleteTable(w http.ResponseWriter, r *http.Request) {
+	if err := h.db.DeleteTable(mux.Vars(r)["name"]); err != nil {
+		writeError(w, err)
+		return
+	}
+}
 
-	// Render the table.
-	TableShow(w, t, rows)
+// serveRenameTable processes a request to rename a table. The new name is
+// read from the "name" form value.
+func (h *Handler) serveRenameTable(w http.ResponseWriter, r *http.Request) {
+	if err := h.db.RenameTable(mux.Vars(r)["name"], r.FormValue("name")); err != nil {
+		writeError(w, err)
+		return
+	}
 }
 
 // serveCreateTable processes a request to create a table in the database.
+// The "mode" form value controls whether an existing table with the same
+// name is replaced, appended to or causes the request to fail.
 func (h *Handler) serveCreateTable(w http.ResponseWriter, r *http.Request) {
 	// Check for file in request body.
 	f, hdr, err := r.FormFile("file")
@@ -106,46 +169,361 @@ func (h *Handler) serveCreateTable(w http.ResponseWriter, r *http.Request) {
 	}
 	defer f.Close()
 
+	mode := ImportMode(r.FormValue("mode"))
+	if !mode.IsValid() {
+		http.Error(w, fmt.Sprintf("invalid mode: %q", mode), http.StatusBadRequest)
+		return
+	}
+
 	// Extract the filename.
 	name := hdr.Filename
 	if ext := path.Ext(name); ext != "" {
 		name = name[0 : len(name)-len(ext)]
 	}
 
-	// Import file as CSV.
+	// Read the optional schema declaring constraints & a primary key.
+	schema, err := readSchema(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Import file as CSV within a single transaction.
 	i := NewCSVImporter()
+	i.Schema = schema
+	i.Mode = mode
 	if err := i.Import(h.db, name, csv.NewReader(f)); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err)
 		return
 	}
 }
 
-// serveQuery executes a query against the database.
+// readSchema decodes the JSON schema from the "schema" part of an upload
+// form. The schema can be sent as a file or as a value. Returns nil if the
+// form has no schema.
+func readSchema(r *http.Request) (*Schema, error) {
+	data := []byte(r.FormValue("schema"))
+	if f, _, err := r.FormFile("schema"); err == nil {
+		defer f.Close()
+		if data, err = ioutil.ReadAll(f); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %s", err)
+	}
+	return &schema, nil
+}
+
+// serveQuery executes one or more statements against the database.
+// The results of each statement are written in the format named by the
+// "format" parameter or the Accept header. Defaults to CSV.
+//
+// Results of read-only scripts are streamed as rows are read and execution
+// stops if the client disconnects or the query times out. Scripts that change
+// the database are committed before any results are written.
 func (h *Handler) serveQuery(w http.ResponseWriter, r *http.Request) {
-	// Parse the statement.
-	stmt, err := pieql.NewParser(r.Body).Parse()
+	// Determine the output format before executing anything.
+	f := FormatCSV
+	if s := r.URL.Query().Get("format"); s != "" {
+		if f = Format(s); !f.IsValid() {
+			http.Error(w, fmt.Sprintf("invalid format: %q", s), http.StatusBadRequest)
+			return
+		}
+	} else if accept := r.Header.Get("Accept"); accept != "" {
+		if f = acceptFormat(accept); f == "" {
+			http.Error(w, "no acceptable format", http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	ctx, cancel, err := h.queryContext(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	defer cancel()
 
-	// Execute the statement.
-	res, err := h.db.Execute(stmt)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Parse the statements. Parse errors are returned as JSON so that
+	// clients can report the position of the error.
+	stmts, err := pieql.NewParser(r.Body).ParseStatementsContext(ctx)
+	if e, ok := err.(*pieql.ParseError); ok {
+		writeParseError(w, e)
+		return
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		writeQueryError(w, err)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Build header from fields.
-	hdr := make([]string, len(stmt.Fields))
-	for i, f := range stmt.Fields {
-		hdr[i] = f.Name
+	// Write the results of statements that return columns.
+	w.Header().Set("Content-Type", f.ContentType())
+	fw := &flushWriter{w: w, interval: h.FlushInterval}
+	rw, _ := NewResultWriter(fw, f)
+	nestResults(rw, len(stmts))
+
+	// Execute the statements within a single transaction.
+	if !isReadScript(stmts) {
+		results, err := h.executeStatements(ctx, stmts)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		if err := WriteResults(rw, results); err != nil {
+			warn("write results:", err)
+		}
+		return
+	}
+
+	// Report errors with a status code unless output has already been sent.
+	// Otherwise the response is aborted so the client doesn't mistake a
+	// partial result for a complete one. Nothing is reported to a client
+	// that has disconnected.
+	if err := h.streamStatements(ctx, fw, rw, stmts); r.Context().Err() != nil {
+		return
+	} else if err != nil && !fw.written {
+		writeQueryError(w, err)
+	} else if err != nil {
+		warn("stream results:", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// queryContext returns the context for executing a request's query. The
+// context is canceled if the client disconnects or the query times out.
+// Returns an error if the timeout header is invalid.
+func (h *Handler) queryContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout := h.QueryTimeout
+	if s := r.Header.Get(QueryTimeoutHeader); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return nil, nil, fmt.Errorf("invalid %s header: %q", QueryTimeoutHeader, s)
+		} else if timeout == 0 || d < timeout {
+			timeout = d
+		}
+	}
+
+	if timeout == 0 {
+		ctx, cancel := context.WithCancel(r.Context())
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, nil
+}
+
+// streamStatements executes read-only statements within a single transaction
+// and writes the rows of each result as they're read. Output is flushed
+// periodically. Returns the context's error if it's done.
+func (h *Handler) streamStatements(ctx context.Context, fw *flushWriter, rw ResultWriter, stmts pieql.Statements) error {
+	tx, err := h.db.BeginContext(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range stmts {
+		if err := streamStatement(ctx, tx, fw, rw, stmt); err != nil {
+			return err
+		}
+	}
+	return rw.Close()
+}
+
+// streamStatement writes the rows of a statement's result as they're read.
+func streamStatement(ctx context.Context, tx *Tx, fw *flushWriter, rw ResultWriter, stmt pieql.Statement) error {
+	cur, err := tx.Query(stmt)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cur.Close() }()
+
+	if len(cur.Columns) == 0 {
+		return nil
+	} else if err := rw.WriteHeader(cur.Columns); err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row, err := cur.Next()
+		if err != nil {
+			return err
+		} else if row == nil {
+			return nil
+		} else if err := rw.WriteRow(row); err != nil {
+			return err
+		}
+
+		if fw.due() {
+			if err := rw.Flush(); err != nil {
+				return err
+			}
+			fw.Flush()
+		}
+	}
+}
+
+// acceptFormat returns the output format most preferred by an Accept header.
+// Formats are preferred by quality and then by their order in the header.
+// Returns a blank format if no format is acceptable.
+func acceptFormat(accept string) Format {
+	var f Format
+	best := 0.0
+	for _, s := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if other := formatForMediaRange(typ); other != "" && q > best {
+			f, best = other, q
+		}
+	}
+	return f
+}
+
+// formatForMediaRange returns the first output format matching a media type
+// or a range of types such as "text/*". Any type matches CSV.
+func formatForMediaRange(typ string) Format {
+	if typ == "*/*" {
+		return FormatCSV
+	} else if !strings.HasSuffix(typ, "/*") {
+		return FormatForContentType(typ)
 	}
 
-	// Write the results.
-	cw := csv.NewWriter(w)
-	cw.Write(hdr)
-	cw.WriteAll(res)
+	prefix := strings.TrimSuffix(typ, "*")
+	for _, a := range formats {
+		if strings.HasPrefix(a.contentType, prefix) {
+			return a.format
+		}
+	}
+	return ""
+}
+
+// executeStatements executes the statements within a single transaction and
+// returns the result of each. Changes are only committed if every statement
+// succeeds before the context is done.
+func (h *Handler) executeStatements(ctx context.Context, stmts pieql.Statements) ([]*Result, error) {
+	writable := !isReadScript(stmts)
+	tx, err := h.db.BeginContext(ctx, writable)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var results []*Result
+	for _, stmt := range stmts {
+		res, err := tx.Execute(stmt)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	if writable {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// isReadScript returns true if none of the statements change the database.
+func isReadScript(stmts pieql.Statements) bool {
+	for _, stmt := range stmts {
+		if !isReadStatement(stmt) {
+			return false
+		}
+	}
+	return true
+}
+
+// flushWriter writes to a response and records whether anything was written.
+type flushWriter struct {
+	w        http.ResponseWriter
+	interval time.Duration
+	written  bool
+	last     time.Time // time of the last flush
+}
+
+// Write writes p to the response.
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.written = true
+	return fw.w.Write(p)
+}
+
+// due returns true if the flush interval has passed since the last flush.
+func (fw *flushWriter) due() bool {
+	return time.Since(fw.last) >= fw.interval
+}
+
+// Flush sends any buffered data to the client.
+func (fw *flushWriter) Flush() {
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	fw.last = time.Now()
+}
+
+// writeQueryError writes an error from executing a query. Timeouts are
+// reported as the service being unavailable. Other errors use the status
+// code of their API error code.
+func writeQueryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, errQueryTimeout.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeError(w, err)
+}
+
+// errQueryTimeout is reported when a query runs past its timeout.
+var errQueryTimeout = errors.New("query timeout exceeded")
+
+// writeError writes the error message with the status code of its API error
+// code. Invalid data & schemas are reported as a client error.
+func writeError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), newAPIError(err).status())
+}
+
+// writeParseError writes a parse error to the response as JSON.
+func writeParseError(w http.ResponseWriter, err *pieql.ParseError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(&parseErrorJSON{
+		Error:    err.Error(),
+		Message:  err.Message,
+		Found:    err.Found,
+		Expected: err.Expected,
+		Offset:   err.Pos.Offset,
+		Line:     err.Pos.Line,
+		Column:   err.Pos.Column,
+	})
+}
+
+// parseErrorJSON represents the JSON encoding of a parse error.
+type parseErrorJSON struct {
+	Error    string   `json:"error"`
+	Message  string   `json:"message,omitempty"`
+	Found    string   `json:"found"`
+	Expected []string `json:"expected,omitempty"`
+	Offset   int      `json:"offset"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
 }
 
 func warn(v ...interface{})              { fmt.Fprintln(os.Stderr, v...) }
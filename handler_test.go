@@ -2,22 +2,28 @@ package pie_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/turingschool-examples/pie"
 )
 
 // Ensure we can retrieve a list of tables through the HTTP interface.
 func TestHandler_Tables(t *testing.T) {
-	db := pie.NewDatabase()
-	h := pie.NewHandler(db)
+	db := OpenMemDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
 	w := httptest.NewRecorder()
 
 	// Create tables.
@@ -30,7 +36,7 @@ func TestHandler_Tables(t *testing.T) {
 
 	// Verify the request was successful.
 	if w.Code != http.StatusOK {
-		t.Fatalf("unexpected status: %d", w)
+		t.Fatalf("unexpected status: %d", w.Code)
 	} else if !strings.Contains(w.Body.String(), `<li><a href="/tables/bob">bob</a></li>`) {
 		t.Fatalf("table 'bob' not found")
 	} else if !strings.Contains(w.Body.String(), `<li><a href="/tables/susy">susy</a></li>`) {
@@ -38,6 +44,25 @@ func TestHandler_Tables(t *testing.T) {
 	}
 }
 
+// Ensure we can view the rows of a table through the HTTP interface.
+func TestHandler_Table(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"susy"}, {"bob"}})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/tables/foo", nil)
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if body := w.Body.String(); strings.Count(body, "<tr>") != 3 || !strings.Contains(body, "<td>susy</td>") || !strings.Contains(body, "<td>bob</td>") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
+
 // Ensure we can create a table through the HTTP interface.
 func TestHandler_CreateTable(t *testing.T) {
 	db := OpenDatabase()
@@ -76,5 +101,433 @@ func TestHandler_CreateTable(t *testing.T) {
 	}
 }
 
+// Ensure an upload can declare constraints in a schema part.
+func TestHandler_CreateTable_Schema(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+
+	for i, tt := range []struct {
+		filename string
+		data     string
+		schema   string
+		code     int
+		body     string
+	}{
+		{filename: "a.csv", data: "id,name\n1,bob\n1,susy\n", schema: `{"columns":[{"name":"id","unique":true}]}`, code: http.StatusBadRequest, body: "line 3, column \"id\": duplicate value \"1\", also in line 2\n"},
+		{filename: "b.csv", data: "id,name\n1,bob\n", schema: `{"primary_key":["x"]}`, code: http.StatusBadRequest, body: "column \"x\": primary key column not found\n"},
+		{filename: "c.csv", data: "id,name\n1,bob\n", schema: `{`, code: http.StatusBadRequest, body: "invalid schema: unexpected end of JSON input\n"},
+		{filename: "d.csv", data: "id,name\n1,bob\n2,susy\n", schema: `{"primary_key":["id"]}`, code: http.StatusOK},
+	} {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, _ := w.CreateFormFile("file", tt.filename)
+		fmt.Fprint(part, tt.data)
+		w.WriteField("schema", tt.schema)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/tables", &buf)
+		r.Header.Set("Content-Type", w.FormDataContentType())
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, rec.Code)
+		} else if rec.Body.String() != tt.body {
+			t.Fatalf("%d. unexpected body: %q", i, rec.Body.String())
+		}
+	}
+
+	if tbl := db.Table("d"); tbl == nil || len(tbl.PrimaryKey) != 1 {
+		t.Fatalf("unexpected table: %#v", tbl)
+	} else if db.Table("a") != nil {
+		t.Fatal("unexpected table")
+	}
+}
+
+// Ensure an upload can replace or append to an existing table.
+func TestHandler_CreateTable_Mode(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+
+	for i, tt := range []struct {
+		mode string
+		data string
+		code int
+		body string
+		rows [][]string
+	}{
+		{mode: "", data: "name\nbob\n", code: http.StatusOK, rows: [][]string{{"bob"}}},
+		{mode: "fail", data: "name\nsusy\n", code: http.StatusConflict, body: "table already exists\n", rows: [][]string{{"bob"}}},
+		{mode: "append", data: "name\nsusy\n", code: http.StatusOK, rows: [][]string{{"bob"}, {"susy"}}},
+		{mode: "replace", data: "name\njim\n", code: http.StatusOK, rows: [][]string{{"jim"}}},
+		{mode: "merge", data: "name\nann\n", code: http.StatusBadRequest, body: "invalid mode: \"merge\"\n", rows: [][]string{{"jim"}}},
+	} {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		part, _ := w.CreateFormFile("file", "names.csv")
+		fmt.Fprint(part, tt.data)
+		w.WriteField("mode", tt.mode)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/tables", &buf)
+		r.Header.Set("Content-Type", w.FormDataContentType())
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, rec.Code)
+		} else if rec.Body.String() != tt.body {
+			t.Fatalf("%d. unexpected body: %q", i, rec.Body.String())
+		} else if rows, _ := db.TableRows("names"); !reflect.DeepEqual(rows, tt.rows) {
+			t.Fatalf("%d. unexpected rows: %#v", i, rows)
+		}
+	}
+}
+
+// Ensure we can delete a table through the HTTP interface.
+func TestHandler_DeleteTable(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", nil)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("DELETE", "/tables/foo", nil)
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if db.Table("foo") != nil {
+		t.Fatal("unexpected table")
+	}
+
+	// Deleting the table again returns not found.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Body.String() != "table not found\n" {
+		t.Fatalf("unexpected body: %q", w.Body.String())
+	}
+}
+
+// Ensure we can rename a table through the HTTP interface.
+func TestHandler_RenameTable(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", nil)
+	db.CreateTable("baz", nil)
+
+	for i, tt := range []struct {
+		url  string
+		name string
+		code int
+		body string
+	}{
+		{url: "/tables/foo", name: "bar", code: http.StatusOK},
+		{url: "/tables/foo", name: "qux", code: http.StatusNotFound, body: "table not found\n"},
+		{url: "/tables/bar", name: "baz", code: http.StatusConflict, body: "table already exists\n"},
+		{url: "/tables/bar", name: "", code: http.StatusBadRequest, body: "table name required\n"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("PATCH", tt.url, strings.NewReader(url.Values{"name": {tt.name}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, w.Code)
+		} else if w.Body.String() != tt.body {
+			t.Fatalf("%d. unexpected body: %q", i, w.Body.String())
+		}
+	}
+
+	if db.Table("bar") == nil || db.Table("foo") != nil {
+		t.Fatal("table not renamed")
+	}
+}
+
+// Ensure we can execute a query through the HTTP interface.
+func TestHandler_Query(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}, {Name: "state"}})
+	db.SetTableRows("foo", [][]string{{"susy", "CO"}, {"bob", "NY"}, {"jim", "CO"}})
+
+	// Execute query.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/query", strings.NewReader(`SELECT state, count(*), count(*) * 10 AS score FROM foo GROUP BY state`))
+	h.ServeHTTP(w, r)
+
+	// Verify the header uses the computed field names & aliases.
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Body.String() != "state,count(*),score\nCO,2,20\nNY,1,10\n" {
+		t.Fatalf("unexpected body: %q", w.Body.String())
+	}
+}
+
+// Ensure we can execute a multi-statement script through the HTTP interface.
+func TestHandler_Query_Script(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+
+	// Execute script.
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/query", strings.NewReader(`CREATE TABLE foo (a integer); CREATE TABLE bar (b); SHOW TABLES; DESCRIBE foo; INSERT INTO foo VALUES (1), (2);`))
+	h.ServeHTTP(w, r)
+
+	// Verify only statements with results are written.
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Body.String() != "name\nbar\nfoo\n\nname,type\na,integer\n\nrows_affected\n2\n" {
+		t.Fatalf("unexpected body: %q", w.Body.String())
+	}
+}
+
+// Ensure query results are written in the format requested.
+func TestHandler_Query_Format(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"bob"}})
+
+	for i, tt := range []struct {
+		url    string
+		accept string
+		code   int
+		typ    string
+		body   string
+	}{
+		{url: "/query", code: http.StatusOK, typ: "text/csv", body: "name\nbob\n"},
+		{url: "/query?format=ndjson", code: http.StatusOK, typ: "application/x-ndjson", body: "{\"name\":\"bob\"}\n"},
+		{url: "/query?format=markdown", accept: "text/html", code: http.StatusOK, typ: "text/markdown", body: "| name |\n| --- |\n| bob |\n"},
+		{url: "/query", accept: "text/html;q=0.5, application/json", code: http.StatusOK, typ: "application/json", body: "[\n{\"name\":\"bob\"}\n]\n"},
+		{url: "/query", accept: "image/png, text/*;q=0.8", code: http.StatusOK, typ: "text/csv", body: "name\nbob\n"},
+		{url: "/query", accept: "*/*", code: http.StatusOK, typ: "text/csv", body: "name\nbob\n"},
+		{url: "/query", accept: "image/png", code: http.StatusNotAcceptable, body: "no acceptable format\n"},
+		{url: "/query?format=yaml", code: http.StatusBadRequest, body: "invalid format: \"yaml\"\n"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", tt.url, strings.NewReader(`SELECT name FROM foo`))
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, w.Code)
+		} else if typ := w.Header().Get("Content-Type"); tt.typ != "" && typ != tt.typ {
+			t.Fatalf("%d. unexpected content type: %s", i, typ)
+		} else if w.Body.String() != tt.body {
+			t.Fatalf("%d. unexpected body: %q", i, w.Body.String())
+		}
+	}
+}
+
+// Ensure the JSON results of a multi-statement script form a single document.
+func TestHandler_Query_JSON_Multi(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"bob"}, {"susy"}})
+
+	for i, tt := range []struct {
+		body string
+		exp  [][]map[string]string
+	}{
+		{body: `SELECT name FROM foo; SELECT name FROM foo WHERE name = 'bob'`, exp: [][]map[string]string{{{"name": "bob"}, {"name": "susy"}}, {{"name": "bob"}}}},
+		{body: `SELECT name FROM foo WHERE name = 'x'; SELECT name FROM foo`, exp: [][]map[string]string{{}, {{"name": "bob"}, {"name": "susy"}}}},
+		{body: `CREATE TABLE bar (id); SELECT name FROM foo WHERE name = 'susy'`, exp: [][]map[string]string{{{"name": "susy"}}}},
+		{body: `CREATE TABLE baz (id); DROP TABLE baz`, exp: [][]map[string]string{}},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/query?format=json", strings.NewReader(tt.body))
+		h.ServeHTTP(w, r)
+
+		var results [][]map[string]string
+		if w.Code != http.StatusOK {
+			t.Fatalf("%d. unexpected status: %d: %s", i, w.Code, w.Body.String())
+		} else if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+			t.Fatalf("%d. invalid json: %s: %q", i, err, w.Body.String())
+		} else if !reflect.DeepEqual(results, tt.exp) {
+			t.Fatalf("%d. unexpected results: %#v", i, results)
+		}
+	}
+}
+
+// Ensure query results are streamed and flushed as rows are read.
+func TestHandler_Query_Stream(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	h.FlushInterval = 0
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"susy"}, {"bob"}, {"jim"}})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/query", strings.NewReader(`SELECT name FROM foo; SELECT count(*) FROM foo`))
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if !w.Flushed {
+		t.Fatal("expected flush")
+	} else if w.Body.String() != "name\nsusy\nbob\njim\n\ncount(*)\n3\n" {
+		t.Fatalf("unexpected body: %q", w.Body.String())
+	}
+
+	// Errors before any rows are written are reported with a status code.
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/query", strings.NewReader(`SELECT name FROM bar`))
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Body.String() != "table not found\n" {
+		t.Fatalf("unexpected body: %q", w.Body.String())
+	}
+}
+
+// Ensure a streamed query stops once the client disconnects.
+func TestHandler_Query_Stream_Cancel(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	h.FlushInterval = 0
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"susy"}, {"bob"}, {"jim"}})
+
+	// Cancel the request once the first row is flushed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelRecorder{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	r, _ := http.NewRequest("POST", "/query", strings.NewReader(`SELECT name FROM foo`))
+	h.ServeHTTP(w, r.WithContext(ctx))
+
+	if w.Body.String() != "name\nsusy\n" {
+		t.Fatalf("unexpected body: %q", w.Body.String())
+	}
+}
+
+// cancelRecorder cancels a context when the response is flushed.
+type cancelRecorder struct {
+	*httptest.ResponseRecorder
+	cancel func()
+}
+
+// Flush flushes the recorder and cancels the context.
+func (w *cancelRecorder) Flush() {
+	w.ResponseRecorder.Flush()
+	w.cancel()
+}
+
+// Ensure queries are stopped once they time out.
+func TestHandler_Query_Timeout(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+
+	for i, tt := range []struct {
+		timeout time.Duration
+		header  string
+		query   string
+		code    int
+		body    string
+	}{
+		{header: "1h", query: `SELECT name FROM foo`, code: http.StatusOK, body: "name\n"},
+		{header: "1ns", query: `SELECT name FROM foo`, code: http.StatusServiceUnavailable, body: "query timeout exceeded\n"},
+		{timeout: time.Nanosecond, header: "1h", query: `INSERT INTO foo VALUES ('bob')`, code: http.StatusServiceUnavailable, body: "query timeout exceeded\n"},
+		{header: "soon", query: `SELECT name FROM foo`, code: http.StatusBadRequest, body: "invalid X-Query-Timeout header: \"soon\"\n"},
+	} {
+		h.QueryTimeout = tt.timeout
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/query", strings.NewReader(tt.query))
+		r.Header.Set(pie.QueryTimeoutHeader, tt.header)
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%d. unexpected status: %d", i, w.Code)
+		} else if w.Body.String() != tt.body {
+			t.Fatalf("%d. unexpected body: %q", i, w.Body.String())
+		}
+	}
+
+	if rows, _ := db.TableRows("foo"); len(rows) != 0 {
+		t.Fatalf("unexpected row count: %d", len(rows))
+	}
+}
+
+// Ensure EXPLAIN can be executed through the HTTP interface.
+func TestHandler_Query_Explain(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/query", strings.NewReader(`EXPLAIN SELECT name FROM foo WHERE name = 'a'`))
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Body.String() != "id,parent,operator,detail\n1,,project,name\n2,1,filter,name = 'a'\n3,2,scan,foo; columns: name; condition: name = 'a'\n" {
+		t.Fatalf("unexpected body: %q", w.Body.String())
+	}
+}
+
+// Ensure query parse errors are returned as JSON with their position.
+func TestHandler_Query_ParseError(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/query", strings.NewReader("SHOW TABLES;\nSELECT ! FROM foo"))
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if typ := w.Header().Get("Content-Type"); typ != "application/json" {
+		t.Fatalf("unexpected content type: %s", typ)
+	} else if w.Body.String() != `{"error":"found \"!\", expected expression at line 2, column 8","found":"!","expected":["expression"],"offset":20,"line":2,"column":8}`+"\n" {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	}
+}
+
+// Ensure query errors caused by the request return a client error status.
+func TestHandler_Query_Err(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	h := pie.NewHandler(db.Database)
+	db.CreateTable("foo", []*pie.Column{{Name: "n", Type: pie.IntegerType}})
+
+	for i, tt := range []struct {
+		q    string
+		code int
+		body string
+	}{
+		{q: `SELECT * FROM nope`, code: http.StatusNotFound, body: "table not found\n"},
+		{q: `SELECT bogus FROM foo`, code: http.StatusBadRequest, body: "column not found: bogus\n"},
+		{q: `INSERT INTO foo VALUES ('x')`, code: http.StatusBadRequest, body: "row 1: column \"n\": invalid integer: \"x\"\n"},
+		{q: `CREATE TABLE foo (n)`, code: http.StatusConflict, body: "table already exists\n"},
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/query", strings.NewReader(tt.q))
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%d. %s: unexpected status: %d", i, tt.q, w.Code)
+		} else if w.Body.String() != tt.body {
+			t.Fatalf("%d. %s: unexpected body: %q", i, tt.q, w.Body.String())
+		}
+	}
+}
+
 func warn(v ...interface{})              { fmt.Fprintln(os.Stderr, v...) }
 func warnf(msg string, v ...interface{}) { fmt.Fprintf(os.Stderr, msg+"\n", v...) }
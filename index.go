@@ -0,0 +1,441 @@
+package pie
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+var (
+	// ErrIndexNameRequired is returned when a blank index name is passed in.
+	ErrIndexNameRequired = errors.New("index name required")
+
+	// ErrInvalidIndexName is returned when an index name can't be used as the
+	// name of a file.
+	ErrInvalidIndexName = errors.New("invalid index name")
+
+	// ErrIndexExists is returned when creating an index that already exists.
+	ErrIndexExists = errors.New("index already exists")
+)
+
+// IndexDefinition represents a sorted index on one of a table's columns.
+type IndexDefinition struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`
+}
+
+// IndexData represents the entries of an index. Each distinct cell in the
+// column has an entry with the positions of the rows holding it. Entries are
+// sorted by the cell's value. Empty cells in typed columns aren't indexed.
+type IndexData struct {
+	// Version of the table's rows the index was built from.
+	Version int `json:"version"`
+
+	// Number of rows in the table when the index was built.
+	N int `json:"n"`
+
+	Entries []*IndexEntry `json:"-"`
+}
+
+// IndexEntry represents the positions of the rows holding a cell.
+// Rows are numbered from zero in the order they are stored.
+type IndexEntry struct {
+	Value string `json:"value"`
+	Rows  []int  `json:"rows"`
+}
+
+// CreateIndex creates a sorted index on a table's column within its own
+// transaction.
+func (db *Database) CreateIndex(table, name, column string) error {
+	return db.update(func(tx *Tx) error {
+		return tx.CreateIndex(table, name, column)
+	})
+}
+
+// CreateIndex creates a sorted index on a table's column. The index is
+// built when the transaction commits.
+func (tx *Tx) CreateIndex(table, name, column string) error {
+	if err := tx.checkWritable(); err != nil {
+		return err
+	} else if name == "" {
+		return ErrIndexNameRequired
+	} else if !isFileName(name) {
+		return ErrInvalidIndexName
+	}
+
+	t := tx.tables[table]
+	if t == nil {
+		return ErrTableNotFound
+	} else if t.Index(name) != nil {
+		return ErrIndexExists
+	} else if t.ColumnIndex(column) == -1 {
+		return fmt.Errorf("%w: %s", ErrColumnNotFound, column)
+	}
+
+	other := *t
+	other.Indexes = append(t.Indexes[:len(t.Indexes):len(t.Indexes)], &IndexDefinition{Name: name, Column: column})
+	tx.tables[table] = &other
+	tx.changed[table] = true
+
+	return nil
+}
+
+// executeCreateIndexStatement creates an index on the statement's column.
+func (tx *Tx) executeCreateIndexStatement(stmt *pieql.CreateIndexStatement) (*Result, error) {
+	if err := tx.CreateIndex(stmt.Table, stmt.Name, stmt.Column); err != nil {
+		return nil, err
+	}
+	return &Result{}, nil
+}
+
+// indexLookup returns the positions of the rows in a table that can match
+// condition, using any of the table's indexes on columns compared against a
+// literal, along with the names of the indexes used. Returns nil if no index
+// can be used. Column references in the condition must be unqualified.
+func (tx *Tx) indexLookup(t *Table, condition pieql.Expr) (rows []int, names []string, err error) {
+	for _, expr := range conjuncts(condition) {
+		// Only comparisons between an indexed column & a literal are used.
+		ref, op, lit, ok := splitComparison(expr)
+		if !ok || op == pieql.NEQ {
+			continue
+		}
+		idx := t.indexOn(ref.Val)
+		if idx == nil {
+			continue
+		}
+		c := t.Columns[t.ColumnIndex(idx.Column)]
+		value, ok := literalValue(c, lit)
+		if !ok {
+			continue
+		}
+
+		// Ignore indexes that haven't been built for the table's rows.
+		data, err := tx.db.Storage.ReadIndex(t, idx.Name)
+		if err != nil {
+			return nil, nil, err
+		} else if data == nil || data.Version != t.version {
+			continue
+		}
+
+		// Keep rows matching every comparison.
+		if a := data.lookup(c, op, value); rows == nil {
+			rows = a
+		} else {
+			rows = intersectRows(rows, a)
+		}
+		names = append(names, idx.Name)
+	}
+	return rows, names, nil
+}
+
+// splitComparison returns the column, operator & literal of a comparison
+// with the operator normalized so that the column is on the left.
+func splitComparison(expr pieql.Expr) (ref *pieql.VarRef, op pieql.Token, lit pieql.Expr, ok bool) {
+	for {
+		paren, ok := expr.(*pieql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = paren.Expr
+	}
+
+	e, ok := expr.(*pieql.BinaryExpr)
+	if !ok {
+		return nil, 0, nil, false
+	}
+	switch e.Op {
+	case pieql.EQ, pieql.NEQ, pieql.LT, pieql.LTE, pieql.GT, pieql.GTE:
+	default:
+		return nil, 0, nil, false
+	}
+
+	if ref, ok := e.LHS.(*pieql.VarRef); ok {
+		return ref, e.Op, e.RHS, true
+	} else if ref, ok := e.RHS.(*pieql.VarRef); ok {
+		return ref, reverseComparison(e.Op), e.LHS, true
+	}
+	return nil, 0, nil, false
+}
+
+// literalValue returns the value of a literal compared against a column.
+// Returns false unless the literal compares in the same order as the
+// column's values. Other comparisons fall back to comparing strings.
+func literalValue(c *Column, lit pieql.Expr) (interface{}, bool) {
+	switch lit := lit.(type) {
+	case *pieql.StringLiteral:
+		v, err := c.ParseValue(lit.Val)
+		if err != nil || v == nil {
+			return nil, false
+		}
+		return v, true
+	case *pieql.NumberLiteral:
+		if c.Type != IntegerType && c.Type != FloatType {
+			return nil, false
+		}
+		return pieql.Eval(lit, nil), true
+	case *pieql.BooleanLiteral:
+		if c.Type != BooleanType {
+			return nil, false
+		}
+		return pieql.Eval(lit, nil), true
+	}
+	return nil, false
+}
+
+// buildIndex reads every row of a table and returns the entries of an index
+// on one of its columns.
+func buildIndex(s Storage, t *Table, idx *IndexDefinition) (*IndexData, error) {
+	index := t.ColumnIndex(idx.Column)
+	if index == -1 {
+		return nil, fmt.Errorf("%w: %s", ErrColumnNotFound, idx.Column)
+	}
+
+	itr, err := s.RowIterator(t, IteratorOptions{Columns: []int{index}})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = itr.Close() }()
+
+	var rows [][]string
+	for {
+		row, err := itr.Next()
+		if err != nil {
+			return nil, err
+		} else if row == nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+
+	data := &IndexData{Version: t.version}
+	data.append(t.Columns[index], index, rows)
+	return data, nil
+}
+
+// writeIndexes builds & writes each of a table's indexes.
+func writeIndexes(s Storage, t *Table) error {
+	for _, idx := range t.Indexes {
+		data, err := buildIndex(s, t, idx)
+		if err != nil {
+			return err
+		} else if err := s.WriteIndex(t, idx.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// append adds rows to the end of the indexed rows. The cell at index of each
+// row is added to the entries, which are then sorted.
+func (d *IndexData) append(c *Column, index int, rows [][]string) {
+	entries := make(map[string]*IndexEntry, len(d.Entries))
+	for _, e := range d.Entries {
+		entries[e.Value] = e
+	}
+
+	for i, row := range rows {
+		pos := d.N + i
+		if index >= len(row) {
+			continue
+		} else if v, err := c.ParseValue(row[index]); err != nil || v == nil {
+			continue
+		}
+
+		e := entries[row[index]]
+		if e == nil {
+			e = &IndexEntry{Value: row[index]}
+			entries[e.Value] = e
+			d.Entries = append(d.Entries, e)
+		}
+		e.Rows = append(e.Rows, pos)
+	}
+	d.N += len(rows)
+
+	// Sort by value. Cells that parse to the same value are sorted as strings.
+	values := make(map[*IndexEntry]interface{}, len(d.Entries))
+	for _, e := range d.Entries {
+		values[e], _ = c.ParseValue(e.Value)
+	}
+	sort.SliceStable(d.Entries, func(i, j int) bool {
+		a, b := d.Entries[i], d.Entries[j]
+		if cmp := compareValues(values[a], values[b]); cmp != 0 {
+			return cmp < 0
+		}
+		return a.Value < b.Value
+	})
+}
+
+// clone returns a copy of the index data that can be appended to.
+func (d *IndexData) clone() *IndexData {
+	other := &IndexData{Version: d.Version, N: d.N}
+	for _, e := range d.Entries {
+		other.Entries = append(other.Entries, &IndexEntry{Value: e.Value, Rows: append([]int(nil), e.Rows...)})
+	}
+	return other
+}
+
+// lookup returns the positions of the rows whose cell matches a comparison
+// against value, in ascending order.
+func (d *IndexData) lookup(c *Column, op pieql.Token, value interface{}) []int {
+	cmp := func(i int) int {
+		v, _ := c.ParseValue(d.Entries[i].Value)
+		return compareValues(v, value)
+	}
+
+	// Find the range of entries matching the comparison.
+	n := len(d.Entries)
+	lo, hi := 0, n
+	switch op {
+	case pieql.EQ:
+		lo = sort.Search(n, func(i int) bool { return cmp(i) >= 0 })
+		hi = sort.Search(n, func(i int) bool { return cmp(i) > 0 })
+	case pieql.LT:
+		hi = sort.Search(n, func(i int) bool { return cmp(i) >= 0 })
+	case pieql.LTE:
+		hi = sort.Search(n, func(i int) bool { return cmp(i) > 0 })
+	case pieql.GT:
+		lo = sort.Search(n, func(i int) bool { return cmp(i) > 0 })
+	case pieql.GTE:
+		lo = sort.Search(n, func(i int) bool { return cmp(i) >= 0 })
+	}
+
+	if hi < lo {
+		hi = lo
+	}
+	rows := []int{}
+	for _, e := range d.Entries[lo:hi] {
+		rows = append(rows, e.Rows...)
+	}
+	sort.Ints(rows)
+	return rows
+}
+
+// intersectRows returns the positions found in both sorted lists.
+func intersectRows(a, b []int) []int {
+	rows := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			rows = append(rows, a[i])
+			i, j = i+1, j+1
+		}
+	}
+	return rows
+}
+
+// readIndexFile reads index data from the file at path.
+// Returns nil if the file doesn't exist.
+func readIndexFile(path string) (*IndexData, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	// The first line holds the version & row count, followed by one
+	// entry per line.
+	dec := json.NewDecoder(bufio.NewReader(f))
+	var data IndexData
+	if err := dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid index: %s", err)
+	}
+	for {
+		var e IndexEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return &data, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid index: %s", err)
+		}
+		data.Entries = append(data.Entries, &e)
+	}
+}
+
+// writeIndexFile replaces the file at path with the index data.
+func writeIndexFile(path string, data *IndexData) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+		for _, e := range data.Entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// indexPath returns the path of an index file for a table whose rows are
+// stored under key within a database's root directory.
+func indexPath(root, key, name string) (string, error) {
+	dir, err := indexDir(root, key)
+	if err != nil {
+		return "", err
+	}
+	return childPath(dir, name)
+}
+
+// indexDir returns the directory holding the index files for rows stored
+// under key within a database's root directory.
+func indexDir(root, key string) (string, error) {
+	return childPath(filepath.Join(root, "index"), key)
+}
+
+// childPath returns the path of a file named name directly within dir.
+// Returns an error if name would resolve to any other path.
+func childPath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	if filepath.Dir(path) != filepath.Clean(dir) {
+		return "", fmt.Errorf("invalid file name: %q", name)
+	}
+	return path, nil
+}
+
+// moveIndexFiles moves the index files for rows stored under src to dst,
+// replacing any existing index files.
+func moveIndexFiles(root, src, dst string) error {
+	srcDir, err := indexDir(root, src)
+	if err != nil {
+		return err
+	}
+	dstDir, err := indexDir(root, dst)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dstDir); err != nil {
+		return err
+	} else if err := os.Rename(srcDir, dstDir); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(dstDir))
+}
+
+// deleteIndexFiles removes the index files for rows stored under key.
+func deleteIndexFiles(root, key string) error {
+	dir, err := indexDir(root, key)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
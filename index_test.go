@@ -0,0 +1,136 @@
+package pie_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure an index returns the same rows as a full scan as rows are changed.
+func TestDatabase_CreateIndex(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		open func() *Database
+	}{
+		{name: "row", open: OpenDatabase},
+		{name: "columnar", open: func() *Database { return OpenColumnarDatabase(2) }},
+		{name: "memory", open: OpenMemDatabase},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.open()
+			defer db.Close()
+			db.CreateTable("foo", []*pie.Column{{Name: "n", Type: pie.IntegerType}, {Name: "s"}})
+			db.SetTableRows("foo", [][]string{{"3", "c"}, {"1", "a"}, {"", "x"}, {"2", "b"}, {"3", "cc"}})
+			if _, err := db.Execute(MustParseStatement(`CREATE INDEX by_n ON foo (n)`)); err != nil {
+				t.Fatal(err)
+			}
+
+			// Each query is run after the statements before it.
+			for i, q := range []struct {
+				s   string
+				exp [][]string
+			}{
+				{s: `SELECT s FROM foo WHERE n = 3`, exp: [][]string{{"c"}, {"cc"}}},
+				{s: `SELECT s FROM foo WHERE n = '3'`, exp: [][]string{{"c"}, {"cc"}}},
+				{s: `SELECT s FROM foo WHERE n < 3`, exp: [][]string{{"a"}, {"b"}}},
+				{s: `SELECT s FROM foo WHERE 2 <= n AND n <= 2.5`, exp: [][]string{{"b"}}},
+				{s: `SELECT s FROM foo WHERE n > 1 AND s != 'c'`, exp: [][]string{{"b"}, {"cc"}}},
+				{s: `SELECT s FROM foo WHERE n = 4 OR s = 'x'`, exp: [][]string{{"x"}}},
+				{s: `SELECT s FROM foo WHERE n = 4`, exp: nil},
+				{s: `INSERT INTO foo VALUES (4, 'd'), (1, 'aa')`},
+				{s: `SELECT s FROM foo WHERE n = 4`, exp: [][]string{{"d"}}},
+				{s: `SELECT s FROM foo WHERE n <= 1`, exp: [][]string{{"a"}, {"aa"}}},
+				{s: `UPDATE foo SET n = n + 1 WHERE s = 'a'`},
+				{s: `SELECT s FROM foo WHERE n = 2`, exp: [][]string{{"a"}, {"b"}}},
+				{s: `DELETE FROM foo WHERE n = 3`},
+				{s: `SELECT s FROM foo WHERE n >= 2`, exp: [][]string{{"a"}, {"b"}, {"d"}}},
+			} {
+				res, err := db.Execute(MustParseStatement(q.s))
+				if err != nil {
+					t.Fatalf("%d. %s: %s", i, q.s, err)
+				} else if strings.HasPrefix(q.s, "SELECT") && !reflect.DeepEqual(res.Rows, q.exp) {
+					t.Fatalf("%d. %s: unexpected rows: %#v", i, q.s, res.Rows)
+				}
+			}
+		})
+	}
+}
+
+// Ensure creating an index returns an error for invalid tables & columns.
+func TestDatabase_CreateIndex_Err(t *testing.T) {
+	db := OpenMemDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n"}})
+	db.CreateIndex("foo", "idx", "n")
+
+	if err := db.CreateIndex("foo", "", "n"); err != pie.ErrIndexNameRequired {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db.CreateIndex("foo", "../x", "n"); err != pie.ErrInvalidIndexName {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db.CreateIndex("foo", "idx", "n"); err != pie.ErrIndexExists {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db.CreateIndex("bar", "idx", "n"); err != pie.ErrTableNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db.CreateIndex("foo", "idx2", "x"); err == nil || err.Error() != "column not found: x" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure rows excluded by an index are never read.
+func TestDatabase_CreateIndex_SkipRows(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n", Type: pie.IntegerType}, {Name: "s"}})
+	db.SetTableRows("foo", [][]string{{"1", "a"}, {"2", "b"}, {"3", "c"}})
+	if err := db.CreateIndex("foo", "by_n", "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the last row with one that can't be decoded.
+	if err := ioutil.WriteFile(filepath.Join(db.Path(), "data", "foo"), []byte("[\"1\",\"a\"]\n[\"2\",\"b\"]\n{}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := db.Execute(MustParseStatement(`SELECT s FROM foo WHERE n = 2`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"b"}}) {
+		t.Fatalf("unexpected rows: %#v", res.Rows)
+	} else if _, err := db.Execute(MustParseStatement(`SELECT s FROM foo WHERE s = 'b'`)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// Ensure missing & stale indexes are rebuilt when the database is opened.
+func TestDatabase_Open_RebuildIndex(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n", Type: pie.IntegerType}})
+	db.SetTableRows("foo", [][]string{{"1"}, {"2"}})
+	db.CreateIndex("foo", "a", "n")
+	db.CreateIndex("foo", "b", "n")
+
+	// Remove one index and replace the other with an older version.
+	path := db.Path()
+	db.Database.Close()
+	if err := os.Remove(filepath.Join(path, "index", "foo", "a")); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(path, "index", "foo", "b"), []byte(`{"version":0,"n":0}`+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if data, err := db.Storage.ReadIndex(db.Table("foo"), name); err != nil {
+			t.Fatal(err)
+		} else if data == nil || data.N != 2 || len(data.Entries) != 2 {
+			t.Fatalf("unexpected index %s: %#v", name, data)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package pie
+
+import (
+	"strings"
+	"time"
+
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+// joiner combines tuples with the matching rows from a joined table.
+type joiner struct {
+	scope *scope
+	index int // position of the joined table within the scope
+	j     *pieql.Join
+	rows  [][]string
+
+	// Expressions for each side of an equality condition & the joined rows
+	// indexed by their key. The hash is nil if there are no equalities.
+	leftKeys []pieql.Expr
+	hash     map[string][][]string
+}
+
+// newJoiner returns a joiner for the rows of a joined table. Equality
+// conditions between the joined table and earlier tables are used to build a
+// hash table of the joined rows. Otherwise every pair of rows is compared.
+func newJoiner(sc *scope, index int, j *pieql.Join, rows [][]string) *joiner {
+	jn := &joiner{scope: sc, index: index, j: j, rows: rows}
+
+	// Split the condition into expressions for each side of the join.
+	var rightKeys []pieql.Expr
+	jn.leftKeys, rightKeys = joinKeys(sc, index, j.Condition)
+
+	// Index the joined rows by their key, if possible.
+	if len(rightKeys) > 0 {
+		jn.hash = make(map[string][][]string)
+		for _, row := range rows {
+			tuple := make([][]string, index+1)
+			tuple[index] = row
+			if key, ok := joinKey(rightKeys, &rowValuer{scope: sc, rows: tuple}); ok {
+				jn.hash[key] = append(jn.hash[key], row)
+			}
+		}
+	}
+
+	return jn
+}
+
+// join combines each tuple with the matching rows from the joined table.
+func (jn *joiner) join(tuples [][][]string) [][][]string {
+	sc, index, j := jn.scope, jn.index, jn.j
+
+	var a [][][]string
+	for _, tuple := range tuples {
+		// Find candidate rows by key or fall back to all rows.
+		candidates := jn.rows
+		if jn.hash != nil {
+			key, ok := joinKey(jn.leftKeys, &rowValuer{scope: sc, rows: tuple})
+			if !ok {
+				candidates = nil
+			} else {
+				candidates = jn.hash[key]
+			}
+		}
+
+		// Add a combined tuple for every row matching the full condition.
+		var matched bool
+		for _, row := range candidates {
+			combined := append(tuple[:index:index], row)
+			if pieql.EvalBool(j.Condition, &rowValuer{scope: sc, rows: combined}) {
+				a = append(a, combined)
+				matched = true
+			}
+		}
+
+		// Outer joins keep unmatched tuples without a joined row.
+		if !matched && j.Type == pieql.LEFT {
+			a = append(a, append(tuple[:index:index], nil))
+		}
+	}
+
+	return a
+}
+
+// joinKeys returns pairs of expressions from equality conditions in expr
+// where one side references only the joined table and the other side
+// references only earlier tables. Conditions are only split on AND. Both
+// sides must be columns of the same type so that equal values have the same
+// key. Other equalities may convert values between types when compared and
+// are only checked by evaluating the condition.
+func joinKeys(sc *scope, index int, expr pieql.Expr) (left, right []pieql.Expr) {
+	switch expr := expr.(type) {
+	case *pieql.ParenExpr:
+		return joinKeys(sc, index, expr.Expr)
+	case *pieql.BinaryExpr:
+		switch expr.Op {
+		case pieql.AND:
+			lhsLeft, lhsRight := joinKeys(sc, index, expr.LHS)
+			rhsLeft, rhsRight := joinKeys(sc, index, expr.RHS)
+			return append(lhsLeft, rhsLeft...), append(lhsRight, rhsRight...)
+		case pieql.EQ:
+			lhs, rhs := joinSide(sc, index, expr.LHS), joinSide(sc, index, expr.RHS)
+			if !sameColumnType(sc, expr.LHS, expr.RHS) {
+				return nil, nil
+			} else if lhs == joinLeft && rhs == joinRight {
+				return []pieql.Expr{expr.LHS}, []pieql.Expr{expr.RHS}
+			} else if lhs == joinRight && rhs == joinLeft {
+				return []pieql.Expr{expr.RHS}, []pieql.Expr{expr.LHS}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Sides of a join that an expression can reference.
+const (
+	joinNone = iota
+	joinLeft
+	joinRight
+)
+
+// joinSide returns which side of a join expr references.
+// Returns joinNone if it references no tables or both sides.
+func joinSide(sc *scope, index int, expr pieql.Expr) int {
+	var left, right bool
+	for table := range sc.tablesIn(expr) {
+		if table == index {
+			right = true
+		} else if table < index {
+			left = true
+		} else {
+			return joinNone
+		}
+	}
+
+	if left && !right {
+		return joinLeft
+	} else if right && !left {
+		return joinRight
+	}
+	return joinNone
+}
+
+// sameColumnType returns true if both expressions are columns of the same type.
+func sameColumnType(sc *scope, a, b pieql.Expr) bool {
+	x, ok := a.(*pieql.VarRef)
+	if !ok {
+		return false
+	}
+	y, ok := b.(*pieql.VarRef)
+	if !ok {
+		return false
+	}
+
+	cx, err := sc.lookup(x.String())
+	if err != nil {
+		return false
+	}
+	cy, err := sc.lookup(y.String())
+	if err != nil {
+		return false
+	}
+	return cx.column.Type == cy.column.Type
+}
+
+// joinKey returns the hash key for a set of expressions evaluated against v.
+// Returns false if any value is missing since missing values never match.
+func joinKey(exprs []pieql.Expr, v pieql.Valuer) (string, bool) {
+	values := make([]string, len(exprs))
+	for i, expr := range exprs {
+		value := pieql.Eval(expr, v)
+		if value == nil {
+			return "", false
+		}
+
+		// Timestamps in different zones are equal if they're the same instant.
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC()
+		}
+		values[i] = formatValue(value)
+	}
+	return strings.Join(values, "\x00"), true
+}
@@ -0,0 +1,176 @@
+package pie
+
+import (
+	"sync"
+)
+
+// MemStorage holds the metadata & rows of each table in memory.
+// Data is kept when the backend is closed so the database can be reopened
+// but nothing is written to disk. The path passed to Open is ignored.
+type MemStorage struct {
+	mu      sync.RWMutex
+	opened  bool
+	tables  []*Table
+	rows    map[string][][]string
+	indexes map[string]map[string]*IndexData // by data key & index name
+}
+
+// NewMemStorage returns a new instance of MemStorage.
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		rows:    make(map[string][][]string),
+		indexes: make(map[string]map[string]*IndexData),
+	}
+}
+
+// Name returns the name of the backend.
+func (s *MemStorage) Name() string { return "memory" }
+
+// Open opens the backend.
+func (s *MemStorage) Open(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.opened = true
+	return nil
+}
+
+// Close closes the backend.
+func (s *MemStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.opened = false
+	return nil
+}
+
+// LoadMeta returns the tables last saved.
+func (s *MemStorage) LoadMeta() ([]*Table, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.opened {
+		return nil, ErrNotOpen
+	}
+	return s.tables, nil
+}
+
+// SaveMeta replaces the list of tables.
+func (s *MemStorage) SaveMeta(tables []*Table) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.opened {
+		return ErrNotOpen
+	}
+	s.tables = tables
+	return nil
+}
+
+// RowIterator returns a cursor over the rows of a table.
+// Only the rows required by the options are returned.
+func (s *MemStorage) RowIterator(t *Table, opt IteratorOptions) (RowIterator, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.opened {
+		return nil, ErrNotOpen
+	}
+	return &rowSliceIterator{rows: opt.filterRows(s.rows[t.dataKey()])}, nil
+}
+
+// WriteRows replaces the rows of a table.
+func (s *MemStorage) WriteRows(t *Table, itr RowIterator) error {
+	rows, err := readRows(itr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.opened {
+		return ErrNotOpen
+	}
+	s.rows[t.dataKey()] = rows
+	return nil
+}
+
+// AppendRows adds rows to the end of a table.
+func (s *MemStorage) AppendRows(t *Table, rows [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.opened {
+		return ErrNotOpen
+	}
+
+	// Copy the existing rows so that open iterators are unaffected.
+	existing := s.rows[t.dataKey()]
+	s.rows[t.dataKey()] = append(existing[:len(existing):len(existing)], rows...)
+	return nil
+}
+
+// MoveRows moves the rows & indexes of a table to key, replacing any
+// existing rows & indexes. Nothing is changed if the table has no rows.
+func (s *MemStorage) MoveRows(t *Table, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.opened {
+		return ErrNotOpen
+	}
+
+	rows, ok := s.rows[t.dataKey()]
+	if !ok {
+		return nil
+	}
+	s.rows[key] = rows
+	if indexes, ok := s.indexes[t.dataKey()]; ok {
+		s.indexes[key] = indexes
+	} else {
+		delete(s.indexes, key)
+	}
+	delete(s.rows, t.dataKey())
+	delete(s.indexes, t.dataKey())
+	return nil
+}
+
+// DeleteTable removes the rows & indexes of a table.
+func (s *MemStorage) DeleteTable(t *Table) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.opened {
+		return ErrNotOpen
+	}
+	delete(s.rows, t.dataKey())
+	delete(s.indexes, t.dataKey())
+	return nil
+}
+
+// ReadIndex returns one of the table's indexes.
+func (s *MemStorage) ReadIndex(t *Table, name string) (*IndexData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.opened {
+		return nil, ErrNotOpen
+	}
+	return s.indexes[t.dataKey()][name], nil
+}
+
+// WriteIndex replaces one of the table's indexes.
+func (s *MemStorage) WriteIndex(t *Table, name string, data *IndexData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.opened {
+		return ErrNotOpen
+	}
+	if s.indexes[t.dataKey()] == nil {
+		s.indexes[t.dataKey()] = make(map[string]*IndexData)
+	}
+	s.indexes[t.dataKey()][name] = data
+	return nil
+}
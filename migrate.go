@@ -0,0 +1,209 @@
+package pie
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FormatVersion is the version of the meta file & data layout written by
+// this package. Databases written by older versions are upgraded by Migrate.
+const FormatVersion = 1
+
+// MigrationStep represents a change made to the files of a database to
+// upgrade it to a newer format version.
+type MigrationStep struct {
+	Version     int // format version the step belongs to
+	Description string
+
+	apply func() error
+}
+
+// migration represents the changes needed to upgrade a database from the
+// previous format version.
+type migration struct {
+	version int
+
+	// plan returns the steps to upgrade the files of the database at root.
+	// Steps may change the meta document before it's saved.
+	plan func(root string, doc metaDocument) ([]*MigrationStep, error)
+}
+
+// migrations lists every migration in order of version.
+var migrations = []*migration{
+	// Version 1 adds the format version to the meta file. Row data files
+	// that hold all rows in a single JSON array are rewritten with one row
+	// per line.
+	{version: 1, plan: planLineRowFormat},
+}
+
+// Migrate upgrades the meta file & data files of the database at path to
+// FormatVersion. Returns the steps applied, or the steps that would be
+// applied if dryRun is true. Nothing is changed if the database has no meta
+// file. The database must not be open while it's migrated.
+//
+// The meta file is saved after each version's steps are applied so an
+// interrupted migration is resumed from the last version saved.
+func Migrate(path string, dryRun bool) ([]*MigrationStep, error) {
+	doc, err := readMetaDocument(path)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	format, err := doc.format()
+	if err != nil {
+		return nil, err
+	} else if format > FormatVersion {
+		return nil, fmt.Errorf("database format version %d is newer than supported version %d", format, FormatVersion)
+	}
+
+	var steps []*MigrationStep
+	for _, m := range migrations {
+		if m.version <= format {
+			continue
+		}
+
+		a, err := m.plan(path, doc)
+		if err != nil {
+			return nil, err
+		}
+		version := m.version
+		a = append(a, &MigrationStep{
+			Description: fmt.Sprintf("set meta format version to %d", version),
+			apply: func() error {
+				doc["format"] = version
+				return writeMetaDocument(path, doc)
+			},
+		})
+
+		for _, step := range a {
+			step.Version = version
+			if dryRun {
+				continue
+			} else if err := step.apply(); err != nil {
+				return nil, fmt.Errorf("migrate to version %d: %s: %s", version, step.Description, err)
+			}
+		}
+		steps = append(steps, a...)
+	}
+	return steps, nil
+}
+
+// planLineRowFormat returns steps to rewrite row storage data files that
+// hold all rows in a single JSON array.
+func planLineRowFormat(root string, doc metaDocument) ([]*MigrationStep, error) {
+	if doc.storage() != "row" {
+		return nil, nil
+	}
+
+	var steps []*MigrationStep
+	for _, key := range doc.dataKeys() {
+		path := filepath.Join(root, "data", key)
+		if legacy, err := isLegacyRowFile(path); err != nil {
+			return nil, err
+		} else if !legacy {
+			continue
+		}
+
+		steps = append(steps, &MigrationStep{
+			Description: fmt.Sprintf("rewrite data/%s with one row per line", key),
+			apply:       func() error { return rewriteLegacyRowFile(path) },
+		})
+	}
+	return steps, nil
+}
+
+// rewriteLegacyRowFile replaces a data file holding all rows in a single
+// JSON array with one holding one row per line.
+func rewriteLegacyRowFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	var rows [][]string
+	if err := json.NewDecoder(bufio.NewReader(f)).Decode(&rows); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return writeRows(w, rows)
+	})
+}
+
+// metaDocument represents the meta file as generic JSON so that migrations
+// can read & change fields that the current types don't have.
+type metaDocument map[string]interface{}
+
+// readMetaDocument reads the meta file within a database's root directory.
+// Returns nil if the file doesn't exist.
+func readMetaDocument(path string) (metaDocument, error) {
+	f, err := os.Open(filepath.Join(path, "meta"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	var doc metaDocument
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// writeMetaDocument replaces the meta file within a database's root directory.
+func writeMetaDocument(path string, doc metaDocument) error {
+	return writeFileAtomic(filepath.Join(path, "meta"), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(doc)
+	})
+}
+
+// format returns the format version of the document. Documents written
+// before the version was recorded are version zero.
+func (doc metaDocument) format() (int, error) {
+	switch v := doc["format"].(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("invalid meta format version: %s", v)
+		}
+		return int(n), nil
+	case int:
+		return v, nil
+	}
+	return 0, fmt.Errorf("invalid meta format version: %v", doc["format"])
+}
+
+// storage returns the name of the backend that wrote the document.
+func (doc metaDocument) storage() string {
+	if s, ok := doc["storage"].(string); ok && s != "" {
+		return s
+	}
+	return "row"
+}
+
+// dataKeys returns the key that each table's rows are stored under.
+func (doc metaDocument) dataKeys() []string {
+	tables, _ := doc["tables"].([]interface{})
+
+	var keys []string
+	for _, v := range tables {
+		t, _ := v.(map[string]interface{})
+		if key, ok := t["data"].(string); ok && key != "" {
+			keys = append(keys, key)
+		} else if name, ok := t["name"].(string); ok {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
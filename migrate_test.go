@@ -0,0 +1,112 @@
+package pie_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure an unversioned database is upgraded and that a dry run doesn't
+// change any files.
+func TestMigrate(t *testing.T) {
+	path := tempfile()
+	defer os.RemoveAll(path)
+	MustWriteFiles(path, map[string]string{
+		"meta":     `{"tables":[{"name":"foo","columns":[{"name":"a"}]},{"name":"bar","columns":[{"name":"a"}]},{"name":"baz","columns":[{"name":"a"}]}]}`,
+		"data/foo": ` [ ["1"],["2"]]`,
+		"data/bar": "[\"3\"]\n",
+		"data/baz": `[ ]`,
+	})
+
+	exp := []string{"rewrite data/foo with one row per line", "rewrite data/baz with one row per line", "set meta format version to 1"}
+	if steps, err := pie.Migrate(path, true); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(stepDescriptions(steps, 1), exp) {
+		t.Fatalf("unexpected steps: %v", stepDescriptions(steps, 1))
+	} else if b, _ := ioutil.ReadFile(filepath.Join(path, "data", "foo")); string(b) != ` [ ["1"],["2"]]` {
+		t.Fatalf("unexpected data file after dry run: %q", b)
+	}
+
+	if steps, err := pie.Migrate(path, false); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(stepDescriptions(steps, 1), exp) {
+		t.Fatalf("unexpected steps: %v", stepDescriptions(steps, 1))
+	} else if b, _ := ioutil.ReadFile(filepath.Join(path, "data", "foo")); string(b) != "[\"1\"]\n[\"2\"]\n" {
+		t.Fatalf("unexpected data file: %q", b)
+	} else if b, _ := ioutil.ReadFile(filepath.Join(path, "data", "baz")); string(b) != "" {
+		t.Fatalf("unexpected empty data file: %q", b)
+	} else if steps, err := pie.Migrate(path, false); err != nil || len(steps) != 0 {
+		t.Fatalf("unexpected steps: %v (%v)", steps, err)
+	}
+}
+
+// Ensure an unversioned database is upgraded when it's opened.
+func TestDatabase_Open_Migrate(t *testing.T) {
+	path := tempfile()
+	defer os.RemoveAll(path)
+	MustWriteFiles(path, map[string]string{
+		"meta":     `{"tables":[{"name":"bar","columns":[{"name":"a"}]},{"name":"foo","columns":[{"name":"a"}]}]}`,
+		"data/bar": `[]`,
+		"data/foo": `[["1"],["2"]]`,
+	})
+
+	db := pie.NewDatabase()
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if rows, err := db.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	} else if rows, err := db.TableRows("bar"); err != nil {
+		t.Fatal(err)
+	} else if len(rows) != 0 {
+		t.Fatalf("unexpected empty table rows: %#v", rows)
+	} else if b, _ := ioutil.ReadFile(filepath.Join(path, "meta")); string(b) != `{"format":1,"tables":[{"columns":[{"name":"a"}],"name":"bar"},{"columns":[{"name":"a"}],"name":"foo"}]}`+"\n" {
+		t.Fatalf("unexpected meta: %s", b)
+	}
+}
+
+// Ensure a database written by a newer version isn't opened.
+func TestDatabase_Open_ErrNewerFormat(t *testing.T) {
+	path := tempfile()
+	defer os.RemoveAll(path)
+	MustWriteFiles(path, map[string]string{"meta": `{"format":2,"tables":[]}`})
+
+	if err := pie.NewDatabase().Open(path); err == nil || err.Error() != "database format version 2 is newer than supported version 1" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := pie.Migrate(path, true); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// MustWriteFiles writes files by path relative to a directory. Panic on error.
+func MustWriteFiles(dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			panic(err)
+		} else if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// stepDescriptions returns the description of each step. Panics unless
+// every step belongs to version.
+func stepDescriptions(steps []*pie.MigrationStep, version int) []string {
+	var a []string
+	for _, step := range steps {
+		if step.Version != version {
+			panic("unexpected version")
+		}
+		a = append(a, step.Description)
+	}
+	return a
+}
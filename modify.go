@@ -0,0 +1,317 @@
+package pie
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+// InsertRows appends rows to a table within its own transaction.
+// See Tx.InsertRows for details.
+func (db *Database) InsertRows(name string, columns []string, rows [][]string) (n int, err error) {
+	err = db.update(func(tx *Tx) error {
+		n, err = tx.InsertRows(name, columns, rows)
+		return err
+	})
+	return n, err
+}
+
+// UpdateRows updates the rows of a table within its own transaction.
+// See Tx.UpdateRows for details.
+func (db *Database) UpdateRows(name string, assignments []*pieql.Assignment, condition pieql.Expr) (n int, err error) {
+	err = db.update(func(tx *Tx) error {
+		n, err = tx.UpdateRows(name, assignments, condition)
+		return err
+	})
+	return n, err
+}
+
+// DeleteRows removes rows from a table within its own transaction.
+// See Tx.DeleteRows for details.
+func (db *Database) DeleteRows(name string, condition pieql.Expr) (n int, err error) {
+	err = db.update(func(tx *Tx) error {
+		n, err = tx.DeleteRows(name, condition)
+		return err
+	})
+	return n, err
+}
+
+// InsertRows appends rows to a table.
+// Values are assigned to the given columns in order and other columns are
+// left blank. If no columns are given then each row must have a value for
+// every column. Empty cells are replaced by their column's default. Returns
+// a *ConstraintError if any row violates the table's constraints. Returns the
+// number of rows inserted.
+func (tx *Tx) InsertRows(name string, columns []string, rows [][]string) (int, error) {
+	t := tx.Table(name)
+	if t == nil {
+		return 0, ErrTableNotFound
+	}
+
+	// Map the given columns to their position in the table.
+	indices, err := columnIndices(t, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	// Build a full table row for each row.
+	var a [][]string
+	for i, row := range rows {
+		if len(row) != len(indices) {
+			return 0, &RowError{Row: i + 1, Err: fmt.Errorf("expected %d values, got %d", len(indices), len(row))}
+		}
+
+		newRow := make([]string, len(t.Columns))
+		for j, index := range indices {
+			newRow[index] = row[j]
+		}
+		if err := validateRow(t, newRow); err != nil {
+			return 0, &RowError{Row: i + 1, Err: err}
+		}
+		a = append(a, newRow)
+	}
+
+	// Append the new rows without rewriting the existing rows.
+	if err := tx.AppendTableRows(name, a); err != nil {
+		return 0, err
+	}
+
+	return len(a), nil
+}
+
+// UpdateRows evaluates the assignments against each row matching condition
+// and rewrites the table's rows. A nil condition matches every row. Empty
+// cells in updated rows are replaced by their column's default. Returns a
+// *ConstraintError if any updated row violates the table's constraints.
+// Returns the number of rows updated.
+func (tx *Tx) UpdateRows(name string, assignments []*pieql.Assignment, condition pieql.Expr) (int, error) {
+	sc, err := tx.newTableScope(name)
+	if err != nil {
+		return 0, err
+	}
+	t := sc.tables[0]
+
+	// Verify the assigned columns and expressions.
+	indices := make([]int, len(assignments))
+	for i, a := range assignments {
+		if indices[i] = t.ColumnIndex(a.Column); indices[i] == -1 {
+			return 0, fmt.Errorf("%w: %s", ErrColumnNotFound, a.Column)
+		} else if err := validateModifyExpr(sc, a.Expr, "SET"); err != nil {
+			return 0, err
+		}
+	}
+	if err := validateModifyExpr(sc, condition, "WHERE"); err != nil {
+		return 0, err
+	}
+
+	// Check updated rows against each other & the rows left unchanged.
+	var chk *constraintChecker
+	if t.hasConstraints() {
+		chk = newConstraintChecker(t)
+		if chk.comparesRows() && condition != nil {
+			if err := tx.seedUnmatchedRows(chk, sc, condition); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Evaluate assignments against the original values of each matching row.
+	var i, n int
+	if err := tx.rewriteTableRows(name, func(row []string) ([]string, error) {
+		i++
+		v := &rowValuer{scope: sc, rows: [][]string{row}}
+		if condition != nil && !pieql.EvalBool(condition, v) {
+			return row, nil
+		}
+
+		newRow := make([]string, len(t.Columns))
+		copy(newRow, row)
+		for j, a := range assignments {
+			newRow[indices[j]] = evalCell(a.Expr, v)
+		}
+		if err := validateRow(t, newRow); err != nil {
+			return nil, &RowError{Row: i, Err: err}
+		}
+		if chk != nil {
+			var err error
+			if newRow, err = chk.check(newRow, i); err != nil {
+				return nil, err
+			}
+		}
+
+		n++
+		return newRow, nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// seedUnmatchedRows records the rows of the scope's table that don't match
+// condition so that updated rows can't repeat their unique values or
+// primary keys. Rows are recorded by their position in the table.
+func (tx *Tx) seedUnmatchedRows(chk *constraintChecker, sc *scope, condition pieql.Expr) error {
+	itr, err := tx.tableRowIterator(sc.tables[0].Name, IteratorOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = itr.Close() }()
+
+	for pos := 1; ; pos++ {
+		row, err := itr.Next()
+		if err != nil {
+			return err
+		} else if row == nil {
+			return nil
+		}
+
+		if !pieql.EvalBool(condition, &rowValuer{scope: sc, rows: [][]string{row}}) {
+			chk.seedRow(row, pos)
+		}
+	}
+}
+
+// DeleteRows removes the rows matching condition and rewrites the remaining
+// rows. A nil condition removes every row.
+// Returns the number of rows deleted.
+func (tx *Tx) DeleteRows(name string, condition pieql.Expr) (int, error) {
+	sc, err := tx.newTableScope(name)
+	if err != nil {
+		return 0, err
+	} else if err := validateModifyExpr(sc, condition, "WHERE"); err != nil {
+		return 0, err
+	}
+
+	// Keep rows that don't match the condition.
+	var n int
+	if err := tx.rewriteTableRows(name, func(row []string) ([]string, error) {
+		if condition == nil || pieql.EvalBool(condition, &rowValuer{scope: sc, rows: [][]string{row}}) {
+			n++
+			return nil, nil
+		}
+		return row, nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// executeInsertStatement evaluates each list of values and inserts them as rows.
+func (tx *Tx) executeInsertStatement(stmt *pieql.InsertStatement) (*Result, error) {
+	// Values can only be constant expressions.
+	empty := &scope{keys: make(map[string]int)}
+	var rows [][]string
+	for _, values := range stmt.Values {
+		row := make([]string, len(values))
+		for i, expr := range values {
+			if err := validateModifyExpr(empty, expr, "VALUES"); err != nil {
+				return nil, err
+			}
+			row[i] = formatValue(pieql.Eval(expr, pieql.MapValuer{}))
+		}
+		rows = append(rows, row)
+	}
+
+	n, err := tx.InsertRows(stmt.Table, stmt.Columns, rows)
+	if err != nil {
+		return nil, err
+	}
+	return newRowsAffectedResult(n), nil
+}
+
+// executeUpdateStatement updates the rows matching the statement's condition.
+func (tx *Tx) executeUpdateStatement(stmt *pieql.UpdateStatement) (*Result, error) {
+	n, err := tx.UpdateRows(stmt.Table, stmt.Assignments, stmt.Condition)
+	if err != nil {
+		return nil, err
+	}
+	return newRowsAffectedResult(n), nil
+}
+
+// executeDeleteStatement deletes the rows matching the statement's condition.
+func (tx *Tx) executeDeleteStatement(stmt *pieql.DeleteStatement) (*Result, error) {
+	n, err := tx.DeleteRows(stmt.Table, stmt.Condition)
+	if err != nil {
+		return nil, err
+	}
+	return newRowsAffectedResult(n), nil
+}
+
+// newRowsAffectedResult returns a result reporting the number of rows changed.
+func newRowsAffectedResult(n int) *Result {
+	return &Result{
+		Columns:      []string{"rows_affected"},
+		Rows:         [][]string{{strconv.Itoa(n)}},
+		RowsAffected: n,
+	}
+}
+
+// newTableScope returns a scope containing only the columns of a single table.
+func (tx *Tx) newTableScope(name string) (*scope, error) {
+	return tx.newScope(&pieql.SelectStatement{Source: &pieql.Source{Name: name}})
+}
+
+// validateModifyExpr returns an error if expr references a column outside of
+// the scope or uses an aggregate function. The clause is used in the error.
+func validateModifyExpr(sc *scope, expr pieql.Expr, clause string) error {
+	if err := validateVarRefs(sc, expr); err != nil {
+		return err
+	} else if pieql.HasCall(expr) {
+		return errors.New("aggregate functions are not allowed in " + clause)
+	}
+	return nil
+}
+
+// columnIndices returns the position of each named column in the table.
+// If no names are given then the position of every column is returned.
+func columnIndices(t *Table, names []string) ([]int, error) {
+	if len(names) == 0 {
+		indices := make([]int, len(t.Columns))
+		for i := range indices {
+			indices[i] = i
+		}
+		return indices, nil
+	}
+
+	indices := make([]int, len(names))
+	for i, name := range names {
+		if indices[i] = t.ColumnIndex(name); indices[i] == -1 {
+			return nil, fmt.Errorf("%w: %s", ErrColumnNotFound, name)
+		}
+		for _, index := range indices[:i] {
+			if index == indices[i] {
+				return nil, fmt.Errorf("duplicate column: %s", name)
+			}
+		}
+	}
+	return indices, nil
+}
+
+// validateRow returns an error if a cell doesn't match its column's type.
+func validateRow(t *Table, row []string) error {
+	for i, c := range t.Columns {
+		if _, err := c.ParseValue(row[i]); err != nil {
+			return fmt.Errorf("column %q: %s", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// RowError represents an error with a specific row being written to a table.
+// Rows are numbered from one.
+type RowError struct {
+	Row int
+	Err error
+}
+
+// Error returns the string representation of the error.
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+}
+
+// Unwrap returns the error with the row.
+func (e *RowError) Unwrap() error { return e.Err }
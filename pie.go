@@ -1,11 +1,15 @@
 package pie
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/turingschool-examples/pie/pieql"
 )
@@ -22,242 +26,1085 @@ var (
 
 	// ErrTableNameRequired is returned when a blank table name is passed in.
 	ErrTableNameRequired = errors.New("table name required")
+
+	// ErrInvalidTableName is returned when a table name can't be used as the
+	// name of a file.
+	ErrInvalidTableName = errors.New("invalid table name")
+
+	// ErrColumnNotFound is returned when referencing a column that doesn't
+	// exist. It's wrapped with the name of the column.
+	ErrColumnNotFound = errors.New("column not found")
 )
 
 // Database represents a collection of tables.
+// It is safe for concurrent use by multiple goroutines.
 type Database struct {
+	mu     sync.RWMutex // protects the fields below & the metadata
 	path   string
+	opened bool
 	tables map[string]*Table
+
+	// Number of open transactions using each data key & the tables whose
+	// rows can be removed once their data key is no longer in use.
+	pins    map[string]int
+	garbage map[string]*Table
+	seq     int // last data key sequence number
+
+	// Held by the writable transaction, if any. Writers to every table are
+	// serialized by this lock instead of by per-table locks so that a
+	// transaction can change several tables and commit them together.
+	// Readers never wait on it since they read from a snapshot.
+	writeMu sync.Mutex
+
+	// Storage backend for the metadata & table rows. Defaults to row
+	// storage. A database must always be reopened with the same backend.
+	Storage Storage
 }
 
 // NewDatabase returns a new instance of Database.
 func NewDatabase() *Database {
 	return &Database{
-		tables: make(map[string]*Table),
+		tables:  make(map[string]*Table),
+		pins:    make(map[string]int),
+		garbage: make(map[string]*Table),
+		Storage: NewRowStorage(),
 	}
 }
 
 // Open opens and initializes a database at a given file path.
 func (db *Database) Open(path string) error {
-	// Set the path.
-	db.path = path
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Open the storage backend.
+	if err := db.Storage.Open(path); err != nil {
+		return err
+	}
 
-	// Make a new directory.
-	if err := os.MkdirAll(db.path, 0700); err != nil {
+	// Load the metadata.
+	if err := db.load(); err != nil {
+		_ = db.Storage.Close()
 		return err
 	}
-	if err := os.MkdirAll(db.dataPath(), 0700); err != nil {
+
+	// Finish moving rows that were left at a data key by a commit.
+	if err := db.moveRows(); err != nil {
+		_ = db.Storage.Close()
 		return err
 	}
 
-	// Open meta file.
-	if err := db.load(); err != nil {
+	// Rebuild indexes that are missing or weren't built from the latest rows.
+	if err := db.rebuildIndexes(); err != nil {
+		_ = db.Storage.Close()
 		return err
 	}
 
+	db.path, db.opened = path, true
 	return nil
 }
 
+// Close closes the database. All tables are removed from memory.
 func (db *Database) Close() error {
-	db.path = ""
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.opened {
+		return nil
+	}
+
+	db.path, db.opened = "", false
 	db.tables = make(map[string]*Table)
-	return nil
+	db.pins = make(map[string]int)
+	db.garbage = make(map[string]*Table)
+	return db.Storage.Close()
 }
 
 // Path returns the root path of the database.
-func (db *Database) Path() string { return db.path }
+func (db *Database) Path() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.path
+}
+
+// isOpen returns true if the database is open.
+func (db *Database) isOpen() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.opened
+}
+
+// Begin starts a new transaction. Only one writable transaction can be open
+// at a time so Begin blocks until any other writable transaction is closed.
+// The caller must commit or roll back the transaction when finished.
+func (db *Database) Begin(writable bool) (*Tx, error) {
+	return db.BeginContext(context.Background(), writable)
+}
+
+// BeginContext starts a new transaction bound to a context. Once the context
+// is done, statements & row reads within the transaction return the
+// context's error and the transaction can't be committed.
+func (db *Database) BeginContext(ctx context.Context, writable bool) (*Tx, error) {
+	if writable {
+		db.writeMu.Lock()
+	}
 
-func (db *Database) dataPath() string {
-	if db.path == "" {
-		return ""
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Verify database is open.
+	if !db.opened {
+		if writable {
+			db.writeMu.Unlock()
+		}
+		return nil, ErrNotOpen
+	}
+
+	// Copy the committed tables & hold their rows until the transaction closes.
+	tx := &Tx{
+		db:       db,
+		ctx:      ctx,
+		writable: writable,
+		tables:   make(map[string]*Table, len(db.tables)),
+		staged:   make(map[string]*Table),
+		appends:  make(map[string][][]string),
+		changed:  make(map[string]bool),
+	}
+	for name, t := range db.tables {
+		tx.tables[name] = t
+		tx.pinned = append(tx.pinned, t.dataKey())
+		db.pins[t.dataKey()]++
 	}
-	return filepath.Join(db.path, "data")
+
+	return tx, nil
 }
 
-// load reads the metadata from disk.
-func (db *Database) load() error {
-	// Open the meta file.
-	f, err := os.Open(filepath.Join(db.path, "meta"))
-	if os.IsNotExist(err) {
-		return nil
-	} else if err != nil {
+// update executes fn within a writable transaction. The transaction is
+// committed if fn returns nil and rolled back otherwise.
+func (db *Database) update(fn func(tx *Tx) error) error {
+	return db.updateContext(context.Background(), fn)
+}
+
+// updateContext executes fn within a writable transaction bound to ctx.
+func (db *Database) updateContext(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := db.BeginContext(ctx, true)
+	if err != nil {
 		return err
 	}
-	defer func() { _ = f.Close() }()
 
-	// Unmarshal the meta file.
-	if err := json.NewDecoder(f).Decode(&db); err != nil {
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
 		return err
 	}
+	return tx.Commit()
+}
 
-	return nil
+// view executes fn within a read-only transaction.
+func (db *Database) view(fn func(tx *Tx) error) error {
+	return db.viewContext(context.Background(), fn)
 }
 
-// save persists the metadata to disk.
-func (db *Database) save() error {
-	if db.path == "" {
-		return nil
+// viewContext executes fn within a read-only transaction bound to ctx.
+func (db *Database) viewContext(ctx context.Context, fn func(tx *Tx) error) error {
+	tx, err := db.BeginContext(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	return fn(tx)
+}
+
+// release drops a transaction's hold on each data key. Rows that belong to
+// replaced or deleted tables are removed once no transaction is using them.
+func (db *Database) release(keys []string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, key := range keys {
+		if db.pins[key]--; db.pins[key] > 0 {
+			continue
+		}
+		delete(db.pins, key)
+
+		// Rows that fail to be removed are left behind. Their data key is
+		// cleared before being reused.
+		if t := db.garbage[key]; t != nil {
+			_ = db.Storage.DeleteTable(t)
+			delete(db.garbage, key)
+		}
+	}
+}
+
+// nextKey returns an unused data key for new rows of a table. The key
+// can't be the name of any table so that rows can later be moved to the
+// name of their table. Must be called with the database lock held.
+func (db *Database) nextKey(name string, tables map[string]*Table) string {
+	for {
+		db.seq++
+		key := name + "~" + strconv.Itoa(db.seq)
+		if db.pins[key] > 0 || db.garbage[key] != nil || db.tables[key] != nil || tables[key] != nil {
+			continue
+		} else if db.keyInUse(key, db.tables) || db.keyInUse(key, tables) {
+			continue
+		}
+		return key
 	}
+}
 
-	// Open file for writing.
-	f, err := os.Create(filepath.Join(db.path, "meta"))
+// keyInUse returns true if any of the tables store their rows at key.
+func (db *Database) keyInUse(key string, tables map[string]*Table) bool {
+	for _, t := range tables {
+		if t.dataKey() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the metadata from storage.
+func (db *Database) load() error {
+	a, err := db.Storage.LoadMeta()
 	if err != nil {
 		return err
 	}
-	defer func() { _ = f.Close() }()
 
-	// Marshal metadata to file.
-	if err := json.NewEncoder(f).Encode(db); err != nil {
-		return err
+	db.tables = make(map[string]*Table)
+	for _, t := range a {
+		db.tables[t.Name] = t
+	}
+	return nil
+}
+
+// moveRows moves rows stored at a data key to their table's name. A commit
+// leaves rows at their key while the rows at the name are in use or if the
+// process stops before the move is saved. Moves that were already done
+// before the process stopped are skipped by the storage.
+// Must be called with the database lock held.
+func (db *Database) moveRows() error {
+	var moved bool
+	for _, t := range db.tableList() {
+		if t.key == "" || db.keyInUse(t.Name, db.tables) {
+			continue
+		} else if err := db.Storage.MoveRows(t, t.Name); err != nil {
+			return err
+		}
+		db.tables[t.Name] = t.withKey("")
+		moved = true
+	}
+
+	if !moved {
+		return nil
 	}
+	return db.save()
+}
+
+// rebuildIndexes builds any index whose entries are missing or stale.
+// Must be called with the database lock held.
+func (db *Database) rebuildIndexes() error {
+	for _, t := range db.tableList() {
+		for _, idx := range t.Indexes {
+			if data, err := db.Storage.ReadIndex(t, idx.Name); err != nil {
+				return err
+			} else if data != nil && data.Version == t.version {
+				continue
+			}
 
+			data, err := buildIndex(db.Storage, t, idx)
+			if err != nil {
+				return err
+			} else if err := db.Storage.WriteIndex(t, idx.Name, data); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+// save persists the metadata to storage.
+// Must be called with the database lock held.
+func (db *Database) save() error {
+	return db.Storage.SaveMeta(db.tableList())
+}
+
 // Table returns a table by name.
 func (db *Database) Table(name string) *Table {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	return db.tables[name]
 }
 
-// Tables returns a list of all tables in the database.
+// Tables returns a list of all tables in the database, sorted by name.
 func (db *Database) Tables() []*Table {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.tableList()
+}
+
+// tableList returns a list of all tables sorted by name.
+// Must be called with the database lock held.
+func (db *Database) tableList() []*Table {
 	var a []*Table
 	for _, t := range db.tables {
 		a = append(a, t)
 	}
+	sort.Sort(tables(a))
 	return a
 }
 
-// CreateTable creates a new table.
+// CreateTable creates a new table with an optional primary key.
 // Returns an error if name is blank or if table already exists.
-func (db *Database) CreateTable(name string, columns []*Column) error {
-	// Check for blank name.
-	// Check for existing table with the same name.
-	if name == "" {
-		return ErrTableNameRequired
-	} else if db.tables[name] != nil {
-		return ErrTableExists
-	}
-
-	// Add table to the database.
-	db.tables[name] = &Table{Name: name, Columns: columns}
-
-	return db.save()
+func (db *Database) CreateTable(name string, columns []*Column, primaryKey ...string) error {
+	return db.update(func(tx *Tx) error {
+		return tx.CreateTable(name, columns, primaryKey...)
+	})
 }
 
 // DeleteTable removes an existing table by name.
 // Returns an error if name is blank or table is not found.
 func (db *Database) DeleteTable(name string) error {
-	// TODO: Check for blank name.
-	if name == "" {
-		return ErrTableNameRequired
-	} else if db.tables[name] == nil {
-		return ErrTableNotFound
+	return db.update(func(tx *Tx) error {
+		return tx.DeleteTable(name)
+	})
+}
+
+// RenameTable changes the name of an existing table.
+// Returns an error if either name is blank, the table is not found or the
+// new name is taken.
+func (db *Database) RenameTable(name, newName string) error {
+	return db.update(func(tx *Tx) error {
+		return tx.RenameTable(name, newName)
+	})
+}
+
+// TableRows retrieves all rows for a table from disk.
+// Returns no rows if the table's rows have never been set.
+func (db *Database) TableRows(name string) (rows [][]string, err error) {
+	err = db.view(func(tx *Tx) error {
+		rows, err = tx.TableRows(name)
+		return err
+	})
+	return rows, err
+}
+
+// SetTableRows sets the rows on a table and saves the rows to disk.
+func (db *Database) SetTableRows(name string, rows [][]string) error {
+	return db.update(func(tx *Tx) error {
+		return tx.SetTableRows(name, rows)
+	})
+}
+
+// Result represents the result of executing a statement.
+type Result struct {
+	Columns []string
+	Rows    [][]string
+
+	// Number of rows changed by an INSERT, UPDATE or DELETE statement.
+	RowsAffected int
+}
+
+// Cursor represents the results of a statement that are read one row at a time.
+type Cursor struct {
+	Columns []string
+
+	// Number of rows changed by an INSERT, UPDATE or DELETE statement.
+	RowsAffected int
+
+	itr RowIterator
+}
+
+// Next returns the next result row. Returns nil when there are no more rows.
+func (c *Cursor) Next() ([]string, error) { return c.itr.Next() }
+
+// Close releases the resources held by the cursor.
+func (c *Cursor) Close() error { return c.itr.Close() }
+
+// Query executes a statement and returns a cursor over the results.
+// Rows from SELECT statements are computed as the cursor is read, where
+// possible, from a snapshot of the database taken when Query is called.
+// The caller must close the cursor when finished.
+func (db *Database) Query(stmt pieql.Statement) (*Cursor, error) {
+	return db.QueryContext(context.Background(), stmt)
+}
+
+// QueryContext executes a statement and returns a cursor over the results.
+// Reading from the cursor returns the context's error once it's done.
+// See Query for details.
+func (db *Database) QueryContext(ctx context.Context, stmt pieql.Statement) (*Cursor, error) {
+	if !isReadStatement(stmt) {
+		res, err := db.ExecuteContext(ctx, stmt)
+		if err != nil {
+			return nil, err
+		}
+		return newResultCursor(res), nil
 	}
-	// TODO: Check that table exists.
-	// TODO: Remove table from the database.
-	delete(db.tables, name)
 
-	return db.save()
+	// Keep the transaction open until the cursor is closed.
+	tx, err := db.BeginContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := tx.Query(stmt)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	cur.itr = &txIterator{RowIterator: cur.itr, tx: tx}
+	return cur, nil
+}
+
+// Execute executes a statement within its own transaction and returns all
+// of the results.
+func (db *Database) Execute(stmt pieql.Statement) (*Result, error) {
+	return db.ExecuteContext(context.Background(), stmt)
+}
+
+// ExecuteContext executes a statement within its own transaction and returns
+// all of the results. Execution stops with the context's error once the
+// context is done and any changes are discarded.
+func (db *Database) ExecuteContext(ctx context.Context, stmt pieql.Statement) (res *Result, err error) {
+	fn := func(tx *Tx) error {
+		res, err = tx.Execute(stmt)
+		return err
+	}
+	if isReadStatement(stmt) {
+		err = db.viewContext(ctx, fn)
+	} else {
+		err = db.updateContext(ctx, fn)
+	}
+	return res, err
+}
+
+// isReadStatement returns true if the statement doesn't change the database.
+func isReadStatement(stmt pieql.Statement) bool {
+	switch stmt.(type) {
+	case *pieql.SelectStatement, *pieql.ExplainStatement, *pieql.ShowTablesStatement, *pieql.DescribeTableStatement:
+		return true
+	}
+	return false
 }
 
-// TableRows retrieves the rows for a table from disk.
-func (db *Database) TableRows(name string) ([][]string, error) {
-	// Open data file for reading.
-	f, err := os.Open(filepath.Join(db.dataPath(), name))
+// Query executes a statement within the transaction and returns a cursor over
+// the results. The caller must close the cursor before the transaction is closed.
+func (tx *Tx) Query(stmt pieql.Statement) (*Cursor, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	} else if err := tx.ctx.Err(); err != nil {
+		return nil, err
+	} else if stmt, ok := stmt.(*pieql.SelectStatement); ok {
+		return tx.newSelectCursor(stmt)
+	}
+
+	// Other statements are executed immediately.
+	res, err := tx.Execute(stmt)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = f.Close() }()
+	return newResultCursor(res), nil
+}
 
-	// Decode rows from disk.
-	var rows [][]string
-	if err := json.NewDecoder(f).Decode(&rows); err != nil {
+// Execute executes a statement within the transaction and returns all of the results.
+func (tx *Tx) Execute(stmt pieql.Statement) (*Result, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	} else if !isReadStatement(stmt) && !tx.writable {
+		return nil, ErrTxNotWritable
+	} else if err := tx.ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	return rows, nil
+	switch stmt := stmt.(type) {
+	case *pieql.SelectStatement:
+		return tx.executeSelectStatement(stmt)
+	case *pieql.InsertStatement:
+		return tx.executeInsertStatement(stmt)
+	case *pieql.UpdateStatement:
+		return tx.executeUpdateStatement(stmt)
+	case *pieql.DeleteStatement:
+		return tx.executeDeleteStatement(stmt)
+	case *pieql.CreateTableStatement:
+		return tx.executeCreateTableStatement(stmt)
+	case *pieql.CreateIndexStatement:
+		return tx.executeCreateIndexStatement(stmt)
+	case *pieql.DropTableStatement:
+		return tx.executeDropTableStatement(stmt)
+	case *pieql.ShowTablesStatement:
+		return tx.executeShowTablesStatement(stmt)
+	case *pieql.DescribeTableStatement:
+		return tx.executeDescribeTableStatement(stmt)
+	case *pieql.ExplainStatement:
+		return tx.executeExplainStatement(stmt)
+	}
+	return nil, fmt.Errorf("unsupported statement: %s", stmt)
 }
 
-// SetTableRows sets the rows on a table and saves the rows to disk.
-func (db *Database) SetTableRows(name string, rows [][]string) error {
-	// Verify database is open.
-	if db.path == "" {
-		return ErrNotOpen
+// newResultCursor returns a cursor over the rows of a result.
+func newResultCursor(res *Result) *Cursor {
+	return &Cursor{Columns: res.Columns, RowsAffected: res.RowsAffected, itr: &rowSliceIterator{rows: res.Rows}}
+}
+
+// executeCreateTableStatement creates a table with the statement's columns.
+func (tx *Tx) executeCreateTableStatement(stmt *pieql.CreateTableStatement) (*Result, error) {
+	var columns []*Column
+	for _, def := range stmt.Columns {
+		c := &Column{Name: def.Name, Type: ColumnType(def.Type)}
+		if !c.Type.IsValid() {
+			return nil, fmt.Errorf("invalid column type: %s", def.Type)
+		}
+		columns = append(columns, c)
 	}
 
-	// Open data file for writing.
-	f, err := os.Create(filepath.Join(db.dataPath(), name))
-	if err != nil {
-		return err
+	if err := tx.CreateTable(stmt.Name, columns); err != nil {
+		return nil, err
 	}
-	defer func() { _ = f.Close() }()
+	return &Result{}, nil
+}
 
-	// Encode rows to disk.
-	if err := json.NewEncoder(f).Encode(rows); err != nil {
-		return err
+// executeDropTableStatement deletes a table.
+func (tx *Tx) executeDropTableStatement(stmt *pieql.DropTableStatement) (*Result, error) {
+	if err := tx.DeleteTable(stmt.Name); err == ErrTableNotFound && stmt.IfExists {
+		return &Result{}, nil
+	} else if err != nil {
+		return nil, err
 	}
+	return &Result{}, nil
+}
 
-	return nil
+// executeShowTablesStatement returns the name of every table.
+func (tx *Tx) executeShowTablesStatement(stmt *pieql.ShowTablesStatement) (*Result, error) {
+	result := &Result{Columns: []string{"name"}}
+	for _, t := range tx.Tables() {
+		result.Rows = append(result.Rows, []string{t.Name})
+	}
+	return result, nil
 }
 
-// Execute executes a SELECT statement and returns the results.
-func (db *Database) Execute(stmt *pieql.SelectStatement) ([][]string, error) {
-	// Lookup table by name.
-	t := db.Table(stmt.Source)
+// executeDescribeTableStatement returns the name & type of every column in a table.
+func (tx *Tx) executeDescribeTableStatement(stmt *pieql.DescribeTableStatement) (*Result, error) {
+	t := tx.Table(stmt.Name)
 	if t == nil {
 		return nil, ErrTableNotFound
 	}
 
-	// Expand out SELECT ALL.
-	if len(stmt.Fields) > 0 && stmt.Fields[0].Name == "*" {
-		stmt.Fields = nil
-		for _, c := range t.Columns {
-			stmt.Fields = append(stmt.Fields, &pieql.Field{Name: c.Name})
-		}
+	result := &Result{Columns: []string{"name", "type"}}
+	for _, c := range t.Columns {
+		result.Rows = append(result.Rows, []string{c.Name, string(c.Type)})
 	}
+	return result, nil
+}
 
-	// Retrieve rows for table.
-	rows, err := db.TableRows(stmt.Source)
+// executeSelectStatement retrieves all result rows from one or more tables.
+func (tx *Tx) executeSelectStatement(stmt *pieql.SelectStatement) (*Result, error) {
+	cur, err := tx.newSelectCursor(stmt)
 	if err != nil {
 		return nil, err
 	}
+	defer func() { _ = cur.Close() }()
 
-	// Iterate over all the table rows.
-	var result [][]string
-	for _, row := range rows {
-		resultRow := make([]string, len(stmt.Fields))
+	rows, err := readRows(cur)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Columns: cur.Columns, Rows: rows}, nil
+}
 
-		// Lookup row value by field name for each field.
-		for i, f := range stmt.Fields {
-			// Lookup column index.
-			index := t.ColumnIndex(f.Name)
-			if index == -1 {
-				return nil, fmt.Errorf("column not found: %s", f.Name)
+// newSelectCursor returns a cursor that retrieves rows from one or more tables.
+// Rows are computed by the statement's plan as they are read.
+func (tx *Tx) newSelectCursor(stmt *pieql.SelectStatement) (*Cursor, error) {
+	plan, err := tx.planSelect(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	itr, err := plan.root.rowIterator(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build header from fields.
+	cur := &Cursor{itr: itr}
+	for _, f := range plan.stmt.Fields {
+		cur.Columns = append(cur.Columns, f.Name())
+	}
+	return cur, nil
+}
+
+// validateStatement returns an error if stmt cannot be executed against the scope.
+func validateStatement(sc *scope, stmt *pieql.SelectStatement) error {
+	// Verify that all referenced columns exist.
+	nodes := []pieql.Node{stmt.Fields, stmt.Condition, stmt.Having}
+	for _, j := range stmt.Joins {
+		nodes = append(nodes, j.Condition)
+	}
+	for _, expr := range stmt.GroupBy {
+		nodes = append(nodes, expr)
+	}
+	for _, node := range nodes {
+		if err := validateVarRefs(sc, node); err != nil {
+			return err
+		}
+	}
+
+	// Sort fields can reference output fields or table columns.
+	for _, f := range stmt.SortFields {
+		if sortField(stmt, f) != nil {
+			continue
+		} else if err := validateVarRefs(sc, sortExpr(stmt, f)); err != nil {
+			return err
+		}
+	}
+
+	// Aggregates cannot be used to join, filter or group rows.
+	for _, j := range stmt.Joins {
+		if pieql.HasCall(j.Condition) {
+			return errors.New("aggregate functions are not allowed in ON")
+		}
+	}
+	if pieql.HasCall(stmt.Condition) {
+		return errors.New("aggregate functions are not allowed in WHERE")
+	}
+	for _, expr := range stmt.GroupBy {
+		if pieql.HasCall(expr) {
+			return errors.New("aggregate functions are not allowed in GROUP BY")
+		}
+	}
+
+	// Verify function calls and wildcards.
+	if err := validateCalls(stmt); err != nil {
+		return err
+	}
+
+	// Non-aggregated fields must be grouped.
+	if stmt.IsAggregate() {
+		for _, f := range stmt.Fields {
+			if ref := findUngroupedRef(f.Expr, stmt.GroupBy); ref != nil {
+				return fmt.Errorf("column must appear in GROUP BY or be used in an aggregate: %s", ref)
 			}
+		}
+	}
+
+	return nil
+}
 
-			// Set result cell value.
-			resultRow[i] = row[index]
+// referencedColumns returns the positions of the columns referenced by the
+// statement within each table in the scope.
+func referencedColumns(sc *scope, stmt *pieql.SelectStatement) [][]int {
+	nodes := []pieql.Node{stmt.Fields, stmt.Condition, stmt.Having}
+	for _, j := range stmt.Joins {
+		nodes = append(nodes, j.Condition)
+	}
+	for _, expr := range stmt.GroupBy {
+		nodes = append(nodes, expr)
+	}
+	for _, f := range stmt.SortFields {
+		nodes = append(nodes, sortExpr(stmt, f))
+	}
+
+	columns := make([][]int, len(sc.tables))
+	for i := range columns {
+		columns[i] = []int{}
+	}
+	seen := make(map[*scopeColumn]bool)
+	for _, node := range nodes {
+		pieql.WalkFunc(node, func(n pieql.Node) {
+			ref, ok := n.(*pieql.VarRef)
+			if !ok {
+				return
+			}
+			if c, err := sc.lookup(ref.String()); err == nil && !seen[c] {
+				seen[c] = true
+				columns[c.table] = append(columns[c.table], c.index)
+			}
+		})
+	}
+	return columns
+}
+
+// sourceCondition returns the parts of a condition that only reference the
+// source table, with column references unqualified. Returns nil if no part
+// of the condition can be evaluated against the source table alone.
+func sourceCondition(sc *scope, condition pieql.Expr) pieql.Expr {
+	var expr pieql.Expr
+	for _, e := range conjuncts(condition) {
+		if pieql.HasCall(e) {
+			continue
+		} else if tables := sc.tablesIn(e); len(tables) != 1 || !tables[0] {
+			continue
 		}
 
-		// Add output row to the result.
-		result = append(result, resultRow)
+		e = pieql.RewriteExpr(e, func(e pieql.Expr) pieql.Expr {
+			if ref, ok := e.(*pieql.VarRef); ok && ref.Table != "" {
+				return &pieql.VarRef{Val: ref.Val}
+			}
+			return e
+		})
+		if expr == nil {
+			expr = e
+		} else {
+			expr = &pieql.BinaryExpr{Op: pieql.AND, LHS: expr, RHS: e}
+		}
 	}
+	return expr
+}
 
-	return result, nil
+// conjuncts splits an expression into the expressions joined by AND.
+func conjuncts(expr pieql.Expr) []pieql.Expr {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case *pieql.ParenExpr:
+		return conjuncts(e.Expr)
+	case *pieql.BinaryExpr:
+		if e.Op == pieql.AND {
+			return append(conjuncts(e.LHS), conjuncts(e.RHS)...)
+		}
+	}
+	return []pieql.Expr{expr}
 }
 
-// MarshalJSON encodes the database metadata as JSON.
-func (db *Database) MarshalJSON() ([]byte, error) {
-	var dm databaseJSONMarshaler
-	for _, t := range db.tables {
-		tm := &tableJSONMarshaler{
-			Name:    t.Name,
-			Columns: t.Columns,
+// validateVarRefs returns an error if node references a column that is not
+// in the scope or that is ambiguous.
+func validateVarRefs(sc *scope, node pieql.Node) (err error) {
+	pieql.WalkFunc(node, func(n pieql.Node) {
+		if ref, ok := n.(*pieql.VarRef); ok && err == nil {
+			_, err = sc.lookup(ref.String())
+		}
+	})
+	return
+}
+
+// recordSorter sorts records by one or more sort fields.
+// Keys holding only numbers are sorted numerically and keys from text columns
+// are sorted lexically. Other keys are sorted by type with missing values first.
+type recordSorter struct {
+	records   []pieql.Valuer
+	keys      [][]interface{}
+	modes     []sortMode
+	ascending []bool
+}
+
+// sortMode represents how the keys of a single sort field are compared.
+type sortMode int
+
+const (
+	sortByValue sortMode = iota
+	sortNumeric
+	sortLexical
+)
+
+// newRecordSorter returns a sorter for records ordered by the statement's sort fields.
+// Sort fields matching an output field sort by that field's value.
+func newRecordSorter(sc *scope, stmt *pieql.SelectStatement, records []pieql.Valuer) *recordSorter {
+	s := &recordSorter{
+		records: records,
+		keys:    make([][]interface{}, len(records)),
+	}
+
+	for _, f := range stmt.SortFields {
+		// Determine the expression to sort by.
+		expr := sortExpr(stmt, f)
+
+		// Compute the key for every record.
+		numeric := true
+		for i, v := range records {
+			key := pieql.Eval(expr, v)
+			if _, ok := toNumber(key); !ok {
+				numeric = false
+			}
+			s.keys[i] = append(s.keys[i], key)
+		}
+
+		// Determine how the keys should be compared.
+		mode := sortByValue
+		if sc.isTextColumn(expr) {
+			mode = sortLexical
+		} else if numeric {
+			mode = sortNumeric
+		}
+
+		s.modes = append(s.modes, mode)
+		s.ascending = append(s.ascending, f.Ascending)
+	}
+	return s
+}
+
+// sortField returns the output field an unqualified sort field refers to, if any.
+func sortField(stmt *pieql.SelectStatement, f *pieql.SortField) *pieql.Field {
+	if f.Table != "" {
+		return nil
+	}
+	return stmt.Fields.Field(f.Name)
+}
+
+// sortExpr returns the expression to sort by for a sort field. This is the
+// expression of the matching output field or a reference to a table column.
+func sortExpr(stmt *pieql.SelectStatement, f *pieql.SortField) pieql.Expr {
+	if field := sortField(stmt, f); field != nil {
+		return field.Expr
+	}
+	return &pieql.VarRef{Table: f.Table, Val: f.Name}
+}
+
+func (s *recordSorter) Len() int { return len(s.records) }
+
+func (s *recordSorter) Swap(i, j int) {
+	s.records[i], s.records[j] = s.records[j], s.records[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func (s *recordSorter) Less(i, j int) bool {
+	for k, mode := range s.modes {
+		a, b := s.keys[i][k], s.keys[j][k]
+
+		// Compare the keys based on the sort mode.
+		var cmp int
+		switch mode {
+		case sortNumeric:
+			x, _ := toNumber(a)
+			y, _ := toNumber(b)
+			if x < y {
+				cmp = -1
+			} else if x > y {
+				cmp = 1
+			}
+		case sortLexical:
+			cmp = strings.Compare(formatValue(a), formatValue(b))
+		default:
+			cmp = compareValues(a, b)
+		}
+
+		// Move on to the next key if the values are equal.
+		if cmp == 0 {
+			continue
+		} else if !s.ascending[k] {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return false
+}
+
+// compareValues compares two values by type. Missing values sort first and
+// values that cannot be compared by type are compared as strings.
+func compareValues(a, b interface{}) int {
+	if a == nil && b == nil {
+		return 0
+	} else if a == nil {
+		return -1
+	} else if b == nil {
+		return 1
+	} else if cmp, ok := pieql.Compare(a, b); ok {
+		return cmp
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+// toNumber converts a value to a float64, if possible.
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// evalCell returns the result of an expression as a cell. Column references
+// return the stored cell so that values such as "007" or "1.50" are kept as
+// written. Other expressions are formatted from their computed value.
+func evalCell(expr pieql.Expr, v pieql.Valuer) string {
+	if ref, ok := expr.(*pieql.VarRef); ok {
+		if cv, ok := v.(cellValuer); ok {
+			if cell, ok := cv.cell(ref.String()); ok {
+				return cell
+			}
+		}
+	}
+	return formatValue(pieql.Eval(expr, v))
+}
+
+// cellValuer represents a record that can return its stored cells.
+type cellValuer interface {
+	// cell returns the stored cell for a column reference.
+	cell(key string) (string, bool)
+}
+
+// formatValue returns the string representation of a value in a result.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		// Write dates without a time of day in short form.
+		if h, m, sec := v.Clock(); h == 0 && m == 0 && sec == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return ""
+}
+
+// scope represents the columns available to a statement's expressions.
+// Columns can be referenced by name if the name is unique across all tables
+// or qualified by the table name or alias.
+type scope struct {
+	tables  []*Table
+	sources []*pieql.Source
+
+	columns []scopeColumn
+	keys    map[string]int // reference to column position; -1 if ambiguous
+}
+
+// scopeColumn represents a column from one of the tables in a scope.
+type scopeColumn struct {
+	table  int // table position within the scope
+	index  int // column position within the table
+	column *Column
+}
+
+// newScope returns a scope for the statement's source & joined tables.
+func (tx *Tx) newScope(stmt *pieql.SelectStatement) (*scope, error) {
+	sc := &scope{keys: make(map[string]int)}
+
+	sources := []*pieql.Source{stmt.Source}
+	for _, j := range stmt.Joins {
+		sources = append(sources, j.Source)
+	}
+
+	for i, src := range sources {
+		// Lookup table by name.
+		t := tx.Table(src.Name)
+		if t == nil {
+			return nil, ErrTableNotFound
+		}
+
+		// Table names & aliases must be unique within a statement.
+		for _, other := range sc.sources {
+			if other.Qualifier() == src.Qualifier() {
+				return nil, fmt.Errorf("duplicate table name: %s", src.Qualifier())
+			}
+		}
+		sc.tables = append(sc.tables, t)
+		sc.sources = append(sc.sources, src)
+
+		// Add a qualified & unqualified reference for each column.
+		for index, c := range t.Columns {
+			pos := len(sc.columns)
+			sc.columns = append(sc.columns, scopeColumn{table: i, index: index, column: c})
+			sc.keys[(&pieql.VarRef{Table: src.Qualifier(), Val: c.Name}).String()] = pos
+
+			key := (&pieql.VarRef{Val: c.Name}).String()
+			if _, ok := sc.keys[key]; ok {
+				sc.keys[key] = -1
+			} else {
+				sc.keys[key] = pos
+			}
 		}
-		dm.Tables = append(dm.Tables, tm)
 	}
-	return json.Marshal(dm)
+
+	return sc, nil
+}
+
+// lookup returns the column for a reference.
+// Returns an error if the column is not found or is ambiguous.
+func (sc *scope) lookup(key string) (*scopeColumn, error) {
+	pos, ok := sc.keys[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrColumnNotFound, key)
+	} else if pos == -1 {
+		return nil, fmt.Errorf("ambiguous column: %s", key)
+	}
+	return &sc.columns[pos], nil
+}
+
+// fields returns a field for every column in the scope.
+// Columns are qualified if the scope has more than one table.
+func (sc *scope) fields() pieql.Fields {
+	var fields pieql.Fields
+	for _, c := range sc.columns {
+		ref := &pieql.VarRef{Val: c.column.Name}
+		if len(sc.tables) > 1 {
+			ref.Table = sc.sources[c.table].Qualifier()
+		}
+		fields = append(fields, &pieql.Field{Expr: ref})
+	}
+	return fields
+}
+
+// tablesIn returns the positions of the tables referenced by expr.
+func (sc *scope) tablesIn(expr pieql.Expr) map[int]bool {
+	m := make(map[int]bool)
+	pieql.WalkFunc(expr, func(n pieql.Node) {
+		if ref, ok := n.(*pieql.VarRef); ok {
+			if c, err := sc.lookup(ref.String()); err == nil {
+				m[c.table] = true
+			}
+		}
+	})
+	return m
+}
+
+// isTextColumn returns true if expr references a column explicitly typed as text.
+func (sc *scope) isTextColumn(expr pieql.Expr) bool {
+	ref, ok := expr.(*pieql.VarRef)
+	if !ok {
+		return false
+	}
+	c, err := sc.lookup(ref.String())
+	return err == nil && c.column.Type == TextType
+}
+
+// rowValuer resolves column references against a row from each table in a scope.
+type rowValuer struct {
+	scope *scope
+	rows  [][]string // one row per table; nil for unmatched outer joins
+}
+
+// Value returns the cell value for the referenced column, converted to the
+// column's type. Cells that don't match the column's type are returned as nil.
+func (v *rowValuer) Value(key string) (interface{}, bool) {
+	c, err := v.scope.lookup(key)
+	if err != nil || c.table >= len(v.rows) {
+		return nil, false
+	}
+
+	// Missing rows from outer joins have no values.
+	row := v.rows[c.table]
+	if row == nil || c.index >= len(row) {
+		return nil, true
+	}
+
+	value, _ := c.column.ParseValue(row[c.index])
+	return value, true
+}
+
+// cell returns the stored cell for the referenced column. Missing rows from
+// outer joins return a blank cell.
+func (v *rowValuer) cell(key string) (string, bool) {
+	c, err := v.scope.lookup(key)
+	if err != nil || c.table >= len(v.rows) {
+		return "", false
+	}
+
+	row := v.rows[c.table]
+	if row == nil || c.index >= len(row) {
+		return "", true
+	}
+	return row[c.index], true
+}
+
+// MarshalJSON encodes the database metadata as JSON.
+func (db *Database) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newDatabaseJSONMarshaler(db.Storage.Name(), db.Tables()))
 }
 
 // UnmarshalJSON decodes the JSON as database metadata.
@@ -268,12 +1115,10 @@ func (db *Database) UnmarshalJSON(data []byte) error {
 	}
 
 	// Copy marshaled data to internal types.
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	db.tables = make(map[string]*Table)
-	for _, tm := range dm.Tables {
-		t := &Table{
-			Name:    tm.Name,
-			Columns: tm.Columns,
-		}
+	for _, t := range dm.tables() {
 		db.tables[t.Name] = t
 	}
 
@@ -281,15 +1126,88 @@ func (db *Database) UnmarshalJSON(data []byte) error {
 }
 
 type databaseJSONMarshaler struct {
-	Tables []*tableJSONMarshaler `json:"tables"`
+	Format  int                   `json:"format,omitempty"`
+	Storage string                `json:"storage,omitempty"`
+	Tables  []*tableJSONMarshaler `json:"tables"`
+}
+
+// newDatabaseJSONMarshaler returns the metadata for a set of tables. The
+// storage name is omitted for the default row storage.
+func newDatabaseJSONMarshaler(storage string, tables []*Table) *databaseJSONMarshaler {
+	dm := &databaseJSONMarshaler{}
+	if storage != "row" {
+		dm.Storage = storage
+	}
+	for _, t := range tables {
+		dm.Tables = append(dm.Tables, &tableJSONMarshaler{
+			Name:       t.Name,
+			Columns:    t.Columns,
+			PrimaryKey: t.PrimaryKey,
+			Indexes:    t.Indexes,
+			Data:       t.key,
+			Version:    t.version,
+		})
+	}
+	return dm
+}
+
+// tables returns the tables from the marshaled metadata.
+func (dm *databaseJSONMarshaler) tables() []*Table {
+	var a []*Table
+	for _, tm := range dm.Tables {
+		a = append(a, &Table{
+			Name:       tm.Name,
+			Columns:    tm.Columns,
+			PrimaryKey: tm.PrimaryKey,
+			Indexes:    tm.Indexes,
+			key:        tm.Data,
+			version:    tm.Version,
+		})
+	}
+	return a
 }
 
 // Table represents a tabular set of data.
 type Table struct {
 	Name    string
 	Columns []*Column
+	Indexes []*IndexDefinition
+
+	// Names of the columns that identify each row. Cells in the primary key
+	// are required and no two rows can have the same values.
+	PrimaryKey []string
+
+	// Key that the table's rows are stored under. Rows are stored under
+	// the table's name if blank.
+	key string
+
+	// Incremented each time the table's rows change. Indexes record the
+	// version they were built from so that stale indexes aren't used.
+	version int
 }
 
+// dataKey returns the key that the table's rows are stored under.
+func (t *Table) dataKey() string {
+	if t.key == "" {
+		return t.Name
+	}
+	return t.key
+}
+
+// withKey returns a copy of the table with rows stored under key.
+func (t *Table) withKey(key string) *Table {
+	other := *t
+	other.key = key
+	return &other
+}
+
+// tables represents a list of tables sortable by name.
+type tables []*Table
+
+func (a tables) Len() int           { return len(a) }
+func (a tables) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a tables) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
 // ColumnIndex returns the position of the column by name.
 // Returns -1 if column is not found.
 func (t *Table) ColumnIndex(name string) int {
@@ -301,12 +1219,118 @@ func (t *Table) ColumnIndex(name string) int {
 	return -1
 }
 
+// hasConstraints returns true if any rows could be rejected or changed by
+// the table's constraints.
+func (t *Table) hasConstraints() bool {
+	if len(t.PrimaryKey) > 0 {
+		return true
+	}
+	for _, c := range t.Columns {
+		if c.NotNull || c.Unique || c.Default != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Index returns an index by name. Returns nil if the index is not found.
+func (t *Table) Index(name string) *IndexDefinition {
+	for _, idx := range t.Indexes {
+		if idx.Name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// indexOn returns the first index on a column. Returns nil if the column
+// isn't indexed.
+func (t *Table) indexOn(column string) *IndexDefinition {
+	for _, idx := range t.Indexes {
+		if idx.Column == column {
+			return idx
+		}
+	}
+	return nil
+}
+
 // Column represents a column in a table.
 type Column struct {
-	Name string `json:"name"`
+	Name string     `json:"name"`
+	Type ColumnType `json:"type,omitempty"`
+
+	// Constraints on the column's cells. Empty cells are replaced by the
+	// default, if set, and are rejected if the column is required.
+	// Empty cells aren't compared by unique columns.
+	NotNull bool   `json:"not_null,omitempty"`
+	Unique  bool   `json:"unique,omitempty"`
+	Default string `json:"default,omitempty"`
+}
+
+// ColumnType represents the data type of the values in a column.
+type ColumnType string
+
+// Column types. Columns without a type hold untyped text.
+const (
+	IntegerType   ColumnType = "integer"
+	FloatType     ColumnType = "float"
+	BooleanType   ColumnType = "boolean"
+	TimestampType ColumnType = "timestamp"
+	TextType      ColumnType = "text"
+)
+
+// IsValid returns true if typ is a known column type or blank.
+func (typ ColumnType) IsValid() bool {
+	switch typ {
+	case "", IntegerType, FloatType, BooleanType, TimestampType, TextType:
+		return true
+	}
+	return false
+}
+
+// ParseValue converts a cell to the column's type.
+// Empty cells in typed columns are returned as nil.
+func (c *Column) ParseValue(s string) (interface{}, error) {
+	switch c.Type {
+	case "", TextType:
+		return s, nil
+	}
+
+	// Empty cells represent missing values.
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	switch c.Type {
+	case IntegerType:
+		v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %q", s)
+		}
+		return v, nil
+	case FloatType:
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float: %q", s)
+		}
+		return v, nil
+	case BooleanType:
+		return pieql.ParseBool(s)
+	case TimestampType:
+		v, err := pieql.ParseTime(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %q", s)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid column type: %s", c.Type)
 }
 
 type tableJSONMarshaler struct {
-	Name    string    `json:"name"`
-	Columns []*Column `json:"columns"`
+	Name       string             `json:"name"`
+	Columns    []*Column          `json:"columns"`
+	PrimaryKey []string           `json:"primary_key,omitempty"`
+	Indexes    []*IndexDefinition `json:"indexes,omitempty"`
+	Data       string             `json:"data,omitempty"`
+	Version    int                `json:"version,omitempty"`
 }
@@ -1,10 +1,13 @@
 package pie_test
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -61,15 +64,52 @@ func TestDatabase_CreateTable(t *testing.T) {
 
 // Ensure the database returns an error when creating a table without a name.
 func TestDatabase_CreateTable_ErrTableNameRequired(t *testing.T) {
-	db := pie.NewDatabase()
+	db := OpenMemDatabase()
+	defer db.Close()
 	if err := db.CreateTable("", nil); err != pie.ErrTableNameRequired {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
+// Ensure the database rejects table names that can't be used as file names.
+func TestDatabase_CreateTable_ErrInvalidTableName(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	// Write a file alongside the database that a bad name could reach.
+	sibling := filepath.Join(filepath.Dir(db.Path()), filepath.Base(db.Path())+"-sibling")
+	if err := ioutil.WriteFile(sibling, []byte("x"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(sibling)
+
+	for i, name := range []string{".", "..", "a/b", `a\b`, "../" + filepath.Base(sibling), "a\x00", "foo.tmp", "foo.old"} {
+		if err := db.CreateTable(name, []*pie.Column{{Name: "a"}}); err != pie.ErrInvalidTableName {
+			t.Errorf("%d. %q: unexpected error: %v", i, name, err)
+		}
+	}
+
+	// Quoted identifiers are checked the same way.
+	for i, s := range []string{`CREATE TABLE ".." (a)`, `CREATE TABLE "../../` + filepath.Base(sibling) + `" (a)`} {
+		if _, err := db.Execute(MustParseStatement(s)); err != pie.ErrInvalidTableName {
+			t.Errorf("%d. %s: unexpected error: %v", i, s, err)
+		}
+	}
+
+	// Verify nothing outside the data directory was touched.
+	if _, err := os.Stat(filepath.Join(db.Path(), "data")); err != nil {
+		t.Fatal(err)
+	} else if _, err := os.Stat(sibling); err != nil {
+		t.Fatal(err)
+	} else if tables := db.Tables(); len(tables) != 0 {
+		t.Fatalf("unexpected tables: %d", len(tables))
+	}
+}
+
 // Ensure the database returns an error when creating a duplicate table.
 func TestDatabase_CreateTable_ErrTableExists(t *testing.T) {
-	db := pie.NewDatabase()
+	db := OpenMemDatabase()
+	defer db.Close()
 	db.CreateTable("foo", nil)
 	if err := db.CreateTable("foo", nil); err != pie.ErrTableExists {
 		t.Fatalf("unexpected error: %v", err)
@@ -78,7 +118,8 @@ func TestDatabase_CreateTable_ErrTableExists(t *testing.T) {
 
 // Ensure the database can delete a table.
 func TestDatabase_DeleteTable(t *testing.T) {
-	db := pie.NewDatabase()
+	db := OpenMemDatabase()
+	defer db.Close()
 
 	// Create the table and verify it exists.
 	if err := db.CreateTable("foo", nil); err != nil {
@@ -97,7 +138,8 @@ func TestDatabase_DeleteTable(t *testing.T) {
 
 // Ensure the database returns an error when deleting a table without a name.
 func TestDatabase_DeleteTable_ErrTableNameRequired(t *testing.T) {
-	db := pie.NewDatabase()
+	db := OpenMemDatabase()
+	defer db.Close()
 	if err := db.DeleteTable(""); err != pie.ErrTableNameRequired {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -105,12 +147,178 @@ func TestDatabase_DeleteTable_ErrTableNameRequired(t *testing.T) {
 
 // Ensure the database returns an error when deleting a table that doesn't exist.
 func TestDatabase_DeleteTable_ErrTableNotFound(t *testing.T) {
-	db := pie.NewDatabase()
+	db := OpenMemDatabase()
+	defer db.Close()
 	if err := db.DeleteTable("no_such_table"); err != pie.ErrTableNotFound {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
 
+// Ensure a table can be renamed and keeps its rows & indexes.
+func TestDatabase_RenameTable(t *testing.T) {
+	path := tempfile()
+	defer os.RemoveAll(path)
+	db := pie.NewDatabase()
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.CreateTable("foo", []*pie.Column{{Name: "id", Type: pie.IntegerType}})
+	db.SetTableRows("foo", [][]string{{"1"}, {"2"}})
+	if err := db.CreateIndex("foo", "by_id", "id"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename the table and reuse the old name.
+	if err := db.RenameTable("foo", "bar"); err != nil {
+		t.Fatal(err)
+	} else if db.Table("foo") != nil {
+		t.Fatal("unexpected table: foo")
+	} else if err := db.CreateTable("foo", []*pie.Column{{Name: "name"}}); err != nil {
+		t.Fatal(err)
+	} else if err := db.SetTableRows("foo", [][]string{{"susy"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify both tables keep their rows after reopening.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if rows, err := db.TableRows("bar"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	} else if rows, _ := db.TableRows("foo"); !reflect.DeepEqual(rows, [][]string{{"susy"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+
+	// Verify the index is still used.
+	res, err := db.Execute(MustParseStatement(`SELECT id FROM bar WHERE id = 2`))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"2"}}) {
+		t.Fatalf("unexpected rows: %#v", res.Rows)
+	}
+}
+
+// Ensure the database returns an error when a table can't be renamed.
+func TestDatabase_RenameTable_Err(t *testing.T) {
+	db := OpenMemDatabase()
+	defer db.Close()
+	db.CreateTable("foo", nil)
+	db.CreateTable("bar", nil)
+
+	for i, tt := range []struct {
+		name    string
+		newName string
+		err     error
+	}{
+		{name: "", newName: "baz", err: pie.ErrTableNameRequired},
+		{name: "foo", newName: "", err: pie.ErrTableNameRequired},
+		{name: "foo", newName: "..", err: pie.ErrInvalidTableName},
+		{name: "foo", newName: "a/b", err: pie.ErrInvalidTableName},
+		{name: "no_such_table", newName: "baz", err: pie.ErrTableNotFound},
+		{name: "foo", newName: "bar", err: pie.ErrTableExists},
+	} {
+		if err := db.RenameTable(tt.name, tt.newName); err != tt.err {
+			t.Fatalf("%d. unexpected error: %v", i, err)
+		}
+	}
+}
+
+// Ensure statements stop executing once their context is done.
+func TestDatabase_ExecuteContext(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"susy"}, {"bob"}, {"jim"}})
+
+	// Statements aren't executed with a canceled context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.ExecuteContext(ctx, MustParseStatement(`SELECT name FROM foo ORDER BY name`)); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := db.ExecuteContext(ctx, MustParseStatement(`DELETE FROM foo`)); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	} else if rows, _ := db.TableRows("foo"); len(rows) != 3 {
+		t.Fatalf("unexpected row count: %d", len(rows))
+	}
+
+	// Reading a cursor stops once its context is canceled.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	cur, err := db.QueryContext(ctx, MustParseStatement(`SELECT name FROM foo`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	if row, err := cur.Next(); err != nil || !reflect.DeepEqual(row, []string{"susy"}) {
+		t.Fatalf("unexpected row: %v, %v", row, err)
+	}
+	cancel()
+	if _, err := cur.Next(); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure a transaction can't be committed once its context is done.
+func TestTx_Commit_ErrContextDone(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.BeginContext(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := tx.CreateTable("foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := tx.Commit(); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	} else if db.Table("foo") != nil {
+		t.Fatal("unexpected table")
+	}
+}
+
+// Ensure the database returns an error when used before it is opened.
+func TestDatabase_ErrNotOpen(t *testing.T) {
+	db := pie.NewDatabase()
+	if err := db.CreateTable("foo", nil); err != pie.ErrNotOpen {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db.DeleteTable("foo"); err != pie.ErrNotOpen {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := db.TableRows("foo"); err != pie.ErrNotOpen {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db.SetTableRows("foo", nil); err != pie.ErrNotOpen {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := db.Execute(MustParseStatement(`SHOW TABLES`)); err != pie.ErrNotOpen {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure an in-memory database keeps its tables & rows when reopened.
+func TestDatabase_MemStorage(t *testing.T) {
+	db := OpenMemDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}})
+	db.SetTableRows("foo", [][]string{{"1"}})
+	db.AppendTableRows("foo", [][]string{{"2"}})
+
+	if err := db.Database.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := db.Open(""); err != nil {
+		t.Fatal(err)
+	} else if res, err := db.Execute(MustParseStatement(`SELECT a FROM foo`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"1"}, {"2"}}) {
+		t.Fatalf("unexpected rows: %#v", res.Rows)
+	}
+}
+
 // Ensure the database can execute a selection query.
 func TestDatabase_Execute(t *testing.T) {
 	// Create database and seed table.
@@ -135,21 +343,654 @@ func TestDatabase_Execute(t *testing.T) {
 	}
 
 	// Verify results.
-	if len(res) != 2 {
-		t.Fatalf("result len mismatch: %d", len(res))
-	} else if !reflect.DeepEqual(res[0], []string{"que", "susy"}) {
-		t.Fatalf("row(0) mismatch: %#v", res[0])
-	} else if !reflect.DeepEqual(res[1], []string{"smith", "bob"}) {
-		t.Fatalf("row(1) mismatch: %#v", res[1])
+	if len(res.Rows) != 2 {
+		t.Fatalf("result len mismatch: %d", len(res.Rows))
+	} else if !reflect.DeepEqual(res.Rows[0], []string{"que", "susy"}) {
+		t.Fatalf("row(0) mismatch: %#v", res.Rows[0])
+	} else if !reflect.DeepEqual(res.Rows[1], []string{"smith", "bob"}) {
+		t.Fatalf("row(1) mismatch: %#v", res.Rows[1])
+	}
+}
+
+// Ensure the database can filter rows using a condition.
+func TestDatabase_Execute_Condition(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}, {Name: "age"}})
+	db.SetTableRows("foo", [][]string{
+		{"susy", "8"},
+		{"bob", "31"},
+		{"jim", "12"},
+	})
+
+	// Parse PieQL statement.
+	stmt, err := pieql.NewParser(strings.NewReader(`SELECT name FROM foo WHERE age > 10 AND name != 'bob'`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute statement and verify results.
+	if res, err := db.Execute(stmt); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"jim"}}) {
+		t.Fatalf("unexpected results: %#v", res.Rows)
+	}
+}
+
+// Ensure the database returns an error when a condition references an unknown column.
+func TestDatabase_Execute_Condition_ErrColumnNotFound(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"susy"}})
+
+	stmt, err := pieql.NewParser(strings.NewReader(`SELECT name FROM foo WHERE age > 10`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Execute(stmt); err == nil || err.Error() != "column not found: age" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the database can sort and page through results.
+func TestDatabase_Execute_OrderBy(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}, {Name: "age"}, {Name: "state"}})
+	db.SetTableRows("foo", [][]string{
+		{"susy", "8", "CO"},
+		{"bob", "31", "NY"},
+		{"jim", "12", "CO"},
+		{"ann", "100", "NY"},
+	})
+
+	var tests = []struct {
+		q   string
+		res [][]string
+	}{
+		// Numeric columns sort numerically.
+		{q: `SELECT name FROM foo ORDER BY age`, res: [][]string{{"susy"}, {"jim"}, {"bob"}, {"ann"}}},
+		{q: `SELECT name FROM foo ORDER BY age DESC`, res: [][]string{{"ann"}, {"bob"}, {"jim"}, {"susy"}}},
+
+		// Text columns sort lexically.
+		{q: `SELECT name FROM foo ORDER BY name`, res: [][]string{{"ann"}, {"bob"}, {"jim"}, {"susy"}}},
+
+		// Multiple sort fields.
+		{q: `SELECT name FROM foo ORDER BY state DESC, age`, res: [][]string{{"bob"}, {"ann"}, {"susy"}, {"jim"}}},
+
+		// Limit & offset.
+		{q: `SELECT name FROM foo ORDER BY name LIMIT 2`, res: [][]string{{"ann"}, {"bob"}}},
+		{q: `SELECT name FROM foo ORDER BY name LIMIT 2 OFFSET 1`, res: [][]string{{"bob"}, {"jim"}}},
+		{q: `SELECT name FROM foo LIMIT 0`, res: nil},
+		{q: `SELECT name FROM foo ORDER BY name OFFSET 3`, res: [][]string{{"susy"}}},
+		{q: `SELECT name FROM foo OFFSET 10`, res: nil},
+	}
+
+	for i, tt := range tests {
+		stmt, err := pieql.NewParser(strings.NewReader(tt.q)).Parse()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.q, err)
+		}
+
+		if res, err := db.Execute(stmt); err != nil {
+			t.Errorf("%d. %q: error: %s", i, tt.q, err)
+		} else if !reflect.DeepEqual(res.Rows, tt.res) {
+			t.Errorf("%d. %q: unexpected results: %#v", i, tt.q, res.Rows)
+		}
+	}
+}
+
+// Ensure the database can compute aggregates over groups of rows.
+func TestDatabase_Execute_Aggregate(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}, {Name: "age"}, {Name: "state"}})
+	db.SetTableRows("foo", [][]string{
+		{"susy", "8", "CO"},
+		{"bob", "31", "NY"},
+		{"jim", "12", "CO"},
+		{"ann", "100", "NY"},
+		{"bob", "", "CO"},
+	})
+
+	var tests = []struct {
+		q   string
+		res [][]string
+	}{
+		// Aggregates without grouping return a single row.
+		{q: `SELECT count(*), count(age), count(DISTINCT name) FROM foo`, res: [][]string{{"5", "4", "4"}}},
+		{q: `SELECT sum(age), avg(age), min(age), max(age) FROM foo`, res: [][]string{{"151", "37.75", "8", "100"}}},
+		{q: `SELECT min(name), max(name) FROM foo`, res: [][]string{{"ann", "susy"}}},
+		{q: `SELECT count(*), sum(age) FROM foo WHERE age > 1000`, res: [][]string{{"0", ""}}},
+
+		// Grouped aggregates are returned in order of first appearance.
+		{q: `SELECT state, count(*), max(age) FROM foo GROUP BY state`, res: [][]string{{"CO", "3", "12"}, {"NY", "2", "100"}}},
+
+		// Groups can be filtered and sorted.
+		{q: `SELECT state FROM foo GROUP BY state HAVING sum(age) > 100`, res: [][]string{{"NY"}}},
+		{q: `SELECT state, count(*) FROM foo GROUP BY state ORDER BY state DESC`, res: [][]string{{"NY", "2"}, {"CO", "3"}}},
+	}
+
+	for i, tt := range tests {
+		stmt, err := pieql.NewParser(strings.NewReader(tt.q)).Parse()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.q, err)
+		}
+
+		if res, err := db.Execute(stmt); err != nil {
+			t.Errorf("%d. %q: error: %s", i, tt.q, err)
+		} else if !reflect.DeepEqual(res.Rows, tt.res) {
+			t.Errorf("%d. %q: unexpected results: %#v", i, tt.q, res.Rows)
+		}
+	}
+}
+
+// Ensure the database returns an error for invalid aggregate queries.
+func TestDatabase_Execute_Aggregate_Err(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "name"}, {Name: "age"}})
+	db.SetTableRows("foo", nil)
+
+	var tests = []struct {
+		q   string
+		err string
+	}{
+		{q: `SELECT name, count(*) FROM foo`, err: `column must appear in GROUP BY or be used in an aggregate: name`},
+		{q: `SELECT name FROM foo WHERE count(*) > 1`, err: `aggregate functions are not allowed in WHERE`},
+		{q: `SELECT median(age) FROM foo`, err: `undefined function: median()`},
+		{q: `SELECT sum(age, name) FROM foo`, err: `invalid number of arguments for sum, expected 1, got 2`},
+		{q: `SELECT sum(*) FROM foo`, err: `invalid argument to sum: *`},
+		{q: `SELECT count(DISTINCT *) FROM foo`, err: `invalid argument to count: *`},
+		{q: `SELECT max(count(*)) FROM foo`, err: `aggregate functions cannot be nested: max(count(*))`},
+		{q: `SELECT sum(nope) FROM foo`, err: `column not found: nope`},
+	}
+
+	for i, tt := range tests {
+		stmt, err := pieql.NewParser(strings.NewReader(tt.q)).Parse()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.q, err)
+		}
+
+		if _, err := db.Execute(stmt); err == nil || err.Error() != tt.err {
+			t.Errorf("%d. %q: unexpected error: exp=%s got=%v", i, tt.q, tt.err, err)
+		}
+	}
+}
+
+// Ensure the database can compute fields from expressions.
+func TestDatabase_Execute_Expr(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("orders", []*pie.Column{{Name: "item"}, {Name: "price"}, {Name: "qty"}})
+	db.SetTableRows("orders", [][]string{
+		{"apple", "0.5", "10"},
+		{"pie", "12", "1"},
+		{"plum", "0.25", "8"},
+	})
+
+	// Parse PieQL statement.
+	stmt, err := pieql.NewParser(strings.NewReader(`SELECT item || '!' AS name, price * qty AS total FROM orders ORDER BY total DESC`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute statement and verify results.
+	if res, err := db.Execute(stmt); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"pie!", "12"}, {"apple!", "5"}, {"plum!", "2"}}) {
+		t.Fatalf("unexpected results: %#v", res.Rows)
+	}
+}
+
+// Ensure the database compares and sorts values using column types.
+func TestDatabase_Execute_Types(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{
+		{Name: "name", Type: pie.TextType},
+		{Name: "zip", Type: pie.TextType},
+		{Name: "age", Type: pie.IntegerType},
+		{Name: "active", Type: pie.BooleanType},
+		{Name: "born", Type: pie.TimestampType},
+		{Name: "price", Type: pie.FloatType},
+	})
+	db.SetTableRows("foo", [][]string{
+		{"susy", "9", "08", "true", "2007-05-01", "1.50"},
+		{"bob", "10", "31", "false", "1984-02-10T12:30:00.000Z", "2"},
+		{"jim", "100", "12", "true", "", "0.25"},
+	})
+
+	var tests = []struct {
+		q   string
+		res [][]string
+	}{
+		// Text columns sort lexically even when holding numbers.
+		{q: `SELECT name FROM foo ORDER BY zip`, res: [][]string{{"bob"}, {"jim"}, {"susy"}}},
+		{q: `SELECT name FROM foo ORDER BY age`, res: [][]string{{"susy"}, {"jim"}, {"bob"}}},
+
+		// Booleans and timestamps compare by type.
+		{q: `SELECT name FROM foo WHERE active = true`, res: [][]string{{"susy"}, {"jim"}}},
+		{q: `SELECT name FROM foo WHERE born < '2000-01-01'`, res: [][]string{{"bob"}}},
+		{q: `SELECT name, born FROM foo ORDER BY born DESC`, res: [][]string{{"susy", "2007-05-01"}, {"bob", "1984-02-10T12:30:00.000Z"}, {"jim", ""}}},
+
+		// Integers stay integers.
+		{q: `SELECT max(age), sum(age) FROM foo`, res: [][]string{{"31", "51"}}},
+
+		// Columns return their stored cells. Computed values are formatted.
+		{q: `SELECT age, price FROM foo WHERE name = 'susy'`, res: [][]string{{"08", "1.50"}}},
+		{q: `SELECT age + 0, price * 1 FROM foo WHERE name = 'susy'`, res: [][]string{{"8", "1.5"}}},
+		{q: `SELECT price, count(*) FROM foo WHERE age = 8 GROUP BY price`, res: [][]string{{"1.50", "1"}}},
+	}
+
+	for i, tt := range tests {
+		stmt, err := pieql.NewParser(strings.NewReader(tt.q)).Parse()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.q, err)
+		}
+
+		if res, err := db.Execute(stmt); err != nil {
+			t.Errorf("%d. %q: error: %s", i, tt.q, err)
+		} else if !reflect.DeepEqual(res.Rows, tt.res) {
+			t.Errorf("%d. %q: unexpected results: %#v", i, tt.q, res.Rows)
+		}
+	}
+}
+
+// Ensure the database can join rows across tables.
+func TestDatabase_Execute_Join(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("orders", []*pie.Column{{Name: "id"}, {Name: "customer_id"}, {Name: "total", Type: pie.FloatType}})
+	db.SetTableRows("orders", [][]string{
+		{"1", "10", "5.5"},
+		{"2", "20", "100"},
+		{"3", "10", "20"},
+		{"4", "99", "1"},
+	})
+	db.CreateTable("customers", []*pie.Column{{Name: "id"}, {Name: "name"}})
+	db.SetTableRows("customers", [][]string{
+		{"10", "susy"},
+		{"20", "bob"},
+		{"30", "jim"},
+	})
+
+	var tests = []struct {
+		q   string
+		res [][]string
+	}{
+		// Inner joins only return matching rows.
+		{
+			q:   `SELECT o.id, c.name FROM orders o JOIN customers c ON o.customer_id = c.id`,
+			res: [][]string{{"1", "susy"}, {"2", "bob"}, {"3", "susy"}},
+		},
+
+		// Left joins return unmatched rows with missing values.
+		{
+			q:   `SELECT o.id, name FROM orders AS o LEFT JOIN customers AS c ON c.id = o.customer_id ORDER BY name`,
+			res: [][]string{{"4", ""}, {"2", "bob"}, {"1", "susy"}, {"3", "susy"}},
+		},
+
+		// Join conditions can contain additional non-equality terms.
+		{
+			q:   `SELECT orders.id FROM orders JOIN customers ON customer_id = customers.id AND total > 10`,
+			res: [][]string{{"2"}, {"3"}},
+		},
+
+		// Joins without equality conditions compare every pair of rows.
+		{
+			q:   `SELECT o.id, c.id FROM orders o JOIN customers c ON o.customer_id > c.id AND c.name = 'jim'`,
+			res: [][]string{{"4", "30"}},
+		},
+
+		// Aggregates work over joined rows.
+		{
+			q:   `SELECT c.name, count(o.id), sum(total) FROM customers c LEFT JOIN orders o ON o.customer_id = c.id GROUP BY c.name ORDER BY c.name`,
+			res: [][]string{{"bob", "1", "100"}, {"jim", "0", ""}, {"susy", "2", "25.5"}},
+		},
+
+		// Wildcards expand to all columns of every table.
+		{
+			q:   `SELECT * FROM orders o JOIN customers c ON o.customer_id = c.id WHERE o.id = '2'`,
+			res: [][]string{{"2", "20", "100", "20", "bob"}},
+		},
+	}
+
+	for i, tt := range tests {
+		stmt, err := pieql.NewParser(strings.NewReader(tt.q)).Parse()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.q, err)
+		}
+
+		if res, err := db.Execute(stmt); err != nil {
+			t.Errorf("%d. %q: error: %s", i, tt.q, err)
+		} else if !reflect.DeepEqual(res.Rows, tt.res) {
+			t.Errorf("%d. %q: unexpected results: %#v", i, tt.q, res.Rows)
+		}
+	}
+}
+
+// Ensure joins on columns of different types match the same rows as the
+// equivalent condition evaluated for every pair of rows.
+func TestDatabase_Execute_Join_Types(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("a", []*pie.Column{{Name: "id"}, {Name: "at", Type: pie.TimestampType}})
+	db.SetTableRows("a", [][]string{{"01", "2020-01-01T01:00:00+01:00"}, {"2", "2020-01-02"}, {"x", ""}})
+	db.CreateTable("b", []*pie.Column{{Name: "id", Type: pie.IntegerType}, {Name: "at", Type: pie.TimestampType}})
+	db.SetTableRows("b", [][]string{{"1", "2020-01-01T00:00:00Z"}, {"2", "2020-01-03"}})
+
+	for i, tt := range []struct {
+		q   string
+		res [][]string
+	}{
+		{q: `SELECT a.id, b.id FROM a JOIN b ON a.id = b.id`, res: [][]string{{"01", "1"}, {"2", "2"}}},
+		{q: `SELECT a.id, b.id FROM a JOIN b ON a.id <= b.id AND a.id >= b.id`, res: [][]string{{"01", "1"}, {"2", "2"}}},
+		{q: `SELECT a.id, b.id FROM a JOIN b ON a.at = b.at`, res: [][]string{{"01", "1"}}},
+	} {
+		if res, err := db.Execute(MustParseStatement(tt.q)); err != nil {
+			t.Errorf("%d. %q: error: %s", i, tt.q, err)
+		} else if !reflect.DeepEqual(res.Rows, tt.res) {
+			t.Errorf("%d. %q: unexpected results: %#v", i, tt.q, res.Rows)
+		}
+	}
+}
+
+// Ensure the database returns an error for invalid joins.
+func TestDatabase_Execute_Join_Err(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("a", []*pie.Column{{Name: "id"}, {Name: "x"}})
+	db.SetTableRows("a", nil)
+	db.CreateTable("b", []*pie.Column{{Name: "id"}})
+	db.SetTableRows("b", nil)
+
+	var tests = []struct {
+		q   string
+		err string
+	}{
+		{q: `SELECT id FROM a JOIN b ON a.id = b.id`, err: `ambiguous column: id`},
+		{q: `SELECT a.id FROM a JOIN b ON a.id = b.nope`, err: `column not found: b.nope`},
+		{q: `SELECT a.id FROM a JOIN a ON a.id = a.id`, err: `duplicate table name: a`},
+		{q: `SELECT a.id FROM a JOIN c ON a.id = c.id`, err: `table not found`},
+		{q: `SELECT x FROM a AS z`, err: ``},
+		{q: `SELECT a.x FROM a AS z`, err: `column not found: a.x`},
+	}
+
+	for i, tt := range tests {
+		stmt, err := pieql.NewParser(strings.NewReader(tt.q)).Parse()
+		if err != nil {
+			t.Fatalf("%d. %q: parse error: %s", i, tt.q, err)
+		}
+
+		if _, err := db.Execute(stmt); tt.err == "" && err != nil {
+			t.Errorf("%d. %q: unexpected error: %s", i, tt.q, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%d. %q: unexpected error: exp=%s got=%v", i, tt.q, tt.err, err)
+		}
+	}
+}
+
+// Ensure the database can query columns & tables that require quoting.
+func TestDatabase_Execute_QuotedIdent(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("sales-2024.v2", []*pie.Column{{Name: "First Name"}, {Name: "prix-€", Type: pie.FloatType}, {Name: "ville"}})
+	db.SetTableRows("sales-2024.v2", [][]string{
+		{"Zoë", "10.5", "Zürich"},
+		{"Émile", "3", "Genève"},
+	})
+
+	stmt, err := pieql.NewParser(strings.NewReader(`SELECT "First Name", s."prix-€" * 2 AS "Prix ×2" FROM "sales-2024.v2" s WHERE ville != 'Genève' ORDER BY "First Name"`)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := db.Execute(stmt); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Rows, [][]string{{"Zoë", "21"}}) {
+		t.Fatalf("unexpected results: %#v", res.Rows)
+	} else if name := res.Columns[1]; name != "Prix ×2" {
+		t.Fatalf("unexpected field name: %s", name)
+	}
+}
+
+// Ensure the database can manage schema through DDL statements.
+func TestDatabase_Execute_DDL(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	// Create tables and add rows to one of them.
+	stmts, err := pieql.NewParser(strings.NewReader(`CREATE TABLE foo (id integer, name); CREATE TABLE bar (x)`)).ParseStatements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Execute(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.SetTableRows("bar", [][]string{{"1"}})
+
+	// A newly created table has no rows.
+	if res, err := db.Execute(MustParseStatement(`SELECT * FROM foo`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res.Columns, []string{"id", "name"}) || len(res.Rows) != 0 {
+		t.Fatalf("unexpected result: %#v", res)
+	}
+
+	// List tables & columns.
+	if res, err := db.Execute(MustParseStatement(`SHOW TABLES`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res, &pie.Result{Columns: []string{"name"}, Rows: [][]string{{"bar"}, {"foo"}}}) {
+		t.Fatalf("unexpected result: %#v", res)
+	}
+	if res, err := db.Execute(MustParseStatement(`DESCRIBE foo`)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res, &pie.Result{Columns: []string{"name", "type"}, Rows: [][]string{{"id", "integer"}, {"name", ""}}}) {
+		t.Fatalf("unexpected result: %#v", res)
+	}
+
+	// Drop a table; its rows should not reappear if it is recreated.
+	if _, err := db.Execute(MustParseStatement(`DROP TABLE bar`)); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Execute(MustParseStatement(`DROP TABLE bar`)); err != pie.ErrTableNotFound {
+		t.Fatalf("unexpected error: %s", err)
+	} else if _, err := db.Execute(MustParseStatement(`DROP TABLE IF EXISTS bar`)); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Execute(MustParseStatement(`CREATE TABLE bar (x)`)); err != nil {
+		t.Fatal(err)
+	} else if rows, err := db.TableRows("bar"); err != nil || len(rows) != 0 {
+		t.Fatalf("unexpected rows: %#v (%v)", rows, err)
+	}
+
+	// Invalid statements return errors.
+	if _, err := db.Execute(MustParseStatement(`CREATE TABLE foo (x)`)); err != pie.ErrTableExists {
+		t.Fatalf("unexpected error: %s", err)
+	} else if _, err := db.Execute(MustParseStatement(`CREATE TABLE baz (x money)`)); err == nil || err.Error() != "invalid column type: money" {
+		t.Fatalf("unexpected error: %s", err)
+	} else if _, err := db.Execute(MustParseStatement(`DESCRIBE baz`)); err != pie.ErrTableNotFound {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure the database can insert, update and delete rows.
+func TestDatabase_Execute_Modify(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "id", Type: pie.IntegerType}, {Name: "name"}, {Name: "active", Type: pie.BooleanType}})
+
+	var tests = []struct {
+		q    string
+		n    int
+		rows [][]string
+	}{
+		{q: `INSERT INTO foo VALUES (1, 'susy', true), (2, 'bob', false)`, n: 2, rows: [][]string{{"1", "susy", "true"}, {"2", "bob", "false"}}},
+		{q: `INSERT INTO foo (name, id) VALUES ('jim', 1 + 2)`, n: 1, rows: [][]string{{"1", "susy", "true"}, {"2", "bob", "false"}, {"3", "jim", ""}}},
+		{q: `UPDATE foo SET id = id * 10, name = name || '!' WHERE id >= 2`, n: 2, rows: [][]string{{"1", "susy", "true"}, {"20", "bob!", "false"}, {"30", "jim!", ""}}},
+		{q: `UPDATE foo SET active = false WHERE id = 100`, n: 0, rows: [][]string{{"1", "susy", "true"}, {"20", "bob!", "false"}, {"30", "jim!", ""}}},
+		{q: `UPDATE foo SET active = true`, n: 3, rows: [][]string{{"1", "susy", "true"}, {"20", "bob!", "true"}, {"30", "jim!", "true"}}},
+		{q: `DELETE FROM foo WHERE name = 'bob!' OR id = 1`, n: 2, rows: [][]string{{"30", "jim!", "true"}}},
+		{q: `DELETE FROM foo`, n: 1, rows: nil},
+	}
+
+	for i, tt := range tests {
+		if res, err := db.Execute(MustParseStatement(tt.q)); err != nil {
+			t.Errorf("%d. %q: unexpected error: %s", i, tt.q, err)
+		} else if res.RowsAffected != tt.n || !reflect.DeepEqual(res.Rows, [][]string{{strconv.Itoa(tt.n)}}) {
+			t.Errorf("%d. %q: unexpected rows affected: %d", i, tt.q, res.RowsAffected)
+		} else if rows, err := db.TableRows("foo"); err != nil {
+			t.Errorf("%d. %q: unexpected error: %s", i, tt.q, err)
+		} else if !reflect.DeepEqual(rows, tt.rows) {
+			t.Errorf("%d. %q: unexpected rows: %#v", i, tt.q, rows)
+		}
+	}
+}
+
+// Ensure the database returns errors for invalid modifications.
+func TestDatabase_Execute_Modify_Err(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "id", Type: pie.IntegerType}, {Name: "name"}})
+	db.SetTableRows("foo", [][]string{{"1", "susy"}, {"x2", "bob"}})
+
+	var tests = []struct {
+		q   string
+		err string
+	}{
+		{q: `INSERT INTO bar VALUES (1)`, err: `table not found`},
+		{q: `INSERT INTO foo VALUES (1)`, err: `row 1: expected 2 values, got 1`},
+		{q: `INSERT INTO foo (id, id) VALUES (1, 2)`, err: `duplicate column: id`},
+		{q: `INSERT INTO foo (age) VALUES (1)`, err: `column not found: age`},
+		{q: `INSERT INTO foo VALUES (1, 'a'), ('b', 'c')`, err: `row 2: column "id": invalid integer: "b"`},
+		{q: `INSERT INTO foo VALUES (name, 'a')`, err: `column not found: name`},
+		{q: `INSERT INTO foo VALUES (count(*), 'a')`, err: `aggregate functions are not allowed in VALUES`},
+		{q: `UPDATE bar SET id = 1`, err: `table not found`},
+		{q: `UPDATE foo SET age = 1`, err: `column not found: age`},
+		{q: `UPDATE foo SET id = age`, err: `column not found: age`},
+		{q: `UPDATE foo SET id = 'x' WHERE name = 'susy'`, err: `row 1: column "id": invalid integer: "x"`},
+		{q: `UPDATE foo SET name = 'x' WHERE name = 'bob'`, err: `row 2: column "id": invalid integer: "x2"`},
+		{q: `UPDATE foo SET id = 1 WHERE max(id) > 1`, err: `aggregate functions are not allowed in WHERE`},
+		{q: `DELETE FROM foo WHERE age = 1`, err: `column not found: age`},
+	}
+
+	for i, tt := range tests {
+		if _, err := db.Execute(MustParseStatement(tt.q)); err == nil || err.Error() != tt.err {
+			t.Errorf("%d. %q: unexpected error: exp=%s got=%v", i, tt.q, tt.err, err)
+		}
+	}
+
+	// Failed statements should not change any rows.
+	if rows, _ := db.TableRows("foo"); !reflect.DeepEqual(rows, [][]string{{"1", "susy"}, {"x2", "bob"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+}
+
+// Ensure the database can stream & append rows stored one per line.
+func TestDatabase_TableRowIterator(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}, {Name: "b"}})
+
+	// Write rows and then append to them.
+	if err := db.SetTableRows("foo", [][]string{{"1", "x"}, {"2", "y"}}); err != nil {
+		t.Fatal(err)
+	} else if err := db.AppendTableRows("foo", [][]string{{"3", "z\nz"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify each row is on its own line.
+	if b, err := ioutil.ReadFile(filepath.Join(db.Path(), "data", "foo")); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "[\"1\",\"x\"]\n[\"2\",\"y\"]\n[\"3\",\"z\\nz\"]\n" {
+		t.Fatalf("unexpected data file: %q", b)
+	}
+
+	// Iterate over the rows.
+	itr, err := db.TableRowIterator("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer itr.Close()
+	for i, exp := range [][]string{{"1", "x"}, {"2", "y"}, {"3", "z\nz"}, nil} {
+		if row, err := itr.Next(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(row, exp) {
+			t.Fatalf("%d. unexpected row: %#v", i, row)
+		}
+	}
+}
+
+// Ensure the database can read & append to data files that store all rows in
+// a single JSON array.
+func TestDatabase_TableRows_Legacy(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}})
+	db.CreateTable("bar", []*pie.Column{{Name: "a"}})
+
+	path := filepath.Join(db.Path(), "data", "foo")
+	if err := ioutil.WriteFile(path, []byte(` [ ["1"],["2"]]`+"\n"), 0666); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(db.Path(), "data", "bar"), []byte("null\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows, err := db.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	} else if rows, err := db.TableRows("bar"); err != nil || rows != nil {
+		t.Fatalf("unexpected rows: %#v (%v)", rows, err)
+	}
+
+	// Appending rewrites the file with one row per line.
+	if err := db.AppendTableRows("foo", [][]string{{"3"}}); err != nil {
+		t.Fatal(err)
+	} else if b, _ := ioutil.ReadFile(path); string(b) != "[\"1\"]\n[\"2\"]\n[\"3\"]\n" {
+		t.Fatalf("unexpected data file: %q", b)
+	}
+}
+
+// Ensure a query cursor reads rows from disk only as they are needed.
+func TestDatabase_Query_Streaming(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}})
+
+	// Write valid rows followed by a corrupt row.
+	if err := ioutil.WriteFile(filepath.Join(db.Path(), "data", "foo"), []byte("[\"1\"]\n[\"2\"]\n[\"3\"]\n!!!\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// The corrupt row is never read if the limit is reached first.
+	cur, err := db.Query(MustParseStatement(`SELECT a FROM foo WHERE a != '2' LIMIT 1 OFFSET 1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	if !reflect.DeepEqual(cur.Columns, []string{"a"}) {
+		t.Fatalf("unexpected columns: %#v", cur.Columns)
+	} else if row, err := cur.Next(); err != nil || !reflect.DeepEqual(row, []string{"3"}) {
+		t.Fatalf("unexpected row: %#v (%v)", row, err)
+	} else if row, err := cur.Next(); err != nil || row != nil {
+		t.Fatalf("unexpected row: %#v (%v)", row, err)
+	}
+
+	// Sorting requires every row to be read.
+	if _, err := db.Execute(MustParseStatement(`SELECT a FROM foo ORDER BY a LIMIT 1`)); err == nil {
+		t.Fatal("expected error")
 	}
 }
 
 // Ensure the database can marshal metadata to JSON.
 func TestDatabase_MarshalJSON(t *testing.T) {
 	// Create a database with two tables.
-	db := pie.NewDatabase()
+	db := OpenDatabase()
+	defer db.Close()
 	db.CreateTable("foo", []*pie.Column{{Name: "fname"}, {Name: "lname"}})
-	db.CreateTable("bar", []*pie.Column{{Name: "age"}})
+	db.CreateTable("bar", []*pie.Column{{Name: "age", Type: pie.IntegerType}})
 
 	// Add data to one table.
 	db.SetTableRows("foo", [][]string{{"bob", "smith"}})
@@ -157,7 +998,7 @@ func TestDatabase_MarshalJSON(t *testing.T) {
 	// Marshal database into JSON.
 	if b, err := json.Marshal(db); err != nil {
 		t.Fatalf("unexpected error: %s", err)
-	} else if string(b) != `{"tables":[{"name":"foo","columns":[{"name":"fname"},{"name":"lname"}]},{"name":"bar","columns":[{"name":"age"}]}]}` {
+	} else if string(b) != `{"tables":[{"name":"bar","columns":[{"name":"age","type":"integer"}]},{"name":"foo","columns":[{"name":"fname"},{"name":"lname"}]}]}` {
 		t.Fatalf("unexpected bytes: %s", b)
 	}
 }
@@ -177,6 +1018,15 @@ func TestDatabase_UnmarshalJSON(t *testing.T) {
 	}
 }
 
+// MustParseStatement parses a single statement. Panic on error.
+func MustParseStatement(s string) pieql.Statement {
+	stmt, err := pieql.NewParser(strings.NewReader(s)).Parse()
+	if err != nil {
+		panic(err.Error())
+	}
+	return stmt
+}
+
 // Database is a test wrapper for pie.Database.
 type Database struct {
 	*pie.Database
@@ -191,6 +1041,17 @@ func OpenDatabase() *Database {
 	return &Database{db}
 }
 
+// OpenMemDatabase returns a new, opened instance of Database that holds
+// its data in memory.
+func OpenMemDatabase() *Database {
+	db := pie.NewDatabase()
+	db.Storage = pie.NewMemStorage()
+	if err := db.Open(""); err != nil {
+		panic(err.Error())
+	}
+	return &Database{db}
+}
+
 // Close closes the database and removes the underlying data.
 func (db *Database) Close() {
 	defer os.RemoveAll(db.Path())
@@ -1,15 +1,686 @@
 package pieql
 
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Node represents a node in the PieQL abstract syntax tree.
+type Node interface {
+	node()
+	String() string
+}
+
+func (Statements) node()              {}
+func (*SelectStatement) node()        {}
+func (*CreateTableStatement) node()   {}
+func (*CreateIndexStatement) node()   {}
+func (*DropTableStatement) node()     {}
+func (*ShowTablesStatement) node()    {}
+func (*DescribeTableStatement) node() {}
+func (*ExplainStatement) node()       {}
+func (*ColumnDefinition) node()       {}
+func (*InsertStatement) node()        {}
+func (*UpdateStatement) node()        {}
+func (*Assignment) node()             {}
+func (*DeleteStatement) node()        {}
+func (Fields) node()                  {}
+func (*Field) node()                  {}
+func (SortFields) node()              {}
+func (*SortField) node()              {}
+func (*Source) node()                 {}
+func (*Join) node()                   {}
+
+func (*VarRef) node()         {}
+func (*Wildcard) node()       {}
+func (*Call) node()           {}
+func (*StringLiteral) node()  {}
+func (*NumberLiteral) node()  {}
+func (*BooleanLiteral) node() {}
+func (*BinaryExpr) node()     {}
+func (*UnaryExpr) node()      {}
+func (*ParenExpr) node()      {}
+
+// Statements represents a list of statements.
+type Statements []Statement
+
+// String returns a string representation of the statements.
+func (a Statements) String() string {
+	var str []string
+	for _, stmt := range a {
+		str = append(str, stmt.String())
+	}
+	return strings.Join(str, ";\n")
+}
+
+// Statement represents a single command in PieQL.
+type Statement interface {
+	Node
+	stmt()
+}
+
+func (*SelectStatement) stmt()        {}
+func (*CreateTableStatement) stmt()   {}
+func (*CreateIndexStatement) stmt()   {}
+func (*DropTableStatement) stmt()     {}
+func (*ShowTablesStatement) stmt()    {}
+func (*DescribeTableStatement) stmt() {}
+func (*ExplainStatement) stmt()       {}
+func (*InsertStatement) stmt()        {}
+func (*UpdateStatement) stmt()        {}
+func (*DeleteStatement) stmt()        {}
+
 // SelectStatement represents a statement for retrieving data.
 type SelectStatement struct {
-	Fields Fields
-	Source string
+	Fields    Fields
+	Source    *Source
+	Joins     []*Join
+	Condition Expr
+
+	// Expressions to group rows by and the condition applied to each group.
+	GroupBy []Expr
+	Having  Expr
+
+	// Fields to sort results by.
+	SortFields SortFields
+
+	// Maximum number of rows to return and number of rows to skip.
+	// A nil limit returns all rows.
+	Limit  *int
+	Offset int
+}
+
+// IsAggregate returns true if the statement groups rows or computes aggregates.
+func (s *SelectStatement) IsAggregate() bool {
+	return len(s.GroupBy) > 0 || s.Having != nil || HasCall(s.Fields)
+}
+
+// String returns a string representation of the select statement.
+func (s *SelectStatement) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("SELECT ")
+	buf.WriteString(s.Fields.String())
+	buf.WriteString(" FROM ")
+	buf.WriteString(s.Source.String())
+	for _, j := range s.Joins {
+		buf.WriteString(" ")
+		buf.WriteString(j.String())
+	}
+	if s.Condition != nil {
+		buf.WriteString(" WHERE ")
+		buf.WriteString(s.Condition.String())
+	}
+	if len(s.GroupBy) > 0 {
+		buf.WriteString(" GROUP BY ")
+		buf.WriteString(joinExprs(s.GroupBy))
+	}
+	if s.Having != nil {
+		buf.WriteString(" HAVING ")
+		buf.WriteString(s.Having.String())
+	}
+	if len(s.SortFields) > 0 {
+		buf.WriteString(" ORDER BY ")
+		buf.WriteString(s.SortFields.String())
+	}
+	if s.Limit != nil {
+		buf.WriteString(" LIMIT ")
+		buf.WriteString(strconv.Itoa(*s.Limit))
+	}
+	if s.Offset > 0 {
+		buf.WriteString(" OFFSET ")
+		buf.WriteString(strconv.Itoa(s.Offset))
+	}
+	return buf.String()
+}
+
+// CreateTableStatement represents a statement for creating a new table.
+type CreateTableStatement struct {
+	Name    string
+	Columns []*ColumnDefinition
+}
+
+// String returns a string representation of the create statement.
+func (s *CreateTableStatement) String() string {
+	var defs []string
+	for _, c := range s.Columns {
+		defs = append(defs, c.String())
+	}
+	return "CREATE TABLE " + QuoteIdent(s.Name) + " (" + strings.Join(defs, ", ") + ")"
+}
+
+// ColumnDefinition represents a column name with an optional type.
+type ColumnDefinition struct {
+	Name string
+	Type string
+}
+
+// String returns a string representation of the column definition.
+func (c *ColumnDefinition) String() string {
+	if c.Type != "" {
+		return QuoteIdent(c.Name) + " " + c.Type
+	}
+	return QuoteIdent(c.Name)
+}
+
+// CreateIndexStatement represents a statement for indexing a table's column.
+type CreateIndexStatement struct {
+	Name   string
+	Table  string
+	Column string
+}
+
+// String returns a string representation of the create statement.
+func (s *CreateIndexStatement) String() string {
+	return "CREATE INDEX " + QuoteIdent(s.Name) + " ON " + QuoteIdent(s.Table) + " (" + QuoteIdent(s.Column) + ")"
+}
+
+// DropTableStatement represents a statement for removing a table.
+type DropTableStatement struct {
+	Name     string
+	IfExists bool
+}
+
+// String returns a string representation of the drop statement.
+func (s *DropTableStatement) String() string {
+	if s.IfExists {
+		return "DROP TABLE IF EXISTS " + QuoteIdent(s.Name)
+	}
+	return "DROP TABLE " + QuoteIdent(s.Name)
+}
+
+// ShowTablesStatement represents a statement for listing tables.
+type ShowTablesStatement struct{}
+
+// String returns a string representation of the show statement.
+func (s *ShowTablesStatement) String() string { return "SHOW TABLES" }
+
+// DescribeTableStatement represents a statement for listing a table's columns.
+type DescribeTableStatement struct {
+	Name string
+}
+
+// String returns a string representation of the describe statement.
+func (s *DescribeTableStatement) String() string { return "DESCRIBE " + QuoteIdent(s.Name) }
+
+// ExplainStatement represents a statement for showing how a query is executed.
+type ExplainStatement struct {
+	Statement *SelectStatement
+}
+
+// String returns a string representation of the explain statement.
+func (s *ExplainStatement) String() string { return "EXPLAIN " + s.Statement.String() }
+
+// InsertStatement represents a statement for adding rows to a table.
+// If no columns are specified then values are assigned to every column in order.
+type InsertStatement struct {
+	Table   string
+	Columns []string
+	Values  [][]Expr
+}
+
+// String returns a string representation of the insert statement.
+func (s *InsertStatement) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("INSERT INTO ")
+	buf.WriteString(QuoteIdent(s.Table))
+	if len(s.Columns) > 0 {
+		var cols []string
+		for _, c := range s.Columns {
+			cols = append(cols, QuoteIdent(c))
+		}
+		buf.WriteString(" (" + strings.Join(cols, ", ") + ")")
+	}
+	buf.WriteString(" VALUES ")
+	for i, values := range s.Values {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("(" + joinExprs(values) + ")")
+	}
+	return buf.String()
+}
+
+// UpdateStatement represents a statement for changing rows in a table.
+type UpdateStatement struct {
+	Table       string
+	Assignments []*Assignment
+	Condition   Expr
+}
+
+// String returns a string representation of the update statement.
+func (s *UpdateStatement) String() string {
+	var assignments []string
+	for _, a := range s.Assignments {
+		assignments = append(assignments, a.String())
+	}
+
+	str := "UPDATE " + QuoteIdent(s.Table) + " SET " + strings.Join(assignments, ", ")
+	if s.Condition != nil {
+		str += " WHERE " + s.Condition.String()
+	}
+	return str
+}
+
+// Assignment represents a new value for a column in an UPDATE statement.
+type Assignment struct {
+	Column string
+	Expr   Expr
+}
+
+// String returns a string representation of the assignment.
+func (a *Assignment) String() string { return QuoteIdent(a.Column) + " = " + a.Expr.String() }
+
+// DeleteStatement represents a statement for removing rows from a table.
+type DeleteStatement struct {
+	Table     string
+	Condition Expr
+}
+
+// String returns a string representation of the delete statement.
+func (s *DeleteStatement) String() string {
+	if s.Condition != nil {
+		return "DELETE FROM " + QuoteIdent(s.Table) + " WHERE " + s.Condition.String()
+	}
+	return "DELETE FROM " + QuoteIdent(s.Table)
 }
 
 // Fields represents a list of fields.
 type Fields []*Field
 
-// Field represents a column to be selected.
+// String returns a string representation of the fields.
+func (a Fields) String() string {
+	var str []string
+	for _, f := range a {
+		str = append(str, f.String())
+	}
+	return strings.Join(str, ", ")
+}
+
+// Field returns the field with the given name.
+// Returns nil if no field has the name.
+func (a Fields) Field(name string) *Field {
+	for _, f := range a {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Field represents an expression to be selected.
 type Field struct {
-	Name string
+	Expr  Expr
+	Alias string
+}
+
+// Name returns the name of the field as it appears in the result header.
+// Aliased fields use their alias and column references use the column name.
+// Other computed fields use their expression.
+func (f *Field) Name() string {
+	if f.Alias != "" {
+		return f.Alias
+	} else if ref, ok := f.Expr.(*VarRef); ok {
+		return ref.Val
+	}
+	return f.Expr.String()
+}
+
+// String returns a string representation of the field.
+func (f *Field) String() string {
+	if f.Alias != "" {
+		return f.Expr.String() + " AS " + QuoteIdent(f.Alias)
+	}
+	return f.Expr.String()
+}
+
+// Source represents a table being queried.
+type Source struct {
+	Name  string
+	Alias string
+}
+
+// Qualifier returns the name used to qualify the source's columns.
+// This is the alias, if set. Otherwise it is the table name.
+func (s *Source) Qualifier() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+// String returns a string representation of the source.
+func (s *Source) String() string {
+	if s.Alias != "" {
+		return QuoteIdent(s.Name) + " AS " + QuoteIdent(s.Alias)
+	}
+	return QuoteIdent(s.Name)
+}
+
+// Join represents a table joined to the sources before it.
+type Join struct {
+	Type      Token // INNER or LEFT
+	Source    *Source
+	Condition Expr
+}
+
+// String returns a string representation of the join.
+func (j *Join) String() string {
+	return j.Type.String() + " JOIN " + j.Source.String() + " ON " + j.Condition.String()
+}
+
+// SortFields represents an ordered list of sort fields.
+type SortFields []*SortField
+
+// String returns a string representation of the sort fields.
+func (a SortFields) String() string {
+	var str []string
+	for _, f := range a {
+		str = append(str, f.String())
+	}
+	return strings.Join(str, ", ")
+}
+
+// SortField represents a field or column to sort results by.
+// The table is optional and can be a table name or alias.
+type SortField struct {
+	Table     string
+	Name      string
+	Ascending bool
+}
+
+// String returns a string representation of the sort field.
+func (f *SortField) String() string {
+	ref := &VarRef{Table: f.Table, Val: f.Name}
+	if f.Ascending {
+		return ref.String() + " ASC"
+	}
+	return ref.String() + " DESC"
+}
+
+// Expr represents an expression that can be evaluated to a value.
+type Expr interface {
+	Node
+	expr()
+}
+
+func (*VarRef) expr()         {}
+func (*Wildcard) expr()       {}
+func (*Call) expr()           {}
+func (*StringLiteral) expr()  {}
+func (*NumberLiteral) expr()  {}
+func (*BooleanLiteral) expr() {}
+func (*BinaryExpr) expr()     {}
+func (*UnaryExpr) expr()      {}
+func (*ParenExpr) expr()      {}
+
+// VarRef represents a reference to a column.
+// The table is optional and can be a table name or alias.
+type VarRef struct {
+	Table string
+	Val   string
+}
+
+// String returns a string representation of the column reference.
+// Names that aren't valid identifiers are quoted.
+func (r *VarRef) String() string {
+	if r.Table != "" {
+		return QuoteIdent(r.Table) + "." + QuoteIdent(r.Val)
+	}
+	return QuoteIdent(r.Val)
+}
+
+// Wildcard represents a wild card expression.
+type Wildcard struct{}
+
+// String returns a string representation of the wildcard.
+func (w *Wildcard) String() string { return "*" }
+
+// Call represents a function call.
+type Call struct {
+	Name     string
+	Distinct bool
+	Args     []Expr
+}
+
+// String returns a string representation of the call.
+func (c *Call) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(c.Name)
+	buf.WriteString("(")
+	if c.Distinct {
+		buf.WriteString("DISTINCT ")
+	}
+	buf.WriteString(joinExprs(c.Args))
+	buf.WriteString(")")
+	return buf.String()
+}
+
+// StringLiteral represents a string literal.
+type StringLiteral struct {
+	Val string
+}
+
+// String returns a string representation of the literal.
+func (l *StringLiteral) String() string { return QuoteString(l.Val) }
+
+// NumberLiteral represents a numeric literal.
+type NumberLiteral struct {
+	Val float64
+}
+
+// String returns a string representation of the literal.
+func (l *NumberLiteral) String() string { return strconv.FormatFloat(l.Val, 'f', -1, 64) }
+
+// BooleanLiteral represents a boolean literal.
+type BooleanLiteral struct {
+	Val bool
+}
+
+// String returns a string representation of the literal.
+func (l *BooleanLiteral) String() string {
+	if l.Val {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// BinaryExpr represents an operation between two expressions.
+type BinaryExpr struct {
+	Op  Token
+	LHS Expr
+	RHS Expr
+}
+
+// String returns a string representation of the binary expression.
+func (e *BinaryExpr) String() string {
+	return e.LHS.String() + " " + e.Op.String() + " " + e.RHS.String()
+}
+
+// UnaryExpr represents an operation on a single expression.
+type UnaryExpr struct {
+	Op   Token
+	Expr Expr
+}
+
+// String returns a string representation of the unary expression.
+func (e *UnaryExpr) String() string {
+	if e.Op == SUB {
+		return "-" + e.Expr.String()
+	}
+	return e.Op.String() + " " + e.Expr.String()
+}
+
+// ParenExpr represents a parenthesized expression.
+type ParenExpr struct {
+	Expr Expr
+}
+
+// String returns a string representation of the parenthesized expression.
+func (e *ParenExpr) String() string { return "(" + e.Expr.String() + ")" }
+
+// QuoteIdent returns ident wrapped in double quotes if it is not a valid
+// unquoted identifier or if it is a keyword. Embedded quotes are doubled and
+// backslashes are escaped.
+func QuoteIdent(ident string) string {
+	if isIdent(ident) && Lookup(ident) == IDENT {
+		return ident
+	}
+	return `"` + identReplacer.Replace(ident) + `"`
+}
+
+// QuoteString returns s as a single-quoted string literal.
+// Embedded quotes are doubled and backslashes are escaped.
+func QuoteString(s string) string {
+	return "'" + stringReplacer.Replace(s) + "'"
+}
+
+// Replacers that escape the text within quoted identifiers & strings so that
+// the scanner reads back the original text.
+var (
+	identReplacer  = strings.NewReplacer(`"`, `""`, `\`, `\\`)
+	stringReplacer = strings.NewReplacer(`'`, `''`, `\`, `\\`)
+)
+
+// isIdent returns true if s can be scanned as an unquoted identifier.
+func isIdent(s string) bool {
+	for i, ch := range s {
+		if i == 0 && !isLetter(ch) && ch != '_' {
+			return false
+		} else if !isIdentChar(ch) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// joinExprs returns a comma-separated list of expressions.
+func joinExprs(a []Expr) string {
+	var str []string
+	for _, e := range a {
+		str = append(str, e.String())
+	}
+	return strings.Join(str, ", ")
+}
+
+// HasCall returns true if node contains a function call.
+func HasCall(node Node) bool {
+	var found bool
+	WalkFunc(node, func(n Node) {
+		if _, ok := n.(*Call); ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// Visitor can be called by Walk to traverse an AST hierarchy.
+// The Visit() function is called once per node.
+type Visitor interface {
+	Visit(Node) Visitor
+}
+
+// Walk traverses a node hierarchy in depth-first order.
+func Walk(v Visitor, node Node) {
+	if node == nil {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case Statements:
+		for _, s := range n {
+			Walk(v, s)
+		}
+	case *CreateTableStatement:
+		for _, c := range n.Columns {
+			Walk(v, c)
+		}
+	case *InsertStatement:
+		for _, values := range n.Values {
+			for _, e := range values {
+				Walk(v, e)
+			}
+		}
+	case *UpdateStatement:
+		for _, a := range n.Assignments {
+			Walk(v, a)
+		}
+		Walk(v, n.Condition)
+	case *Assignment:
+		Walk(v, n.Expr)
+	case *DeleteStatement:
+		Walk(v, n.Condition)
+	case *ExplainStatement:
+		Walk(v, n.Statement)
+	case *SelectStatement:
+		Walk(v, n.Fields)
+		Walk(v, n.Source)
+		for _, j := range n.Joins {
+			Walk(v, j)
+		}
+		Walk(v, n.Condition)
+		for _, e := range n.GroupBy {
+			Walk(v, e)
+		}
+		Walk(v, n.Having)
+		Walk(v, n.SortFields)
+	case Fields:
+		for _, f := range n {
+			Walk(v, f)
+		}
+	case *Field:
+		Walk(v, n.Expr)
+	case *Join:
+		Walk(v, n.Source)
+		Walk(v, n.Condition)
+	case SortFields:
+		for _, f := range n {
+			Walk(v, f)
+		}
+	case *Call:
+		for _, e := range n.Args {
+			Walk(v, e)
+		}
+	case *BinaryExpr:
+		Walk(v, n.LHS)
+		Walk(v, n.RHS)
+	case *UnaryExpr:
+		Walk(v, n.Expr)
+	case *ParenExpr:
+		Walk(v, n.Expr)
+	}
+}
+
+// WalkFunc traverses a node hierarchy in depth-first order.
+func WalkFunc(node Node, fn func(Node)) {
+	Walk(walkFuncVisitor(fn), node)
+}
+
+type walkFuncVisitor func(Node)
+
+func (fn walkFuncVisitor) Visit(n Node) Visitor { fn(n); return fn }
+
+// RewriteExpr recursively invokes fn on expr and each of its subexpressions,
+// from the bottom up, and returns the rewritten expression. Nodes are copied
+// so the original expression is left unchanged.
+func RewriteExpr(expr Expr, fn func(Expr) Expr) Expr {
+	switch e := expr.(type) {
+	case *Call:
+		other := *e
+		other.Args = make([]Expr, len(e.Args))
+		for i, arg := range e.Args {
+			other.Args[i] = RewriteExpr(arg, fn)
+		}
+		expr = &other
+	case *BinaryExpr:
+		expr = &BinaryExpr{Op: e.Op, LHS: RewriteExpr(e.LHS, fn), RHS: RewriteExpr(e.RHS, fn)}
+	case *UnaryExpr:
+		expr = &UnaryExpr{Op: e.Op, Expr: RewriteExpr(e.Expr, fn)}
+	case *ParenExpr:
+		expr = &ParenExpr{Expr: RewriteExpr(e.Expr, fn)}
+	}
+	return fn(expr)
 }
@@ -0,0 +1,338 @@
+package pieql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Valuer resolves column references to values during evaluation.
+type Valuer interface {
+	// Value returns the value for a column name and true if it exists.
+	Value(name string) (interface{}, bool)
+}
+
+// MapValuer is a valuer backed by a map.
+type MapValuer map[string]interface{}
+
+// Value returns the value for key in the map.
+func (m MapValuer) Value(key string) (interface{}, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+// Eval evaluates an expression against a valuer.
+// Returns nil if the expression cannot be evaluated.
+func Eval(expr Expr, v Valuer) interface{} {
+	switch expr := expr.(type) {
+	case *VarRef:
+		val, _ := v.Value(expr.String())
+		return val
+	case *Call:
+		// Function calls are computed outside of evaluation and are
+		// looked up by their string representation.
+		val, _ := v.Value(expr.String())
+		return val
+	case *StringLiteral:
+		return expr.Val
+	case *NumberLiteral:
+		return expr.Val
+	case *BooleanLiteral:
+		return expr.Val
+	case *ParenExpr:
+		return Eval(expr.Expr, v)
+	case *UnaryExpr:
+		return evalUnaryExpr(expr, v)
+	case *BinaryExpr:
+		return evalBinaryExpr(expr, v)
+	}
+	return nil
+}
+
+// EvalBool evaluates an expression and returns true if the result is true.
+// A nil expression always evaluates to true.
+func EvalBool(expr Expr, v Valuer) bool {
+	if expr == nil {
+		return true
+	}
+	b, _ := Eval(expr, v).(bool)
+	return b
+}
+
+func evalUnaryExpr(expr *UnaryExpr, v Valuer) interface{} {
+	switch expr.Op {
+	case NOT:
+		b, ok := Eval(expr.Expr, v).(bool)
+		if !ok {
+			return nil
+		}
+		return !b
+	case SUB:
+		f, ok := toFloat(Eval(expr.Expr, v))
+		if !ok {
+			return nil
+		}
+		return -f
+	}
+	return nil
+}
+
+func evalBinaryExpr(expr *BinaryExpr, v Valuer) interface{} {
+	// Evaluate logical operators without requiring both sides to be set.
+	switch expr.Op {
+	case AND:
+		return EvalBool(expr.LHS, v) && EvalBool(expr.RHS, v)
+	case OR:
+		return EvalBool(expr.LHS, v) || EvalBool(expr.RHS, v)
+	}
+
+	lhs, rhs := Eval(expr.LHS, v), Eval(expr.RHS, v)
+
+	// Compute arithmetic & string operators.
+	switch expr.Op {
+	case ADD, SUB, MUL, DIV, MOD:
+		return evalArithmetic(expr.Op, lhs, rhs)
+	case CONCAT:
+		if lhs == nil || rhs == nil {
+			return nil
+		}
+		return toString(lhs) + toString(rhs)
+	}
+
+	// Compare values. Unset values never match a comparison.
+	cmp, ok := Compare(lhs, rhs)
+	if !ok {
+		return false
+	}
+
+	switch expr.Op {
+	case EQ:
+		return cmp == 0
+	case NEQ:
+		return cmp != 0
+	case LT:
+		return cmp < 0
+	case LTE:
+		return cmp <= 0
+	case GT:
+		return cmp > 0
+	case GTE:
+		return cmp >= 0
+	}
+	return nil
+}
+
+// evalArithmetic applies a numeric operator to two values.
+// Returns nil if either value is not a number or on division by zero.
+func evalArithmetic(op Token, lhs, rhs interface{}) interface{} {
+	x, ok := toFloat(lhs)
+	if !ok {
+		return nil
+	}
+	y, ok := toFloat(rhs)
+	if !ok {
+		return nil
+	}
+
+	switch op {
+	case ADD:
+		return x + y
+	case SUB:
+		return x - y
+	case MUL:
+		return x * y
+	case DIV:
+		if y == 0 {
+			return nil
+		}
+		return x / y
+	case MOD:
+		if y == 0 {
+			return nil
+		}
+		return math.Mod(x, y)
+	}
+	return nil
+}
+
+// Compare returns -1, 0, or 1 if a is less than, equal to, or greater than b.
+// Numbers compare numerically, timestamps chronologically and booleans with
+// false before true. Strings are converted when compared to one of those
+// types. All other values compare as strings.
+// Returns false if either value is nil or they cannot be compared.
+func Compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	// Compare integers exactly.
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			if x < y {
+				return -1, true
+			} else if x > y {
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	switch {
+	case isNumber(a) || isNumber(b):
+		x, ok := toFloat(a)
+		if !ok {
+			break
+		}
+		y, ok := toFloat(b)
+		if !ok {
+			break
+		}
+		return compareFloats(x, y), true
+
+	case isTime(a) || isTime(b):
+		x, ok := toTime(a)
+		if !ok {
+			return 0, false
+		}
+		y, ok := toTime(b)
+		if !ok {
+			return 0, false
+		}
+		if x.Before(y) {
+			return -1, true
+		} else if x.After(y) {
+			return 1, true
+		}
+		return 0, true
+
+	case isBool(a) || isBool(b):
+		x, ok := toBool(a)
+		if !ok {
+			return 0, false
+		}
+		y, ok := toBool(b)
+		if !ok {
+			return 0, false
+		}
+		return boolToInt(x) - boolToInt(y), true
+	}
+
+	return strings.Compare(toString(a), toString(b)), true
+}
+
+// compareFloats returns -1, 0, or 1 if x is less than, equal to, or greater than y.
+func compareFloats(x, y float64) int {
+	if x < y {
+		return -1
+	} else if x > y {
+		return 1
+	}
+	return 0
+}
+
+// TimeLayouts are the layouts accepted when parsing timestamps.
+var TimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parses a timestamp using one of the supported layouts.
+// Timestamps without a zone are interpreted as UTC.
+func ParseTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range TimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// ParseBool parses a "true" or "false" value, ignoring case.
+func ParseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean: %q", s)
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case float64, int64:
+		return true
+	}
+	return false
+}
+
+func isTime(v interface{}) bool { _, ok := v.(time.Time); return ok }
+func isBool(v interface{}) bool { _, ok := v.(bool); return ok }
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// toFloat converts v to a float64, if possible.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// toTime converts v to a time, if possible.
+func toTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := ParseTime(v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// toBool converts v to a boolean, if possible.
+func toBool(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := ParseBool(v)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// toString converts v to its string representation.
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return ""
+}
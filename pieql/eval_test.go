@@ -0,0 +1,82 @@
+package pieql_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+// Ensure expressions can be evaluated against a set of values.
+func TestEval(t *testing.T) {
+	var tests = []struct {
+		s   string
+		v   pieql.MapValuer
+		exp interface{}
+	}{
+		// Comparisons against literals.
+		{s: `name = 'bob'`, v: pieql.MapValuer{"name": "bob"}, exp: true},
+		{s: `name != 'bob'`, v: pieql.MapValuer{"name": "bob"}, exp: false},
+		{s: `name < 'susy'`, v: pieql.MapValuer{"name": "bob"}, exp: true},
+
+		// Strings holding numbers compare numerically against numbers.
+		{s: `age > 9`, v: pieql.MapValuer{"age": "10"}, exp: true},
+		{s: `age <= 10.0`, v: pieql.MapValuer{"age": "10"}, exp: true},
+		{s: `age >= 11`, v: pieql.MapValuer{"age": "10"}, exp: false},
+		{s: `age = 10`, v: pieql.MapValuer{"age": "ten"}, exp: false},
+
+		// Missing values never match.
+		{s: `age = 10`, v: pieql.MapValuer{}, exp: false},
+		{s: `age != 10`, v: pieql.MapValuer{}, exp: false},
+
+		// Boolean operators.
+		{s: `a = 1 AND b = 2`, v: pieql.MapValuer{"a": "1", "b": "2"}, exp: true},
+		{s: `a = 1 AND b = 3`, v: pieql.MapValuer{"a": "1", "b": "2"}, exp: false},
+		{s: `a = 0 OR b = 2`, v: pieql.MapValuer{"a": "1", "b": "2"}, exp: true},
+		{s: `NOT a = 1`, v: pieql.MapValuer{"a": "1"}, exp: false},
+		{s: `NOT (a = 0 OR a = 2)`, v: pieql.MapValuer{"a": "1"}, exp: true},
+
+		// Arithmetic operators.
+		{s: `price * qty`, v: pieql.MapValuer{"price": "2.5", "qty": "4"}, exp: float64(10)},
+		{s: `1 + 2 * 3 - 4 / 2`, v: pieql.MapValuer{}, exp: float64(5)},
+		{s: `(1 + 2) * 3`, v: pieql.MapValuer{}, exp: float64(9)},
+		{s: `7 % 4`, v: pieql.MapValuer{}, exp: float64(3)},
+		{s: `-a`, v: pieql.MapValuer{"a": "3"}, exp: float64(-3)},
+		{s: `a + 1`, v: pieql.MapValuer{"a": "x"}, exp: nil},
+		{s: `1 / 0`, v: pieql.MapValuer{}, exp: nil},
+		{s: `a * 2 > 5`, v: pieql.MapValuer{"a": "3"}, exp: true},
+
+		// String concatenation.
+		{s: `fname || ' ' || lname`, v: pieql.MapValuer{"fname": "susy", "lname": "que"}, exp: "susy que"},
+		{s: `'#' || n`, v: pieql.MapValuer{"n": float64(1.5)}, exp: "#1.5"},
+		{s: `'#' || n`, v: pieql.MapValuer{}, exp: nil},
+
+		// Typed values.
+		{s: `n = 10`, v: pieql.MapValuer{"n": int64(10)}, exp: true},
+		{s: `n > 9.5`, v: pieql.MapValuer{"n": int64(10)}, exp: true},
+		{s: `n + 1`, v: pieql.MapValuer{"n": int64(10)}, exp: float64(11)},
+		{s: `b = true`, v: pieql.MapValuer{"b": true}, exp: true},
+		{s: `b = 'false'`, v: pieql.MapValuer{"b": false}, exp: true},
+		{s: `NOT b`, v: pieql.MapValuer{"b": false}, exp: true},
+		{s: `t > '2015-01-01'`, v: pieql.MapValuer{"t": time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)}, exp: true},
+		{s: `t < '2015-01-02 00:00:00'`, v: pieql.MapValuer{"t": time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)}, exp: false},
+		{s: `t = 'yesterday'`, v: pieql.MapValuer{"t": time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)}, exp: false},
+
+		// Function calls are looked up by name.
+		{s: `count(*) > 1`, v: pieql.MapValuer{"count(*)": float64(2)}, exp: true},
+		{s: `sum(DISTINCT a)`, v: pieql.MapValuer{"sum(DISTINCT a)": float64(10)}, exp: float64(10)},
+	}
+
+	for i, tt := range tests {
+		expr, err := pieql.NewParser(strings.NewReader(tt.s)).ParseExpr()
+		if err != nil {
+			t.Errorf("%d. %q: parse error: %s", i, tt.s, err)
+			continue
+		}
+
+		if v := pieql.Eval(expr, tt.v); v != tt.exp {
+			t.Errorf("%d. %q: result mismatch: exp=%#v got=%#v", i, tt.s, tt.exp, v)
+		}
+	}
+}
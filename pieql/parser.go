@@ -1,8 +1,11 @@
 package pieql
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
 // Parser represents a PieQL parser.
@@ -10,6 +13,7 @@ type Parser struct {
 	s   *Scanner
 	buf struct {
 		tok Token  // last read token
+		pos Pos    // last read position
 		lit string // last read literal
 		n   int    // buffer size
 	}
@@ -20,8 +24,101 @@ func NewParser(r io.Reader) *Parser {
 	return &Parser{s: NewScanner(r)}
 }
 
-// Parse parses the next statement from the underlying reader.
-func (p *Parser) Parse() (*SelectStatement, error) {
+// Parse parses a single statement from the underlying reader.
+// The statement can optionally be terminated by a semicolon.
+func (p *Parser) Parse() (Statement, error) {
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip the optional semicolon.
+	if tok, _ := p.scanIgnoreWhitespace(); tok != SEMICOLON {
+		p.unscan()
+	}
+
+	// Ensure there is nothing trailing the statement.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != EOF {
+		return nil, p.newParseError(lit, "EOF")
+	}
+
+	return stmt, nil
+}
+
+// ParseStatements parses a semicolon-separated list of statements.
+func (p *Parser) ParseStatements() (Statements, error) {
+	return p.ParseStatementsContext(context.Background())
+}
+
+// ParseStatementsContext parses a semicolon-separated list of statements.
+// Returns the context's error if it's done before the script is parsed.
+func (p *Parser) ParseStatementsContext(ctx context.Context) (Statements, error) {
+	var stmts Statements
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Skip empty statements & stop at the end of the script.
+		tok, _ := p.scanIgnoreWhitespace()
+		if tok == SEMICOLON {
+			continue
+		} else if tok == EOF {
+			return stmts, nil
+		}
+		p.unscan()
+
+		// Read the next statement.
+		stmt, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+
+		// Statements must be separated by a semicolon.
+		if tok, lit := p.scanIgnoreWhitespace(); tok == EOF {
+			return stmts, nil
+		} else if tok != SEMICOLON {
+			return nil, p.newParseError(lit, ";")
+		}
+	}
+}
+
+// parseStatement parses a single statement based on its first keyword.
+func (p *Parser) parseStatement() (Statement, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case SELECT:
+		p.unscan()
+		return p.parseSelectStatement()
+	case CREATE:
+		if tok, lit := p.scanIgnoreWhitespace(); tok == TABLE {
+			return p.parseCreateTableStatement()
+		} else if tok == INDEX {
+			return p.parseCreateIndexStatement()
+		} else {
+			return nil, p.newParseError(lit, "TABLE", "INDEX")
+		}
+	case DROP:
+		return p.parseDropTableStatement()
+	case SHOW:
+		return p.parseShowTablesStatement()
+	case DESCRIBE:
+		return p.parseDescribeTableStatement()
+	case INSERT:
+		return p.parseInsertStatement()
+	case UPDATE:
+		return p.parseUpdateStatement()
+	case DELETE:
+		return p.parseDeleteStatement()
+	case EXPLAIN:
+		return p.parseExplainStatement()
+	}
+	return nil, p.newParseError(lit, "SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "SHOW", "DESCRIBE", "EXPLAIN")
+}
+
+// parseSelectStatement parses a SELECT statement.
+func (p *Parser) parseSelectStatement() (*SelectStatement, error) {
 	stmt := &SelectStatement{}
 
 	// Parse fields.
@@ -38,25 +135,351 @@ func (p *Parser) Parse() (*SelectStatement, error) {
 	}
 	stmt.Source = source
 
+	// Parse any joined sources.
+	joins, err := p.parseJoins()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Joins = joins
+
+	// Parse the optional condition.
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Condition = condition
+
+	// Parse the optional grouping expressions.
+	groupBy, err := p.parseGroupBy()
+	if err != nil {
+		return nil, err
+	}
+	stmt.GroupBy = groupBy
+
+	// Parse the optional group condition.
+	if tok, _ := p.scanIgnoreWhitespace(); tok == HAVING {
+		if stmt.Having, err = p.ParseExpr(); err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	// Parse the optional sort fields.
+	sortFields, err := p.parseSortFields()
+	if err != nil {
+		return nil, err
+	}
+	stmt.SortFields = sortFields
+
+	// Parse the optional limit & offset.
+	if stmt.Limit, err = p.parseOptionalInt(LIMIT); err != nil {
+		return nil, err
+	}
+	if offset, err := p.parseOptionalInt(OFFSET); err != nil {
+		return nil, err
+	} else if offset != nil {
+		stmt.Offset = *offset
+	}
+
 	return stmt, nil
 }
 
+// parseCreateTableStatement parses a CREATE TABLE statement.
+// This function assumes the CREATE & TABLE tokens have been consumed.
+func (p *Parser) parseCreateTableStatement() (*CreateTableStatement, error) {
+	stmt := &CreateTableStatement{}
+
+	// Read the table name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	stmt.Name = lit
+
+	// Read the column definitions.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, p.newParseError(lit, "(")
+	}
+	for {
+		// Read the column name and optional type.
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return nil, p.newParseError(lit, "column name")
+		}
+		def := &ColumnDefinition{Name: lit}
+		if tok, lit := p.scanIgnoreWhitespace(); tok == IDENT {
+			def.Type = strings.ToLower(lit)
+		} else {
+			p.unscan()
+		}
+		stmt.Columns = append(stmt.Columns, def)
+
+		// Read a comma or the closing parenthesis.
+		if tok, lit := p.scanIgnoreWhitespace(); tok == RPAREN {
+			return stmt, nil
+		} else if tok != COMMA {
+			return nil, p.newParseError(lit, ",", ")")
+		}
+	}
+}
+
+// parseCreateIndexStatement parses a CREATE INDEX statement.
+// This function assumes the CREATE & INDEX tokens have been consumed.
+func (p *Parser) parseCreateIndexStatement() (*CreateIndexStatement, error) {
+	stmt := &CreateIndexStatement{}
+
+	// Read the index name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "index name")
+	}
+	stmt.Name = lit
+
+	// Read the table name.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ON {
+		return nil, p.newParseError(lit, "ON")
+	}
+	if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	stmt.Table = lit
+
+	// Read the indexed column.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, p.newParseError(lit, "(")
+	}
+	if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT {
+		return nil, p.newParseError(lit, "column name")
+	}
+	stmt.Column = lit
+	if tok, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, p.newParseError(lit, ")")
+	}
+
+	return stmt, nil
+}
+
+// parseInsertStatement parses an INSERT INTO statement.
+// This function assumes the INSERT token has been consumed.
+func (p *Parser) parseInsertStatement() (*InsertStatement, error) {
+	stmt := &InsertStatement{}
+
+	// Read the table name.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != INTO {
+		return nil, p.newParseError(lit, "INTO")
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	stmt.Table = lit
+
+	// Read the optional column list.
+	if tok, _ := p.scanIgnoreWhitespace(); tok == LPAREN {
+		for {
+			tok, lit := p.scanIgnoreWhitespace()
+			if tok != IDENT {
+				return nil, p.newParseError(lit, "column name")
+			}
+			stmt.Columns = append(stmt.Columns, lit)
+
+			if tok, lit := p.scanIgnoreWhitespace(); tok == RPAREN {
+				break
+			} else if tok != COMMA {
+				return nil, p.newParseError(lit, ",", ")")
+			}
+		}
+	} else {
+		p.unscan()
+	}
+
+	// Read one or more comma-delimited lists of values.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != VALUES {
+		return nil, p.newParseError(lit, "VALUES")
+	}
+	for {
+		if tok, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+			return nil, p.newParseError(lit, "(")
+		}
+
+		var values []Expr
+		for {
+			expr, err := p.ParseExpr()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, expr)
+
+			if tok, lit := p.scanIgnoreWhitespace(); tok == RPAREN {
+				break
+			} else if tok != COMMA {
+				return nil, p.newParseError(lit, ",", ")")
+			}
+		}
+		stmt.Values = append(stmt.Values, values)
+
+		// Continue if there is another list of values.
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			return stmt, nil
+		}
+	}
+}
+
+// parseUpdateStatement parses an UPDATE statement.
+// This function assumes the UPDATE token has been consumed.
+func (p *Parser) parseUpdateStatement() (*UpdateStatement, error) {
+	stmt := &UpdateStatement{}
+
+	// Read the table name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	stmt.Table = lit
+
+	// Read one or more comma-delimited assignments.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != SET {
+		return nil, p.newParseError(lit, "SET")
+	}
+	for {
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return nil, p.newParseError(lit, "column name")
+		}
+		a := &Assignment{Column: lit}
+
+		if tok, lit := p.scanIgnoreWhitespace(); tok != EQ {
+			return nil, p.newParseError(lit, "=")
+		}
+		expr, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+		a.Expr = expr
+		stmt.Assignments = append(stmt.Assignments, a)
+
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+
+	// Parse the optional condition.
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Condition = condition
+
+	return stmt, nil
+}
+
+// parseDeleteStatement parses a DELETE FROM statement.
+// This function assumes the DELETE token has been consumed.
+func (p *Parser) parseDeleteStatement() (*DeleteStatement, error) {
+	stmt := &DeleteStatement{}
+
+	// Read the table name.
+	if tok, lit := p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, p.newParseError(lit, "FROM")
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	stmt.Table = lit
+
+	// Parse the optional condition.
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Condition = condition
+
+	return stmt, nil
+}
+
+// parseDropTableStatement parses a DROP TABLE statement.
+// This function assumes the DROP token has been consumed.
+func (p *Parser) parseDropTableStatement() (*DropTableStatement, error) {
+	stmt := &DropTableStatement{}
+
+	if tok, lit := p.scanIgnoreWhitespace(); tok != TABLE {
+		return nil, p.newParseError(lit, "TABLE")
+	}
+
+	// Read the optional IF EXISTS.
+	if tok, _ := p.scanIgnoreWhitespace(); tok == IF {
+		if tok, lit := p.scanIgnoreWhitespace(); tok != EXISTS {
+			return nil, p.newParseError(lit, "EXISTS")
+		}
+		stmt.IfExists = true
+	} else {
+		p.unscan()
+	}
+
+	// Read the table name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	stmt.Name = lit
+
+	return stmt, nil
+}
+
+// parseShowTablesStatement parses a SHOW TABLES statement.
+// This function assumes the SHOW token has been consumed.
+func (p *Parser) parseShowTablesStatement() (*ShowTablesStatement, error) {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != TABLES {
+		return nil, p.newParseError(lit, "TABLES")
+	}
+	return &ShowTablesStatement{}, nil
+}
+
+// parseDescribeTableStatement parses a DESCRIBE statement.
+// This function assumes the DESCRIBE token has been consumed.
+func (p *Parser) parseDescribeTableStatement() (*DescribeTableStatement, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	return &DescribeTableStatement{Name: lit}, nil
+}
+
+// parseExplainStatement parses an EXPLAIN statement.
+// This function assumes the EXPLAIN token has been consumed.
+func (p *Parser) parseExplainStatement() (*ExplainStatement, error) {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != SELECT {
+		return nil, p.newParseError(lit, "SELECT")
+	}
+	p.unscan()
+
+	stmt, err := p.parseSelectStatement()
+	if err != nil {
+		return nil, err
+	}
+	return &ExplainStatement{Statement: stmt}, nil
+}
+
 // parseFields parses one to all fields.
 func (p *Parser) parseFields() (Fields, error) {
 	var fields Fields
 
 	// Expect to see the "SELECT" keyword.
 	if tok, lit := p.scanIgnoreWhitespace(); tok != SELECT {
-		return nil, fmt.Errorf("found %q, expected SELECT", lit)
+		return nil, p.newParseError(lit, "SELECT")
 	}
 
 	for {
 		// Read a field.
-		tok, lit := p.scanIgnoreWhitespace()
-		if tok != IDENT && tok != MUL {
-			return nil, fmt.Errorf("found %q, expected field", lit)
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
 		}
-		fields = append(fields, &Field{Name: lit})
+		fields = append(fields, field)
 
 		// If the next token is not a comma then break the loop.
 		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
@@ -67,19 +490,359 @@ func (p *Parser) parseFields() (Fields, error) {
 	return fields, nil
 }
 
+// parseField parses a single field expression with an optional alias.
+func (p *Parser) parseField() (*Field, error) {
+	// Read the expression.
+	expr, err := p.ParseExpr()
+	if err != nil {
+		return nil, err
+	}
+	field := &Field{Expr: expr}
+
+	// Check for an alias.
+	if tok, _ := p.scanIgnoreWhitespace(); tok != AS {
+		p.unscan()
+		return field, nil
+	}
+
+	// Read the alias name.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "alias")
+	}
+	field.Alias = lit
+
+	return field, nil
+}
+
 // parseSource parses the source table for the query.
-func (p *Parser) parseSource() (string, error) {
+func (p *Parser) parseSource() (*Source, error) {
 	// Expect to see the "FROM" keyword.
 	if tok, lit := p.scanIgnoreWhitespace(); tok != FROM {
-		return "", fmt.Errorf("found %q, expected FROM", lit)
+		return nil, p.newParseError(lit, "FROM")
+	}
+
+	return p.parseTable()
+}
+
+// parseTable parses a table name with an optional alias.
+func (p *Parser) parseTable() (*Source, error) {
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, p.newParseError(lit, "table name")
+	}
+	source := &Source{Name: lit}
+
+	// Read the optional alias. The AS keyword is optional.
+	tok, lit = p.scanIgnoreWhitespace()
+	if tok == AS {
+		if tok, lit = p.scanIgnoreWhitespace(); tok != IDENT {
+			return nil, p.newParseError(lit, "alias")
+		}
+		source.Alias = lit
+	} else if tok == IDENT {
+		source.Alias = lit
+	} else {
+		p.unscan()
+	}
+
+	return source, nil
+}
+
+// parseJoins parses zero or more JOIN clauses.
+func (p *Parser) parseJoins() ([]*Join, error) {
+	var joins []*Join
+	for {
+		// Read the join type.
+		join := &Join{Type: INNER}
+		switch tok, _ := p.scanIgnoreWhitespace(); tok {
+		case JOIN:
+			p.unscan()
+		case INNER:
+		case LEFT:
+			join.Type = LEFT
+
+			// Skip the optional OUTER keyword.
+			if tok, _ := p.scanIgnoreWhitespace(); tok != OUTER {
+				p.unscan()
+			}
+		default:
+			p.unscan()
+			return joins, nil
+		}
+
+		// Expect to see the "JOIN" keyword.
+		if tok, lit := p.scanIgnoreWhitespace(); tok != JOIN {
+			return nil, p.newParseError(lit, "JOIN")
+		}
+
+		// Read the joined table.
+		source, err := p.parseTable()
+		if err != nil {
+			return nil, err
+		}
+		join.Source = source
+
+		// Read the join condition.
+		if tok, lit := p.scanIgnoreWhitespace(); tok != ON {
+			return nil, p.newParseError(lit, "ON")
+		}
+		if join.Condition, err = p.ParseExpr(); err != nil {
+			return nil, err
+		}
+
+		joins = append(joins, join)
+	}
+}
+
+// parseCondition parses the "WHERE" clause of the query, if it exists.
+func (p *Parser) parseCondition() (Expr, error) {
+	// Check if the WHERE token exists.
+	if tok, _ := p.scanIgnoreWhitespace(); tok != WHERE {
+		p.unscan()
+		return nil, nil
+	}
+
+	// Scan the expression.
+	return p.ParseExpr()
+}
+
+// parseGroupBy parses the "GROUP BY" clause of the query, if it exists.
+func (p *Parser) parseGroupBy() ([]Expr, error) {
+	// Check if the GROUP BY tokens exist.
+	if tok, _ := p.scanIgnoreWhitespace(); tok != GROUP {
+		p.unscan()
+		return nil, nil
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != BY {
+		return nil, p.newParseError(lit, "BY")
+	}
+
+	var exprs []Expr
+	for {
+		// Read the grouping expression.
+		expr, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		// If the next token is not a comma then break the loop.
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+	return exprs, nil
+}
+
+// parseSortFields parses the "ORDER BY" clause of the query, if it exists.
+func (p *Parser) parseSortFields() (SortFields, error) {
+	// Check if the ORDER BY tokens exist.
+	if tok, _ := p.scanIgnoreWhitespace(); tok != ORDER {
+		p.unscan()
+		return nil, nil
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != BY {
+		return nil, p.newParseError(lit, "BY")
+	}
+
+	var fields SortFields
+	for {
+		// Read the field or column name.
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return nil, p.newParseError(lit, "sort field")
+		}
+		table, name, err := p.parseQualifiedName(lit)
+		if err != nil {
+			return nil, err
+		}
+		field := &SortField{Table: table, Name: name, Ascending: true}
+
+		// Read the optional sort direction.
+		switch tok, _ := p.scanIgnoreWhitespace(); tok {
+		case ASC:
+		case DESC:
+			field.Ascending = false
+		default:
+			p.unscan()
+		}
+		fields = append(fields, field)
+
+		// If the next token is not a comma then break the loop.
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+	return fields, nil
+}
+
+// parseOptionalInt parses a keyword followed by an integer, if the keyword
+// exists. Returns nil if the keyword doesn't exist.
+func (p *Parser) parseOptionalInt(keyword Token) (*int, error) {
+	// Check if the keyword exists.
+	if tok, _ := p.scanIgnoreWhitespace(); tok != keyword {
+		p.unscan()
+		return nil, nil
+	}
+
+	// Read the integer value.
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != NUMBER {
+		return nil, p.newParseError(lit, "integer")
+	}
+	n, err := strconv.Atoi(lit)
+	if err != nil {
+		return nil, p.newParseError(lit, "integer")
+	}
+	return &n, nil
+}
+
+// ParseExpr parses an expression.
+func (p *Parser) ParseExpr() (Expr, error) {
+	return p.parseBinaryExpr(0)
+}
+
+// parseBinaryExpr parses a chain of binary operations whose operators bind
+// more tightly than prec. Operators of equal precedence are left associative.
+func (p *Parser) parseBinaryExpr(prec int) (Expr, error) {
+	// Read the left hand side.
+	expr, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		// If the next token is not a tighter binding operator then we're done.
+		op, _ := p.scanIgnoreWhitespace()
+		if op.Precedence() <= prec {
+			p.unscan()
+			return expr, nil
+		}
+
+		// Read the right hand side, consuming any tighter binding operators.
+		rhs, err := p.parseBinaryExpr(op.Precedence())
+		if err != nil {
+			return nil, err
+		}
+		expr = &BinaryExpr{Op: op, LHS: expr, RHS: rhs}
 	}
+}
+
+// notPrecedence is the binding strength of the NOT operator.
+// It binds tighter than AND & OR but looser than comparisons.
+const notPrecedence = 3
 
+// parseUnaryExpr parses a non-binary expression.
+func (p *Parser) parseUnaryExpr() (Expr, error) {
 	tok, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case NOT:
+		expr, err := p.parseBinaryExpr(notPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: NOT, Expr: expr}, nil
+	case SUB:
+		expr, err := p.parseUnaryExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		// Fold negative numbers into a single literal.
+		if lit, ok := expr.(*NumberLiteral); ok {
+			return &NumberLiteral{Val: -lit.Val}, nil
+		}
+		return &UnaryExpr{Op: SUB, Expr: expr}, nil
+	case LPAREN:
+		expr, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		// Expect a closing parenthesis.
+		if tok, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+			return nil, p.newParseError(lit, ")")
+		}
+		return &ParenExpr{Expr: expr}, nil
+	case MUL:
+		return &Wildcard{}, nil
+	case IDENT:
+		// If the identifier is followed by a parenthesis then it's a function call.
+		if tok, _ := p.scanIgnoreWhitespace(); tok == LPAREN {
+			return p.parseCall(lit)
+		}
+		p.unscan()
+
+		table, name, err := p.parseQualifiedName(lit)
+		if err != nil {
+			return nil, err
+		}
+		return &VarRef{Table: table, Val: name}, nil
+	case STRING:
+		return &StringLiteral{Val: lit}, nil
+	case TRUE, FALSE:
+		return &BooleanLiteral{Val: tok == TRUE}, nil
+	case NUMBER:
+		v, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, &ParseError{Message: "unable to parse number: " + lit, Pos: p.buf.pos}
+		}
+		return &NumberLiteral{Val: v}, nil
+	}
+	return nil, p.newParseError(lit, "expression")
+}
+
+// parseQualifiedName parses the column name following lit if lit is qualified
+// by a table. Otherwise lit is returned as the column name. Whitespace is
+// allowed on either side of the dot.
+func (p *Parser) parseQualifiedName(lit string) (table, name string, err error) {
+	if tok, _ := p.scanIgnoreWhitespace(); tok != DOT {
+		p.unscan()
+		return "", lit, nil
+	}
+	tok, name := p.scanIgnoreWhitespace()
 	if tok != IDENT {
-		return "", fmt.Errorf("found %q, expected table name", lit)
+		return "", "", p.newParseError(name, "column name")
 	}
+	return lit, name, nil
+}
+
+// parseCall parses a function call's arguments.
+// This function assumes the function name and opening parenthesis have been consumed.
+func (p *Parser) parseCall(name string) (*Call, error) {
+	call := &Call{Name: strings.ToLower(name)}
 
-	return lit, nil
+	// Check for the DISTINCT modifier.
+	if tok, _ := p.scanIgnoreWhitespace(); tok == DISTINCT {
+		call.Distinct = true
+	} else {
+		p.unscan()
+	}
+
+	// Return immediately if there are no arguments.
+	if tok, _ := p.scanIgnoreWhitespace(); tok == RPAREN {
+		return call, nil
+	}
+	p.unscan()
+
+	for {
+		// Read the argument.
+		arg, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		// Read a comma or the closing parenthesis.
+		if tok, lit := p.scanIgnoreWhitespace(); tok == RPAREN {
+			return call, nil
+		} else if tok != COMMA {
+			return nil, p.newParseError(lit, ",", ")")
+		}
+	}
 }
 
 // scan returns the next token from the scanner.
@@ -92,10 +855,10 @@ func (p *Parser) scan() (tok Token, lit string) {
 	}
 
 	// Otherwise read the next token from the scanner.
-	tok, lit = p.s.Scan()
+	tok, pos, lit := p.s.Scan()
 
 	// Save it to the buffer in case we need to unscan later.
-	p.buf.tok, p.buf.lit = tok, lit
+	p.buf.tok, p.buf.pos, p.buf.lit = tok, pos, lit
 
 	return
 }
@@ -103,6 +866,12 @@ func (p *Parser) scan() (tok Token, lit string) {
 // unscan pushes the previously read token back onto the buffer
 func (p *Parser) unscan() { p.buf.n = 1 }
 
+// newParseError returns an error for an unexpected token.
+// The position is taken from the last scanned token.
+func (p *Parser) newParseError(found string, expected ...string) *ParseError {
+	return &ParseError{Found: found, Expected: expected, Pos: p.buf.pos}
+}
+
 // scanIgnoreWhitespace scans the next non-whitespace token.
 func (p *Parser) scanIgnoreWhitespace() (tok Token, lit string) {
 	tok, lit = p.scan()
@@ -111,3 +880,27 @@ func (p *Parser) scanIgnoreWhitespace() (tok Token, lit string) {
 	}
 	return
 }
+
+// ParseError represents an error that occurred during parsing.
+type ParseError struct {
+	Message  string
+	Found    string
+	Expected []string
+	Pos      Pos
+}
+
+// Error returns the string representation of the error.
+func (e *ParseError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s at %s", e.Message, e.Pos)
+	}
+	return fmt.Sprintf("found %q, expected %s at %s", e.Found, joinExpected(e.Expected), e.Pos)
+}
+
+// joinExpected returns a human readable list of expected tokens.
+func joinExpected(a []string) string {
+	if len(a) < 2 {
+		return strings.Join(a, "")
+	}
+	return strings.Join(a[:len(a)-1], ", ") + " or " + a[len(a)-1]
+}
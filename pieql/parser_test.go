@@ -1,6 +1,7 @@
 package pieql_test
 
 import (
+	"context"
 	"reflect"
 	"strings"
 	"testing"
@@ -12,16 +13,16 @@ import (
 func TestParser_Parse(t *testing.T) {
 	var tests = []struct {
 		q    string
-		stmt *pieql.SelectStatement
+		stmt pieql.Statement
 	}{
 		// 0. Simple SELECT statement.
 		{
 			q: `SELECT fname FROM tbl`,
 			stmt: &pieql.SelectStatement{
 				Fields: pieql.Fields{
-					&pieql.Field{Name: "fname"},
+					&pieql.Field{Expr: &pieql.VarRef{Val: "fname"}},
 				},
-				Source: "tbl",
+				Source: &pieql.Source{Name: "tbl"},
 			},
 		},
 
@@ -30,11 +31,11 @@ func TestParser_Parse(t *testing.T) {
 			q: `SELECT fname, lname_23 , age FROM my_tbl  `,
 			stmt: &pieql.SelectStatement{
 				Fields: pieql.Fields{
-					&pieql.Field{Name: "fname"},
-					&pieql.Field{Name: "lname_23"},
-					&pieql.Field{Name: "age"},
+					&pieql.Field{Expr: &pieql.VarRef{Val: "fname"}},
+					&pieql.Field{Expr: &pieql.VarRef{Val: "lname_23"}},
+					&pieql.Field{Expr: &pieql.VarRef{Val: "age"}},
 				},
-				Source: "my_tbl",
+				Source: &pieql.Source{Name: "my_tbl"},
 			},
 		},
 
@@ -43,9 +44,318 @@ func TestParser_Parse(t *testing.T) {
 			q: `SELECT * FROM tbl`,
 			stmt: &pieql.SelectStatement{
 				Fields: pieql.Fields{
-					&pieql.Field{Name: "*"},
+					&pieql.Field{Expr: &pieql.Wildcard{}},
+				},
+				Source: &pieql.Source{Name: "tbl"},
+			},
+		},
+
+		// 3. SELECT statement with a condition.
+		{
+			q: `SELECT fname FROM tbl WHERE age >= 21 AND (state = 'CO' OR NOT vip != 'yes')`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{Expr: &pieql.VarRef{Val: "fname"}},
+				},
+				Source: &pieql.Source{Name: "tbl"},
+				Condition: &pieql.BinaryExpr{
+					Op: pieql.AND,
+					LHS: &pieql.BinaryExpr{
+						Op:  pieql.GTE,
+						LHS: &pieql.VarRef{Val: "age"},
+						RHS: &pieql.NumberLiteral{Val: 21},
+					},
+					RHS: &pieql.ParenExpr{
+						Expr: &pieql.BinaryExpr{
+							Op: pieql.OR,
+							LHS: &pieql.BinaryExpr{
+								Op:  pieql.EQ,
+								LHS: &pieql.VarRef{Val: "state"},
+								RHS: &pieql.StringLiteral{Val: "CO"},
+							},
+							RHS: &pieql.UnaryExpr{
+								Op: pieql.NOT,
+								Expr: &pieql.BinaryExpr{
+									Op:  pieql.NEQ,
+									LHS: &pieql.VarRef{Val: "vip"},
+									RHS: &pieql.StringLiteral{Val: "yes"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+
+		// 4. AND binds tighter than OR.
+		{
+			q: `SELECT * FROM tbl WHERE a < 1 OR b > 2 AND c <= 3.5`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{Expr: &pieql.Wildcard{}},
+				},
+				Source: &pieql.Source{Name: "tbl"},
+				Condition: &pieql.BinaryExpr{
+					Op: pieql.OR,
+					LHS: &pieql.BinaryExpr{
+						Op:  pieql.LT,
+						LHS: &pieql.VarRef{Val: "a"},
+						RHS: &pieql.NumberLiteral{Val: 1},
+					},
+					RHS: &pieql.BinaryExpr{
+						Op: pieql.AND,
+						LHS: &pieql.BinaryExpr{
+							Op:  pieql.GT,
+							LHS: &pieql.VarRef{Val: "b"},
+							RHS: &pieql.NumberLiteral{Val: 2},
+						},
+						RHS: &pieql.BinaryExpr{
+							Op:  pieql.LTE,
+							LHS: &pieql.VarRef{Val: "c"},
+							RHS: &pieql.NumberLiteral{Val: 3.5},
+						},
+					},
+				},
+			},
+		},
+
+		// 5. SELECT statement with sorting, limit & offset.
+		{
+			q: `SELECT fname FROM tbl WHERE age > 10 ORDER BY lname DESC, fname ASC, age LIMIT 20 OFFSET 40`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{Expr: &pieql.VarRef{Val: "fname"}},
+				},
+				Source: &pieql.Source{Name: "tbl"},
+				Condition: &pieql.BinaryExpr{
+					Op:  pieql.GT,
+					LHS: &pieql.VarRef{Val: "age"},
+					RHS: &pieql.NumberLiteral{Val: 10},
+				},
+				SortFields: pieql.SortFields{
+					&pieql.SortField{Name: "lname", Ascending: false},
+					&pieql.SortField{Name: "fname", Ascending: true},
+					&pieql.SortField{Name: "age", Ascending: true},
+				},
+				Limit:  intptr(20),
+				Offset: 40,
+			},
+		},
+
+		// 6. SELECT statement with aggregates, grouping and a group condition.
+		{
+			q: `SELECT state, COUNT(*), count(DISTINCT name), SUM(age) FROM tbl GROUP BY state HAVING count(*) > 1`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{Expr: &pieql.VarRef{Val: "state"}},
+					&pieql.Field{Expr: &pieql.Call{Name: "count", Args: []pieql.Expr{&pieql.Wildcard{}}}},
+					&pieql.Field{Expr: &pieql.Call{Name: "count", Distinct: true, Args: []pieql.Expr{&pieql.VarRef{Val: "name"}}}},
+					&pieql.Field{Expr: &pieql.Call{Name: "sum", Args: []pieql.Expr{&pieql.VarRef{Val: "age"}}}},
+				},
+				Source:  &pieql.Source{Name: "tbl"},
+				GroupBy: []pieql.Expr{&pieql.VarRef{Val: "state"}},
+				Having: &pieql.BinaryExpr{
+					Op:  pieql.GT,
+					LHS: &pieql.Call{Name: "count", Args: []pieql.Expr{&pieql.Wildcard{}}},
+					RHS: &pieql.NumberLiteral{Val: 1},
+				},
+			},
+		},
+
+		// 7. SELECT statement with computed fields and aliases.
+		{
+			q: `SELECT price * qty + -1 AS total, fname || ' ' || lname AS name, -a % 2 FROM tbl ORDER BY total`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{
+						Expr: &pieql.BinaryExpr{
+							Op: pieql.ADD,
+							LHS: &pieql.BinaryExpr{
+								Op:  pieql.MUL,
+								LHS: &pieql.VarRef{Val: "price"},
+								RHS: &pieql.VarRef{Val: "qty"},
+							},
+							RHS: &pieql.NumberLiteral{Val: -1},
+						},
+						Alias: "total",
+					},
+					&pieql.Field{
+						Expr: &pieql.BinaryExpr{
+							Op: pieql.CONCAT,
+							LHS: &pieql.BinaryExpr{
+								Op:  pieql.CONCAT,
+								LHS: &pieql.VarRef{Val: "fname"},
+								RHS: &pieql.StringLiteral{Val: " "},
+							},
+							RHS: &pieql.VarRef{Val: "lname"},
+						},
+						Alias: "name",
+					},
+					&pieql.Field{
+						Expr: &pieql.BinaryExpr{
+							Op:  pieql.MOD,
+							LHS: &pieql.UnaryExpr{Op: pieql.SUB, Expr: &pieql.VarRef{Val: "a"}},
+							RHS: &pieql.NumberLiteral{Val: 2},
+						},
+					},
+				},
+				Source: &pieql.Source{Name: "tbl"},
+				SortFields: pieql.SortFields{
+					&pieql.SortField{Name: "total", Ascending: true},
+				},
+			},
+		},
+
+		// 8. SELECT statement with joins and qualified columns.
+		{
+			q: `SELECT o.id, c.name FROM orders o JOIN customers AS c ON o.customer_id = c.id LEFT OUTER JOIN notes ON notes.order_id = o.id WHERE total > 10 ORDER BY c.name DESC`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{Expr: &pieql.VarRef{Table: "o", Val: "id"}},
+					&pieql.Field{Expr: &pieql.VarRef{Table: "c", Val: "name"}},
+				},
+				Source: &pieql.Source{Name: "orders", Alias: "o"},
+				Joins: []*pieql.Join{
+					{
+						Type:   pieql.INNER,
+						Source: &pieql.Source{Name: "customers", Alias: "c"},
+						Condition: &pieql.BinaryExpr{
+							Op:  pieql.EQ,
+							LHS: &pieql.VarRef{Table: "o", Val: "customer_id"},
+							RHS: &pieql.VarRef{Table: "c", Val: "id"},
+						},
+					},
+					{
+						Type:   pieql.LEFT,
+						Source: &pieql.Source{Name: "notes"},
+						Condition: &pieql.BinaryExpr{
+							Op:  pieql.EQ,
+							LHS: &pieql.VarRef{Table: "notes", Val: "order_id"},
+							RHS: &pieql.VarRef{Table: "o", Val: "id"},
+						},
+					},
+				},
+				Condition: &pieql.BinaryExpr{
+					Op:  pieql.GT,
+					LHS: &pieql.VarRef{Val: "total"},
+					RHS: &pieql.NumberLiteral{Val: 10},
+				},
+				SortFields: pieql.SortFields{
+					&pieql.SortField{Table: "c", Name: "name", Ascending: false},
+				},
+			},
+		},
+
+		// 9. SELECT statement with quoted identifiers and unicode.
+		{
+			q: `SELECT "First Name", s."prix-€" AS "Prix (€)", prénom FROM "sales-2024.v2" s WHERE "First Name" = 'O''Brien'`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{Expr: &pieql.VarRef{Val: "First Name"}},
+					&pieql.Field{Expr: &pieql.VarRef{Table: "s", Val: "prix-€"}, Alias: "Prix (€)"},
+					&pieql.Field{Expr: &pieql.VarRef{Val: "prénom"}},
+				},
+				Source: &pieql.Source{Name: "sales-2024.v2", Alias: "s"},
+				Condition: &pieql.BinaryExpr{
+					Op:  pieql.EQ,
+					LHS: &pieql.VarRef{Val: "First Name"},
+					RHS: &pieql.StringLiteral{Val: "O'Brien"},
+				},
+			},
+		},
+
+		// 10. CREATE TABLE statement with optional column types.
+		{
+			q: `CREATE TABLE "my-tbl" (id INTEGER, name, born timestamp);`,
+			stmt: &pieql.CreateTableStatement{
+				Name: "my-tbl",
+				Columns: []*pieql.ColumnDefinition{
+					{Name: "id", Type: "integer"},
+					{Name: "name"},
+					{Name: "born", Type: "timestamp"},
+				},
+			},
+		},
+
+		// 11. CREATE INDEX statement.
+		{q: `CREATE INDEX "by name" ON tbl (name)`, stmt: &pieql.CreateIndexStatement{Name: "by name", Table: "tbl", Column: "name"}},
+
+		// 12. DROP TABLE statements.
+		{q: `DROP TABLE tbl`, stmt: &pieql.DropTableStatement{Name: "tbl"}},
+		{q: `DROP TABLE IF EXISTS tbl`, stmt: &pieql.DropTableStatement{Name: "tbl", IfExists: true}},
+
+		// 13. SHOW TABLES & DESCRIBE statements.
+		{q: `SHOW TABLES`, stmt: &pieql.ShowTablesStatement{}},
+		{q: `DESCRIBE tbl`, stmt: &pieql.DescribeTableStatement{Name: "tbl"}},
+
+		// 14. EXPLAIN statement.
+		{
+			q: `EXPLAIN SELECT * FROM tbl`,
+			stmt: &pieql.ExplainStatement{
+				Statement: &pieql.SelectStatement{
+					Fields: pieql.Fields{
+						&pieql.Field{Expr: &pieql.Wildcard{}},
+					},
+					Source: &pieql.Source{Name: "tbl"},
+				},
+			},
+		},
+
+		// 15. INSERT statement with columns and multiple rows.
+		{
+			q: `INSERT INTO tbl (id, "First Name") VALUES (1, 'bob'), (-2, 'a' || 'b')`,
+			stmt: &pieql.InsertStatement{
+				Table:   "tbl",
+				Columns: []string{"id", "First Name"},
+				Values: [][]pieql.Expr{
+					{&pieql.NumberLiteral{Val: 1}, &pieql.StringLiteral{Val: "bob"}},
+					{&pieql.NumberLiteral{Val: -2}, &pieql.BinaryExpr{Op: pieql.CONCAT, LHS: &pieql.StringLiteral{Val: "a"}, RHS: &pieql.StringLiteral{Val: "b"}}},
+				},
+			},
+		},
+
+		// 16. INSERT statement without columns.
+		{
+			q:    `INSERT INTO tbl VALUES (true)`,
+			stmt: &pieql.InsertStatement{Table: "tbl", Values: [][]pieql.Expr{{&pieql.BooleanLiteral{Val: true}}}},
+		},
+
+		// 17. UPDATE statement.
+		{
+			q: `UPDATE tbl SET age = age + 1, name = 'x' WHERE id = 2`,
+			stmt: &pieql.UpdateStatement{
+				Table: "tbl",
+				Assignments: []*pieql.Assignment{
+					{Column: "age", Expr: &pieql.BinaryExpr{Op: pieql.ADD, LHS: &pieql.VarRef{Val: "age"}, RHS: &pieql.NumberLiteral{Val: 1}}},
+					{Column: "name", Expr: &pieql.StringLiteral{Val: "x"}},
+				},
+				Condition: &pieql.BinaryExpr{Op: pieql.EQ, LHS: &pieql.VarRef{Val: "id"}, RHS: &pieql.NumberLiteral{Val: 2}},
+			},
+		},
+
+		// 18. DELETE statements.
+		{q: `DELETE FROM tbl`, stmt: &pieql.DeleteStatement{Table: "tbl"}},
+		{
+			q: `DELETE FROM tbl WHERE NOT active`,
+			stmt: &pieql.DeleteStatement{
+				Table:     "tbl",
+				Condition: &pieql.UnaryExpr{Op: pieql.NOT, Expr: &pieql.VarRef{Val: "active"}},
+			},
+		},
+
+		// 19. Qualified columns with whitespace around the dot.
+		{
+			q: `SELECT a .id, a. id FROM a ORDER BY a .id, a. id DESC`,
+			stmt: &pieql.SelectStatement{
+				Fields: pieql.Fields{
+					&pieql.Field{Expr: &pieql.VarRef{Table: "a", Val: "id"}},
+					&pieql.Field{Expr: &pieql.VarRef{Table: "a", Val: "id"}},
+				},
+				Source: &pieql.Source{Name: "a"},
+				SortFields: pieql.SortFields{
+					&pieql.SortField{Table: "a", Name: "id", Ascending: true},
+					&pieql.SortField{Table: "a", Name: "id", Ascending: false},
 				},
-				Source: "tbl",
 			},
 		},
 	}
@@ -62,22 +372,158 @@ func TestParser_Parse(t *testing.T) {
 
 		// Ensure AST matches.
 		if !reflect.DeepEqual(tt.stmt, stmt) {
-			t.Errorf("%d. %q: stmt mismatch:\n\n%#v", stmt)
+			t.Errorf("%d. %q: stmt mismatch:\n\n%#v", i, tt.q, stmt)
 			continue
 		}
 	}
 }
 
+// Ensure the parser can parse a script of multiple statements.
+func TestParser_ParseStatements(t *testing.T) {
+	stmts, err := pieql.NewParser(strings.NewReader(`
+		CREATE TABLE t (a integer);;
+		SHOW TABLES;
+		SELECT a FROM t;
+	`)).ParseStatements()
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(stmts, pieql.Statements{
+		&pieql.CreateTableStatement{Name: "t", Columns: []*pieql.ColumnDefinition{{Name: "a", Type: "integer"}}},
+		&pieql.ShowTablesStatement{},
+		&pieql.SelectStatement{
+			Fields: pieql.Fields{&pieql.Field{Expr: &pieql.VarRef{Val: "a"}}},
+			Source: &pieql.Source{Name: "t"},
+		},
+	}) {
+		t.Fatalf("unexpected statements: %s", stmts)
+	}
+
+	// Statements must be separated by semicolons.
+	if _, err := pieql.NewParser(strings.NewReader(`SHOW TABLES SHOW TABLES`)).ParseStatements(); err == nil || err.Error() != `found "SHOW", expected ; at line 1, column 13` {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// Ensure parsing stops once the context is canceled.
+func TestParser_ParseStatementsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pieql.NewParser(strings.NewReader(`SHOW TABLES`)).ParseStatementsContext(ctx); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure parse errors include the position, found token and expected tokens.
+func TestParser_Parse_ParseError(t *testing.T) {
+	_, err := pieql.NewParser(strings.NewReader("SELECT a\nFROM tbl\nWHERE (a = 1\n  b")).Parse()
+	if err, ok := err.(*pieql.ParseError); !ok {
+		t.Fatalf("unexpected error type: %T", err)
+	} else if !reflect.DeepEqual(err, &pieql.ParseError{
+		Found:    "b",
+		Expected: []string{")"},
+		Pos:      pieql.Pos{Offset: 33, Line: 4, Column: 3},
+	}) {
+		t.Fatalf("unexpected error: %#v", err)
+	} else if err.Error() != `found "b", expected ) at line 4, column 3` {
+		t.Fatalf("unexpected message: %s", err)
+	}
+}
+
+// Ensure statements can be converted back to PieQL.
+func TestSelectStatement_String(t *testing.T) {
+	var tests = []struct {
+		q   string
+		exp string
+	}{
+		{q: `select a, b from tbl`, exp: `SELECT a, b FROM tbl`},
+		{q: `SELECT "First Name", "select" FROM "sales-2024.v2" WHERE x = 'O''Brien'`, exp: `SELECT "First Name", "select" FROM "sales-2024.v2" WHERE x = 'O''Brien'`},
+		{q: `SELECT "a""b" AS "c d" FROM t1 x JOIN t2 ON x.id = t2."the id" ORDER BY x.id DESC LIMIT 1`, exp: `SELECT "a""b" AS "c d" FROM t1 AS x INNER JOIN t2 ON x.id = t2."the id" ORDER BY x.id DESC LIMIT 1`},
+		{q: `SELECT a FROM t LIMIT 0 OFFSET 0`, exp: `SELECT a FROM t LIMIT 0`},
+		{q: `SELECT 'a\\', 'b\'c', 'd:\e' FROM t`, exp: `SELECT 'a\\', 'b''c', 'd:\\e' FROM t`},
+		{q: `SELECT "a\\b", "c\"d" FROM "e\f"`, exp: `SELECT "a\\b", "c""d" FROM "e\\f"`},
+		{q: `SELECT state, count(DISTINCT name) FROM t GROUP BY state HAVING count(*) > 1 ORDER BY state`, exp: `SELECT state, count(DISTINCT name) FROM t GROUP BY state HAVING count(*) > 1 ORDER BY state ASC`},
+		{q: `create table "a b" (x INTEGER, y)`, exp: `CREATE TABLE "a b" (x integer, y)`},
+		{q: `create index i on "a b" (x)`, exp: `CREATE INDEX i ON "a b" (x)`},
+		{q: `drop table if exists t`, exp: `DROP TABLE IF EXISTS t`},
+		{q: `show tables`, exp: `SHOW TABLES`},
+		{q: `describe "a b"`, exp: `DESCRIBE "a b"`},
+		{q: `explain select a from t where a > 1`, exp: `EXPLAIN SELECT a FROM t WHERE a > 1`},
+		{q: `insert into t ("a b", c) values (1, 'x'), (2, b)`, exp: `INSERT INTO t ("a b", c) VALUES (1, 'x'), (2, b)`},
+		{q: `insert into t values ('it''s')`, exp: `INSERT INTO t VALUES ('it''s')`},
+		{q: `update t set a = a * 2, "b c" = 'y' where a > 1`, exp: `UPDATE t SET a = a * 2, "b c" = 'y' WHERE a > 1`},
+		{q: `delete from t`, exp: `DELETE FROM t`},
+		{q: `delete from t where a = 1`, exp: `DELETE FROM t WHERE a = 1`},
+	}
+
+	for i, tt := range tests {
+		stmt, err := pieql.NewParser(strings.NewReader(tt.q)).Parse()
+		if err != nil {
+			t.Errorf("%d. %q: error: %s", i, tt.q, err)
+		} else if s := stmt.String(); s != tt.exp {
+			t.Errorf("%d. %q: string mismatch:\n\nexp=%s\n\ngot=%s", i, tt.q, tt.exp, s)
+		} else if other, err := pieql.NewParser(strings.NewReader(s)).Parse(); err != nil {
+			t.Errorf("%d. %q: reparse error: %s", i, s, err)
+		} else if !reflect.DeepEqual(stmt, other) {
+			t.Errorf("%d. %q: round trip mismatch: %s", i, s, other)
+		}
+	}
+}
+
 // Ensure the parser can return parse errors.
 func TestParser_Parse_Err(t *testing.T) {
 	var tests = []struct {
 		q   string
 		err string
 	}{
-		{q: `FROM`, err: `found "FROM", expected SELECT`},
-		{q: `SELECT !`, err: `found "!", expected field`},
-		{q: `SELECT field1 field2`, err: `found "field2", expected FROM`},
-		{q: `SELECT field1 FROM !`, err: `found "!", expected table name`},
+		{q: `FROM`, err: `found "FROM", expected SELECT, INSERT, UPDATE, DELETE, CREATE, DROP, SHOW, DESCRIBE or EXPLAIN at line 1, column 1`},
+		{q: `SELECT !`, err: `found "!", expected expression at line 1, column 8`},
+		{q: `SELECT field1 field2`, err: `found "field2", expected FROM at line 1, column 15`},
+		{q: `SELECT field1 FROM !`, err: `found "!", expected table name at line 1, column 20`},
+		{q: `SELECT field1 FROM tbl WHERE`, err: `found "", expected expression at line 1, column 29`},
+		{q: `SELECT field1 FROM tbl WHERE (a = 1`, err: `found "", expected ) at line 1, column 36`},
+		{q: `SELECT field1 FROM tbl WHERE a = 1 b`, err: `found "b", expected EOF at line 1, column 36`},
+		{q: `SELECT field1 FROM tbl WHRE a = 1`, err: `found "a", expected EOF at line 1, column 29`},
+		{q: `SELECT field1 FROM tbl ORDER field1`, err: `found "field1", expected BY at line 1, column 30`},
+		{q: `SELECT field1 FROM tbl ORDER BY 1`, err: `found "1", expected sort field at line 1, column 33`},
+		{q: `SELECT field1 FROM tbl LIMIT x`, err: `found "x", expected integer at line 1, column 30`},
+		{q: `SELECT field1 FROM tbl LIMIT 1.5`, err: `found "1.5", expected integer at line 1, column 30`},
+		{q: `SELECT field1 FROM tbl OFFSET 1 LIMIT 2`, err: `found "LIMIT", expected EOF at line 1, column 33`},
+		{q: `SELECT count(a b) FROM tbl`, err: `found "b", expected , or ) at line 1, column 16`},
+		{q: `SELECT a FROM tbl GROUP a`, err: `found "a", expected BY at line 1, column 25`},
+		{q: `SELECT a FROM tbl GROUP BY`, err: `found "", expected expression at line 1, column 27`},
+		{q: `SELECT a AS 1 FROM tbl`, err: `found "1", expected alias at line 1, column 13`},
+		{q: `SELECT a FROM tbl AS 1`, err: `found "1", expected alias at line 1, column 22`},
+		{q: `SELECT a FROM tbl LEFT x`, err: `found "x", expected JOIN at line 1, column 24`},
+		{q: `SELECT a FROM tbl JOIN x y = 1`, err: `found "=", expected ON at line 1, column 28`},
+		{q: `SELECT a FROM tbl JOIN 1`, err: `found "1", expected table name at line 1, column 24`},
+		{q: `SELECT t.1 FROM tbl`, err: `found "1", expected column name at line 1, column 10`},
+		{q: `SELECT a FROM tbl ORDER BY t. 1`, err: `found "1", expected column name at line 1, column 31`},
+		{q: `SELECT a | b FROM tbl`, err: `found "|", expected FROM at line 1, column 10`},
+		{q: `SELECT a FROM tbl; SELECT b FROM tbl`, err: `found "SELECT", expected EOF at line 1, column 20`},
+		{q: `CREATE tbl`, err: `found "tbl", expected TABLE or INDEX at line 1, column 8`},
+		{q: `CREATE INDEX idx tbl`, err: `found "tbl", expected ON at line 1, column 18`},
+		{q: `CREATE INDEX idx ON tbl (a, b)`, err: `found ",", expected ) at line 1, column 27`},
+		{q: `CREATE TABLE tbl a`, err: `found "a", expected ( at line 1, column 18`},
+		{q: `CREATE TABLE tbl (1)`, err: `found "1", expected column name at line 1, column 19`},
+		{q: `CREATE TABLE tbl (a integer b)`, err: `found "b", expected , or ) at line 1, column 29`},
+		{q: `DROP TABLE IF tbl`, err: `found "tbl", expected EXISTS at line 1, column 15`},
+		{q: `SHOW tbl`, err: `found "tbl", expected TABLES at line 1, column 6`},
+		{q: `DESCRIBE 1`, err: `found "1", expected table name at line 1, column 10`},
+		{q: `EXPLAIN DELETE FROM tbl`, err: `found "DELETE", expected SELECT at line 1, column 9`},
+		{q: `INSERT tbl`, err: `found "tbl", expected INTO at line 1, column 8`},
+		{q: `INSERT INTO 1`, err: `found "1", expected table name at line 1, column 13`},
+		{q: `INSERT INTO tbl (1)`, err: `found "1", expected column name at line 1, column 18`},
+		{q: `INSERT INTO tbl (a b)`, err: `found "b", expected , or ) at line 1, column 20`},
+		{q: `INSERT INTO tbl (a) SELECT`, err: `found "SELECT", expected VALUES at line 1, column 21`},
+		{q: `INSERT INTO tbl VALUES 1`, err: `found "1", expected ( at line 1, column 24`},
+		{q: `INSERT INTO tbl VALUES (1 2)`, err: `found "2", expected , or ) at line 1, column 27`},
+		{q: `INSERT INTO tbl VALUES (1),`, err: `found "", expected ( at line 1, column 28`},
+		{q: `UPDATE tbl a = 1`, err: `found "a", expected SET at line 1, column 12`},
+		{q: `UPDATE tbl SET 1 = 1`, err: `found "1", expected column name at line 1, column 16`},
+		{q: `UPDATE tbl SET a 1`, err: `found "1", expected = at line 1, column 18`},
+		{q: `UPDATE tbl SET a = 1 b = 2`, err: `found "b", expected EOF at line 1, column 22`},
+		{q: `DELETE tbl`, err: `found "tbl", expected FROM at line 1, column 8`},
+		{q: `DELETE FROM tbl WHERE`, err: `found "", expected expression at line 1, column 22`},
 	}
 
 	// Parse querystring into AST.
@@ -90,3 +536,6 @@ func TestParser_Parse_Err(t *testing.T) {
 		}
 	}
 }
+
+// intptr returns a pointer to n.
+func intptr(n int) *int { return &n }
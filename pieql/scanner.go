@@ -4,22 +4,31 @@ import (
 	"bufio"
 	"bytes"
 	"io"
-	"strings"
+	"unicode"
 )
 
 // Scanner represents a lexical scanner for PieQL.
 type Scanner struct {
-	r *bufio.Reader
+	r    *bufio.Reader
+	pos  Pos // position of the next rune
+	prev Pos // position before the last read, restored by unread
 }
 
 // NewScanner returns an instance of Scanner.
 func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+	return &Scanner{r: bufio.NewReader(r), pos: Pos{Line: 1, Column: 1}}
 }
 
-// Scan returns the enxt token and position from the reader.
+// Scan returns the next token and position from the reader.
 // Also returns the literal text read for strings.
-func (s *Scanner) Scan() (tok Token, lit string) {
+func (s *Scanner) Scan() (tok Token, pos Pos, lit string) {
+	pos = s.pos
+	tok, lit = s.scan()
+	return tok, pos, lit
+}
+
+// scan returns the next token and its literal text.
+func (s *Scanner) scan() (tok Token, lit string) {
 	// read the next rune
 	ch := s.read()
 
@@ -29,19 +38,70 @@ func (s *Scanner) Scan() (tok Token, lit string) {
 	if isWhitespace(ch) {
 		s.unread()
 		return s.scanWhitespace()
-	} else if isLetter(ch) {
+	} else if isLetter(ch) || ch == '_' {
 		s.unread()
 		return s.scanIdent()
+	} else if isDigit(ch) {
+		s.unread()
+		return s.scanNumber()
 	}
 
 	// Otherwise read the individual character.
 	switch ch {
 	case eof:
 		return EOF, ""
+	case '+':
+		return ADD, string(ch)
+	case '-':
+		return SUB, string(ch)
 	case '*':
 		return MUL, string(ch)
+	case '/':
+		return DIV, string(ch)
+	case '%':
+		return MOD, string(ch)
+	case '|':
+		if ch1 := s.read(); ch1 == '|' {
+			return CONCAT, "||"
+		}
+		s.unread()
 	case ',':
 		return COMMA, string(ch)
+	case ';':
+		return SEMICOLON, string(ch)
+	case '.':
+		return DOT, string(ch)
+	case '(':
+		return LPAREN, string(ch)
+	case ')':
+		return RPAREN, string(ch)
+	case '\'':
+		s.unread()
+		return s.scanString()
+	case '"':
+		s.unread()
+		return s.scanQuotedIdent()
+	case '=':
+		return EQ, string(ch)
+	case '!':
+		if ch1 := s.read(); ch1 == '=' {
+			return NEQ, "!="
+		}
+		s.unread()
+	case '<':
+		if ch1 := s.read(); ch1 == '=' {
+			return LTE, "<="
+		} else if ch1 == '>' {
+			return NEQ, "<>"
+		}
+		s.unread()
+		return LT, string(ch)
+	case '>':
+		if ch1 := s.read(); ch1 == '=' {
+			return GTE, ">="
+		}
+		s.unread()
+		return GT, string(ch)
 	}
 
 	return ILLEGAL, string(ch)
@@ -79,7 +139,7 @@ func (s *Scanner) scanIdent() (tok Token, lit string) {
 	for {
 		if ch := s.read(); ch == eof {
 			break
-		} else if !isLetter(ch) && !isDigit(ch) && ch != '_' {
+		} else if !isIdentChar(ch) {
 			s.unread()
 			break
 		} else {
@@ -87,32 +147,133 @@ func (s *Scanner) scanIdent() (tok Token, lit string) {
 		}
 	}
 
-	// If the string matches a keyword, return that keyword.
-	switch strings.ToUpper(buf.String()) {
-	case "SELECT":
-		return SELECT, buf.String()
-	case "FROM":
-		return FROM, buf.String()
+	// If the string matches a keyword then return that keyword.
+	// Otherwise return as a regular identifier.
+	return Lookup(buf.String()), buf.String()
+}
+
+// scanNumber consumes a run of digits with an optional decimal part.
+func (s *Scanner) scanNumber() (tok Token, lit string) {
+	var buf bytes.Buffer
+	buf.WriteString(s.scanDigits())
+
+	// If the digits are followed by a decimal point then read the fraction.
+	if ch := s.read(); ch == '.' {
+		buf.WriteRune(ch)
+		buf.WriteString(s.scanDigits())
+	} else if ch != eof {
+		s.unread()
 	}
 
-	// Otherwise return as a regular identifier.
-	return IDENT, buf.String()
+	return NUMBER, buf.String()
+}
+
+// scanDigits consumes contiguous digits and returns them.
+func (s *Scanner) scanDigits() string {
+	var buf bytes.Buffer
+	for {
+		if ch := s.read(); ch == eof {
+			break
+		} else if !isDigit(ch) {
+			s.unread()
+			break
+		} else {
+			_, _ = buf.WriteRune(ch)
+		}
+	}
+	return buf.String()
+}
+
+// scanString consumes a single-quoted string literal.
+// The returned literal excludes the surrounding quotes.
+func (s *Scanner) scanString() (tok Token, lit string) {
+	lit, ok := s.scanDelimited('\'')
+	if !ok {
+		return ILLEGAL, "'" + lit
+	}
+	return STRING, lit
+}
+
+// scanQuotedIdent consumes a double-quoted identifier.
+// Quoted identifiers can contain any character and are never keywords.
+func (s *Scanner) scanQuotedIdent() (tok Token, lit string) {
+	lit, ok := s.scanDelimited('"')
+	if !ok {
+		return ILLEGAL, `"` + lit
+	}
+	return IDENT, lit
+}
+
+// scanDelimited consumes text surrounded by a quote character and returns
+// the unescaped text. The quote can be escaped by doubling it or with a
+// backslash, and a backslash can be escaped with another backslash. Other
+// backslashes are kept as-is. Returns false if the closing quote is missing.
+func (s *Scanner) scanDelimited(quote rune) (string, bool) {
+	// Read the opening quote.
+	s.read()
+
+	var buf bytes.Buffer
+	for {
+		ch := s.read()
+		switch ch {
+		case eof:
+			return buf.String(), false
+		case quote:
+			// A doubled quote is an escaped quote. Otherwise it's the end.
+			if ch1 := s.read(); ch1 != quote {
+				if ch1 != eof {
+					s.unread()
+				}
+				return buf.String(), true
+			}
+			_, _ = buf.WriteRune(quote)
+		case '\\':
+			// Unescape quotes & backslashes. Keep other escapes as-is.
+			ch1 := s.read()
+			if ch1 == quote || ch1 == '\\' {
+				_, _ = buf.WriteRune(ch1)
+				continue
+			}
+			_, _ = buf.WriteRune(ch)
+			if ch1 == eof {
+				return buf.String(), false
+			}
+			s.unread()
+		default:
+			_, _ = buf.WriteRune(ch)
+		}
+	}
 }
 
-// Reads the next rune from the reader.
+// Reads the next rune from the reader and advances the position.
 func (s *Scanner) read() rune {
-	ch, _, err := s.r.ReadRune()
+	s.prev = s.pos
+	ch, size, err := s.r.ReadRune()
 	if err != nil {
 		return eof
 	}
+
+	s.pos.Offset += size
+	if ch == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
 	return ch
 }
 
 // unread places the previously read rune back onto the reader.
-func (s *Scanner) unread() { _ = s.r.UnreadRune() }
+func (s *Scanner) unread() {
+	_ = s.r.UnreadRune()
+	s.pos = s.prev
+}
 
 var eof = rune(0)
 
-func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' }
-func isLetter(ch rune) bool     { return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') }
+func isWhitespace(ch rune) bool { return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' }
+func isLetter(ch rune) bool     { return unicode.IsLetter(ch) }
 func isDigit(ch rune) bool      { return (ch >= '0' && ch <= '9') }
+
+// isIdentChar returns true if ch can appear after the first rune of an unquoted identifier.
+func isIdentChar(ch rune) bool { return isLetter(ch) || unicode.IsDigit(ch) || ch == '_' }
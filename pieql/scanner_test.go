@@ -24,20 +24,94 @@ func TestScanner_Scan(t *testing.T) {
 		// Misc
 		{s: `*`, tok: pieql.MUL, lit: `*`},
 		{s: `,`, tok: pieql.COMMA, lit: `,`},
+		{s: `.`, tok: pieql.DOT, lit: `.`},
+		{s: `(`, tok: pieql.LPAREN, lit: `(`},
+		{s: `)`, tok: pieql.RPAREN, lit: `)`},
+		{s: `;`, tok: pieql.SEMICOLON, lit: `;`},
+
+		// Operators
+		{s: `+`, tok: pieql.ADD, lit: `+`},
+		{s: `-`, tok: pieql.SUB, lit: `-`},
+		{s: `/`, tok: pieql.DIV, lit: `/`},
+		{s: `%`, tok: pieql.MOD, lit: `%`},
+		{s: `||`, tok: pieql.CONCAT, lit: `||`},
+		{s: `|`, tok: pieql.ILLEGAL, lit: `|`},
+		{s: `=`, tok: pieql.EQ, lit: `=`},
+		{s: `!=`, tok: pieql.NEQ, lit: `!=`},
+		{s: `<>`, tok: pieql.NEQ, lit: `<>`},
+		{s: `<`, tok: pieql.LT, lit: `<`},
+		{s: `<=`, tok: pieql.LTE, lit: `<=`},
+		{s: `>`, tok: pieql.GT, lit: `>`},
+		{s: `>=`, tok: pieql.GTE, lit: `>=`},
+		{s: `AND`, tok: pieql.AND, lit: `AND`},
+		{s: `or`, tok: pieql.OR, lit: `or`},
+
+		// Literals
+		{s: `100`, tok: pieql.NUMBER, lit: `100`},
+		{s: `10.25 `, tok: pieql.NUMBER, lit: `10.25`},
+		{s: `'foo bar'`, tok: pieql.STRING, lit: `foo bar`},
+		{s: `''`, tok: pieql.STRING, lit: ``},
+		{s: `'foo`, tok: pieql.ILLEGAL, lit: `'foo`},
+		{s: `'it''s'`, tok: pieql.STRING, lit: `it's`},
+		{s: `'it\'s'`, tok: pieql.STRING, lit: `it's`},
+		{s: `'C:\data\\x'`, tok: pieql.STRING, lit: `C:\data\x`},
+		{s: `'héllo wörld'`, tok: pieql.STRING, lit: `héllo wörld`},
 
 		// Identifiers
 		{s: `foo`, tok: pieql.IDENT, lit: `foo`},
 		{s: `foo_20 `, tok: pieql.IDENT, lit: `foo_20`},
+		{s: `_id`, tok: pieql.IDENT, lit: `_id`},
+		{s: `prénom`, tok: pieql.IDENT, lit: `prénom`},
+		{s: `数量2`, tok: pieql.IDENT, lit: `数量2`},
+		{s: `"First Name"`, tok: pieql.IDENT, lit: `First Name`},
+		{s: `"prix-€"`, tok: pieql.IDENT, lit: `prix-€`},
+		{s: `"select"`, tok: pieql.IDENT, lit: `select`},
+		{s: `"say ""hi"""`, tok: pieql.IDENT, lit: `say "hi"`},
+		{s: `"say \"hi\""`, tok: pieql.IDENT, lit: `say "hi"`},
+		{s: `"foo`, tok: pieql.ILLEGAL, lit: `"foo`},
 
 		// Keywords
 		{s: `SELECT`, tok: pieql.SELECT, lit: `SELECT`},
 		{s: `FROM`, tok: pieql.FROM, lit: `FROM`},
 		{s: `from`, tok: pieql.FROM, lit: `from`},
+		{s: `WHERE`, tok: pieql.WHERE, lit: `WHERE`},
+		{s: `NOT`, tok: pieql.NOT, lit: `NOT`},
+		{s: `ORDER`, tok: pieql.ORDER, lit: `ORDER`},
+		{s: `BY`, tok: pieql.BY, lit: `BY`},
+		{s: `ASC`, tok: pieql.ASC, lit: `ASC`},
+		{s: `desc`, tok: pieql.DESC, lit: `desc`},
+		{s: `LIMIT`, tok: pieql.LIMIT, lit: `LIMIT`},
+		{s: `OFFSET`, tok: pieql.OFFSET, lit: `OFFSET`},
+		{s: `GROUP`, tok: pieql.GROUP, lit: `GROUP`},
+		{s: `HAVING`, tok: pieql.HAVING, lit: `HAVING`},
+		{s: `DISTINCT`, tok: pieql.DISTINCT, lit: `DISTINCT`},
+		{s: `as`, tok: pieql.AS, lit: `as`},
+		{s: `TRUE`, tok: pieql.TRUE, lit: `TRUE`},
+		{s: `false`, tok: pieql.FALSE, lit: `false`},
+		{s: `JOIN`, tok: pieql.JOIN, lit: `JOIN`},
+		{s: `INNER`, tok: pieql.INNER, lit: `INNER`},
+		{s: `LEFT`, tok: pieql.LEFT, lit: `LEFT`},
+		{s: `OUTER`, tok: pieql.OUTER, lit: `OUTER`},
+		{s: `ON`, tok: pieql.ON, lit: `ON`},
+		{s: `CREATE`, tok: pieql.CREATE, lit: `CREATE`},
+		{s: `table`, tok: pieql.TABLE, lit: `table`},
+		{s: `DROP`, tok: pieql.DROP, lit: `DROP`},
+		{s: `IF`, tok: pieql.IF, lit: `IF`},
+		{s: `EXISTS`, tok: pieql.EXISTS, lit: `EXISTS`},
+		{s: `SHOW`, tok: pieql.SHOW, lit: `SHOW`},
+		{s: `TABLES`, tok: pieql.TABLES, lit: `TABLES`},
+		{s: `DESCRIBE`, tok: pieql.DESCRIBE, lit: `DESCRIBE`},
+		{s: `INSERT`, tok: pieql.INSERT, lit: `INSERT`},
+		{s: `into`, tok: pieql.INTO, lit: `into`},
+		{s: `VALUES`, tok: pieql.VALUES, lit: `VALUES`},
+		{s: `UPDATE`, tok: pieql.UPDATE, lit: `UPDATE`},
+		{s: `SET`, tok: pieql.SET, lit: `SET`},
+		{s: `DELETE`, tok: pieql.DELETE, lit: `DELETE`},
 	}
 
 	for i, tt := range tests {
 		s := pieql.NewScanner(strings.NewReader(tt.s))
-		tok, lit := s.Scan()
+		tok, _, lit := s.Scan()
 		if tt.tok != tok {
 			t.Errorf("%d. %q token mismatch: exp=%q got=%q <%q>", i, tt.s, tt.tok, tok, lit)
 		} else if tt.lit != lit {
@@ -45,3 +119,35 @@ func TestScanner_Scan(t *testing.T) {
 		}
 	}
 }
+
+// Ensure the scanner returns the position of each token.
+func TestScanner_Scan_Pos(t *testing.T) {
+	s := pieql.NewScanner(strings.NewReader("SELECT prénom,\n  'a''b' <= 1.5\r\n\"x\""))
+
+	var tests = []struct {
+		tok pieql.Token
+		pos pieql.Pos
+	}{
+		{tok: pieql.SELECT, pos: pieql.Pos{Offset: 0, Line: 1, Column: 1}},
+		{tok: pieql.WS, pos: pieql.Pos{Offset: 6, Line: 1, Column: 7}},
+		{tok: pieql.IDENT, pos: pieql.Pos{Offset: 7, Line: 1, Column: 8}},
+		{tok: pieql.COMMA, pos: pieql.Pos{Offset: 14, Line: 1, Column: 14}},
+		{tok: pieql.WS, pos: pieql.Pos{Offset: 15, Line: 1, Column: 15}},
+		{tok: pieql.STRING, pos: pieql.Pos{Offset: 18, Line: 2, Column: 3}},
+		{tok: pieql.WS, pos: pieql.Pos{Offset: 24, Line: 2, Column: 9}},
+		{tok: pieql.LTE, pos: pieql.Pos{Offset: 25, Line: 2, Column: 10}},
+		{tok: pieql.WS, pos: pieql.Pos{Offset: 27, Line: 2, Column: 12}},
+		{tok: pieql.NUMBER, pos: pieql.Pos{Offset: 28, Line: 2, Column: 13}},
+		{tok: pieql.WS, pos: pieql.Pos{Offset: 31, Line: 2, Column: 16}},
+		{tok: pieql.IDENT, pos: pieql.Pos{Offset: 33, Line: 3, Column: 1}},
+		{tok: pieql.EOF, pos: pieql.Pos{Offset: 36, Line: 3, Column: 4}},
+	}
+
+	for i, tt := range tests {
+		if tok, pos, lit := s.Scan(); tok != tt.tok {
+			t.Errorf("%d. token mismatch: exp=%s got=%s <%q>", i, tt.tok, tok, lit)
+		} else if pos != tt.pos {
+			t.Errorf("%d. %s: position mismatch: exp=%#v got=%#v", i, tok, tt.pos, pos)
+		}
+	}
+}
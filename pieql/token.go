@@ -1,5 +1,11 @@
 package pieql
 
+import (
+	"fmt"
+	"strings"
+)
+
+// Token is a lexical token of PieQL.
 type Token int
 
 const (
@@ -10,20 +16,206 @@ const (
 
 	// Miscellaneous
 	COMMA
+	SEMICOLON // ;
+	DOT       // .
+	LPAREN    // (
+	RPAREN    // )
 
 	//Literals
 	literal_beg
-	IDENT // abcde
+	IDENT  // abcde
+	NUMBER // 12345.67
+	STRING // 'abc'
 	literal_end
 
 	// Operators
 	operator_beg
-	MUL // *
+	ADD    // +
+	SUB    // -
+	MUL    // *
+	DIV    // /
+	MOD    // %
+	CONCAT // ||
+
+	AND // AND
+	OR  // OR
+
+	EQ  // =
+	NEQ // !=
+	LT  // <
+	LTE // <=
+	GT  // >
+	GTE // >=
 	operator_end
 
 	// Keywords
 	keyword_beg
 	SELECT
 	FROM
+	WHERE
+	NOT
+	ORDER
+	BY
+	ASC
+	DESC
+	LIMIT
+	OFFSET
+	GROUP
+	HAVING
+	DISTINCT
+	AS
+	TRUE
+	FALSE
+	JOIN
+	INNER
+	LEFT
+	OUTER
+	ON
+	CREATE
+	TABLE
+	INDEX
+	DROP
+	IF
+	EXISTS
+	SHOW
+	TABLES
+	DESCRIBE
+	EXPLAIN
+	INSERT
+	INTO
+	VALUES
+	UPDATE
+	SET
+	DELETE
 	keyword_end
 )
+
+var tokens = [...]string{
+	ILLEGAL: "ILLEGAL",
+	EOF:     "EOF",
+	WS:      "WS",
+
+	COMMA:     ",",
+	SEMICOLON: ";",
+	DOT:       ".",
+	LPAREN:    "(",
+	RPAREN:    ")",
+
+	IDENT:  "IDENT",
+	NUMBER: "NUMBER",
+	STRING: "STRING",
+
+	ADD:    "+",
+	SUB:    "-",
+	MUL:    "*",
+	DIV:    "/",
+	MOD:    "%",
+	CONCAT: "||",
+
+	AND: "AND",
+	OR:  "OR",
+
+	EQ:  "=",
+	NEQ: "!=",
+	LT:  "<",
+	LTE: "<=",
+	GT:  ">",
+	GTE: ">=",
+
+	SELECT: "SELECT",
+	FROM:   "FROM",
+	WHERE:  "WHERE",
+	NOT:    "NOT",
+	ORDER:  "ORDER",
+	BY:     "BY",
+	ASC:    "ASC",
+	DESC:   "DESC",
+	LIMIT:  "LIMIT",
+	OFFSET: "OFFSET",
+
+	GROUP:    "GROUP",
+	HAVING:   "HAVING",
+	DISTINCT: "DISTINCT",
+	AS:       "AS",
+	TRUE:     "TRUE",
+	FALSE:    "FALSE",
+	JOIN:     "JOIN",
+	INNER:    "INNER",
+	LEFT:     "LEFT",
+	OUTER:    "OUTER",
+	ON:       "ON",
+	CREATE:   "CREATE",
+	TABLE:    "TABLE",
+	INDEX:    "INDEX",
+	DROP:     "DROP",
+	IF:       "IF",
+	EXISTS:   "EXISTS",
+	SHOW:     "SHOW",
+	TABLES:   "TABLES",
+	DESCRIBE: "DESCRIBE",
+	EXPLAIN:  "EXPLAIN",
+	INSERT:   "INSERT",
+	INTO:     "INTO",
+	VALUES:   "VALUES",
+	UPDATE:   "UPDATE",
+	SET:      "SET",
+	DELETE:   "DELETE",
+}
+
+// keywords maps upper-cased keyword text to its token.
+var keywords map[string]Token
+
+func init() {
+	keywords = make(map[string]Token)
+	for tok := keyword_beg + 1; tok < keyword_end; tok++ {
+		keywords[tokens[tok]] = tok
+	}
+	keywords["AND"] = AND
+	keywords["OR"] = OR
+}
+
+// String returns the string representation of the token.
+func (tok Token) String() string {
+	if tok >= 0 && tok < Token(len(tokens)) {
+		return tokens[tok]
+	}
+	return ""
+}
+
+// Precedence returns the operator precedence of the binary operator token.
+// Returns 0 for tokens that are not binary operators.
+func (tok Token) Precedence() int {
+	switch tok {
+	case OR:
+		return 1
+	case AND:
+		return 2
+	case EQ, NEQ, LT, LTE, GT, GTE:
+		return 4
+	case ADD, SUB, CONCAT:
+		return 5
+	case MUL, DIV, MOD:
+		return 6
+	}
+	return 0
+}
+
+// Lookup returns the token associated with a given identifier.
+func Lookup(ident string) Token {
+	if tok, ok := keywords[strings.ToUpper(ident)]; ok {
+		return tok
+	}
+	return IDENT
+}
+
+// Pos specifies the position of a token within the query text.
+// The offset is a zero-based byte index. The line and column are one-based
+// and the column is counted in runes.
+type Pos struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// String returns a string representation of the position.
+func (p Pos) String() string { return fmt.Sprintf("line %d, column %d", p.Line, p.Column) }
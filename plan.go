@@ -0,0 +1,489 @@
+package pie
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+// operator represents a step in the plan for a SELECT statement. Operators
+// form a tree where each operator reads the records produced by its inputs.
+type operator interface {
+	// explain returns the name of the operator & a description of how it's run.
+	explain() (name, detail string)
+
+	// inputs returns the operators read from.
+	inputs() []operator
+}
+
+// recordOperator represents an operator that produces records.
+type recordOperator interface {
+	operator
+	open(tx *Tx) (recordIterator, error)
+}
+
+// recordIterator represents an iterator over the records produced by an operator.
+type recordIterator interface {
+	// Returns the next record. Returns nil when there are no more records.
+	next() (pieql.Valuer, error)
+
+	Close() error
+}
+
+// selectPlan represents the operators that compute a SELECT statement's rows.
+type selectPlan struct {
+	stmt *pieql.SelectStatement // statement with wildcards expanded
+	root *projectOperator
+}
+
+// planSelect returns the plan for a SELECT statement. The statement is
+// validated against the tables in the transaction.
+func (tx *Tx) planSelect(stmt *pieql.SelectStatement) (*selectPlan, error) {
+	// Build the set of columns available from the source & joined tables.
+	sc, err := tx.newScope(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand out SELECT ALL on a copy of the statement.
+	var fields pieql.Fields
+	for _, f := range stmt.Fields {
+		if _, ok := f.Expr.(*pieql.Wildcard); !ok {
+			fields = append(fields, f)
+			continue
+		}
+		fields = append(fields, sc.fields()...)
+	}
+	other := *stmt
+	other.Fields = fields
+	stmt = &other
+
+	// Verify that the statement is valid against the tables.
+	if err := validateStatement(sc, stmt); err != nil {
+		return nil, err
+	}
+
+	// Determine the columns to read from each table.
+	columns := referencedColumns(sc, stmt)
+
+	// Scan the source table. Storage can skip rows that don't match the parts
+	// of the condition that only use the source table. Indexes on the source
+	// table limit the rows that are read.
+	scan := &scanOperator{scope: sc, opt: IteratorOptions{
+		Columns:   columns[0],
+		Condition: sourceCondition(sc, stmt.Condition),
+	}}
+	if scan.opt.Rows, scan.indexes, err = tx.indexLookup(sc.tables[0], scan.opt.Condition); err != nil {
+		return nil, err
+	}
+	var op recordOperator = scan
+
+	// Combine rows with each joined table.
+	for i, j := range stmt.Joins {
+		op = &joinOperator{
+			input: op,
+			scan:  &scanOperator{scope: sc, index: i + 1, opt: IteratorOptions{Columns: columns[i+1]}},
+			j:     j,
+		}
+	}
+
+	// Remove combinations of rows that don't match the condition.
+	if stmt.Condition != nil {
+		op = &filterOperator{input: op, condition: stmt.Condition}
+	}
+
+	// Combine records into groups, if necessary.
+	if stmt.IsAggregate() {
+		op = &aggregateOperator{input: op, stmt: stmt}
+	}
+
+	// Sort the records, if requested.
+	if len(stmt.SortFields) > 0 {
+		op = &sortOperator{input: op, scope: sc, stmt: stmt}
+	}
+
+	// Skip records before the offset & stop at the limit.
+	if stmt.Limit != nil || stmt.Offset > 0 {
+		limit := -1
+		if stmt.Limit != nil {
+			limit = *stmt.Limit
+		}
+		op = &limitOperator{input: op, limit: limit, offset: stmt.Offset}
+	}
+
+	return &selectPlan{stmt: stmt, root: &projectOperator{input: op, fields: stmt.Fields}}, nil
+}
+
+// executeExplainStatement returns the plan for a SELECT statement with one
+// row per operator. Each operator references the operator reading from it by id.
+func (tx *Tx) executeExplainStatement(stmt *pieql.ExplainStatement) (*Result, error) {
+	plan, err := tx.planSelect(stmt.Statement)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Columns: []string{"id", "parent", "operator", "detail"}, Rows: explainRows(plan.root, "", nil)}, nil
+}
+
+// explainRows appends a row for op & each of its inputs to rows.
+// Operators are numbered from one in the order they're appended.
+func explainRows(op operator, parent string, rows [][]string) [][]string {
+	id := strconv.Itoa(len(rows) + 1)
+	name, detail := op.explain()
+	rows = append(rows, []string{id, parent, name, detail})
+	for _, input := range op.inputs() {
+		rows = explainRows(input, id, rows)
+	}
+	return rows
+}
+
+// scanOperator reads the rows of one of the tables in a scope.
+type scanOperator struct {
+	scope   *scope
+	index   int // position of the table within the scope
+	opt     IteratorOptions
+	indexes []string // names of the indexes used to find rows
+}
+
+func (op *scanOperator) explain() (string, string) {
+	t := op.scope.tables[op.index]
+	parts := []string{op.scope.sources[op.index].String()}
+
+	var names []string
+	for _, index := range op.opt.Columns {
+		names = append(names, pieql.QuoteIdent(t.Columns[index].Name))
+	}
+	parts = append(parts, "columns: "+strings.Join(names, ", "))
+
+	if op.opt.Condition != nil {
+		parts = append(parts, "condition: "+op.opt.Condition.String())
+	}
+	if len(op.indexes) > 0 {
+		parts = append(parts, fmt.Sprintf("index: %s (%d rows)", strings.Join(op.indexes, ", "), len(op.opt.Rows)))
+	}
+	return "scan", strings.Join(parts, "; ")
+}
+
+func (op *scanOperator) inputs() []operator { return nil }
+
+// rowIterator returns an iterator over the table's rows.
+func (op *scanOperator) rowIterator(tx *Tx) (RowIterator, error) {
+	return tx.tableRowIterator(op.scope.sources[op.index].Name, op.opt)
+}
+
+func (op *scanOperator) open(tx *Tx) (recordIterator, error) {
+	itr, err := op.rowIterator(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &scanIterator{op: op, itr: itr}, nil
+}
+
+// scanIterator returns a record for each row of a table.
+type scanIterator struct {
+	op  *scanOperator
+	itr RowIterator
+}
+
+func (itr *scanIterator) next() (pieql.Valuer, error) {
+	row, err := itr.itr.Next()
+	if err != nil || row == nil {
+		return nil, err
+	}
+	tuple := make([][]string, itr.op.index+1)
+	tuple[itr.op.index] = row
+	return &rowValuer{scope: itr.op.scope, rows: tuple}, nil
+}
+
+func (itr *scanIterator) Close() error { return itr.itr.Close() }
+
+// joinOperator combines each record with the matching rows of a joined table.
+type joinOperator struct {
+	input recordOperator
+	scan  *scanOperator
+	j     *pieql.Join
+}
+
+func (op *joinOperator) explain() (string, string) {
+	method := "nested loop"
+	if left, _ := joinKeys(op.scan.scope, op.scan.index, op.j.Condition); len(left) > 0 {
+		method = "hash"
+	}
+	return "join", op.j.String() + "; " + method
+}
+
+func (op *joinOperator) inputs() []operator { return []operator{op.input, op.scan} }
+
+func (op *joinOperator) open(tx *Tx) (recordIterator, error) {
+	// Read every row of the joined table.
+	itr, err := op.scan.rowIterator(tx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = itr.Close() }()
+
+	rows, err := readRows(itr)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := op.input.open(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &joinIterator{input: input, jn: newJoiner(op.scan.scope, op.scan.index, op.j, rows)}, nil
+}
+
+// joinIterator returns the combined tuples for each input record.
+type joinIterator struct {
+	input  recordIterator
+	jn     *joiner
+	tuples [][][]string // joined tuples waiting to be returned
+}
+
+func (itr *joinIterator) next() (pieql.Valuer, error) {
+	for len(itr.tuples) == 0 {
+		v, err := itr.input.next()
+		if err != nil || v == nil {
+			return nil, err
+		}
+		itr.tuples = itr.jn.join([][][]string{v.(*rowValuer).rows})
+	}
+
+	v := &rowValuer{scope: itr.jn.scope, rows: itr.tuples[0]}
+	itr.tuples = itr.tuples[1:]
+	return v, nil
+}
+
+func (itr *joinIterator) Close() error { return itr.input.Close() }
+
+// filterOperator removes records that don't match a condition.
+type filterOperator struct {
+	input     recordOperator
+	condition pieql.Expr
+}
+
+func (op *filterOperator) explain() (string, string) { return "filter", op.condition.String() }
+
+func (op *filterOperator) inputs() []operator { return []operator{op.input} }
+
+func (op *filterOperator) open(tx *Tx) (recordIterator, error) {
+	input, err := op.input.open(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &filterIterator{input: input, condition: op.condition}, nil
+}
+
+// filterIterator returns the input records matching a condition.
+type filterIterator struct {
+	input     recordIterator
+	condition pieql.Expr
+}
+
+func (itr *filterIterator) next() (pieql.Valuer, error) {
+	for {
+		v, err := itr.input.next()
+		if err != nil || v == nil {
+			return nil, err
+		} else if pieql.EvalBool(itr.condition, v) {
+			return v, nil
+		}
+	}
+}
+
+func (itr *filterIterator) Close() error { return itr.input.Close() }
+
+// aggregateOperator combines records into groups & computes the aggregate
+// calls for each group.
+type aggregateOperator struct {
+	input recordOperator
+	stmt  *pieql.SelectStatement
+}
+
+func (op *aggregateOperator) explain() (string, string) {
+	var parts []string
+	if len(op.stmt.GroupBy) > 0 {
+		exprs := make([]string, len(op.stmt.GroupBy))
+		for i, expr := range op.stmt.GroupBy {
+			exprs[i] = expr.String()
+		}
+		parts = append(parts, "group by: "+strings.Join(exprs, ", "))
+	}
+	if op.stmt.Having != nil {
+		parts = append(parts, "having: "+op.stmt.Having.String())
+	}
+	return "aggregate", strings.Join(parts, "; ")
+}
+
+func (op *aggregateOperator) inputs() []operator { return []operator{op.input} }
+
+func (op *aggregateOperator) open(tx *Tx) (recordIterator, error) {
+	input, err := op.input.open(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedIterator{input: input, fn: func(records []pieql.Valuer) []pieql.Valuer {
+		return aggregate(op.stmt, records)
+	}}, nil
+}
+
+// sortOperator orders records by a statement's sort fields.
+type sortOperator struct {
+	input recordOperator
+	scope *scope
+	stmt  *pieql.SelectStatement
+}
+
+func (op *sortOperator) explain() (string, string) { return "sort", op.stmt.SortFields.String() }
+
+func (op *sortOperator) inputs() []operator { return []operator{op.input} }
+
+func (op *sortOperator) open(tx *Tx) (recordIterator, error) {
+	input, err := op.input.open(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedIterator{input: input, fn: func(records []pieql.Valuer) []pieql.Valuer {
+		sort.Stable(newRecordSorter(op.scope, op.stmt, records))
+		return records
+	}}, nil
+}
+
+// bufferedIterator reads every input record the first time through and
+// returns the records computed from them.
+type bufferedIterator struct {
+	input   recordIterator
+	fn      func(records []pieql.Valuer) []pieql.Valuer
+	records []pieql.Valuer
+	read    bool // true if all input records have been read
+}
+
+func (itr *bufferedIterator) next() (pieql.Valuer, error) {
+	if !itr.read {
+		var records []pieql.Valuer
+		for {
+			v, err := itr.input.next()
+			if err != nil {
+				return nil, err
+			} else if v == nil {
+				break
+			}
+			records = append(records, v)
+		}
+		itr.records, itr.read = itr.fn(records), true
+	}
+
+	if len(itr.records) == 0 {
+		return nil, nil
+	}
+	v := itr.records[0]
+	itr.records = itr.records[1:]
+	return v, nil
+}
+
+func (itr *bufferedIterator) Close() error { return itr.input.Close() }
+
+// limitOperator skips records before an offset & stops after a limit.
+// A negative limit returns all records after the offset.
+type limitOperator struct {
+	input  recordOperator
+	limit  int
+	offset int
+}
+
+func (op *limitOperator) explain() (string, string) {
+	var parts []string
+	if op.limit >= 0 {
+		parts = append(parts, fmt.Sprintf("limit: %d", op.limit))
+	}
+	if op.offset > 0 {
+		parts = append(parts, fmt.Sprintf("offset: %d", op.offset))
+	}
+	return "limit", strings.Join(parts, "; ")
+}
+
+func (op *limitOperator) inputs() []operator { return []operator{op.input} }
+
+func (op *limitOperator) open(tx *Tx) (recordIterator, error) {
+	input, err := op.input.open(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &limitIterator{input: input, limit: op.limit, offset: op.offset}, nil
+}
+
+// limitIterator returns the input records between the offset & the limit.
+type limitIterator struct {
+	input  recordIterator
+	limit  int
+	offset int
+	n      int // number of records returned or skipped
+}
+
+func (itr *limitIterator) next() (pieql.Valuer, error) {
+	for {
+		// Stop once the limit has been reached.
+		if itr.limit >= 0 && itr.n >= itr.offset+itr.limit {
+			return nil, nil
+		}
+
+		v, err := itr.input.next()
+		if err != nil || v == nil {
+			return nil, err
+		}
+
+		// Skip records before the offset.
+		if itr.n++; itr.n > itr.offset {
+			return v, nil
+		}
+	}
+}
+
+func (itr *limitIterator) Close() error { return itr.input.Close() }
+
+// projectOperator evaluates a statement's fields against each record to
+// produce the result rows.
+type projectOperator struct {
+	input  recordOperator
+	fields pieql.Fields
+}
+
+func (op *projectOperator) explain() (string, string) { return "project", op.fields.String() }
+
+func (op *projectOperator) inputs() []operator { return []operator{op.input} }
+
+// rowIterator returns an iterator over the result rows.
+func (op *projectOperator) rowIterator(tx *Tx) (RowIterator, error) {
+	input, err := op.input.open(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &projectIterator{input: input, fields: op.fields}, nil
+}
+
+// projectIterator returns a result row for each input record.
+type projectIterator struct {
+	input  recordIterator
+	fields pieql.Fields
+}
+
+// Next returns the next result row.
+func (itr *projectIterator) Next() ([]string, error) {
+	v, err := itr.input.next()
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	// Evaluate each field against the record.
+	row := make([]string, len(itr.fields))
+	for i, f := range itr.fields {
+		row[i] = evalCell(f.Expr, v)
+	}
+	return row, nil
+}
+
+// Close closes the iterators of the operators below.
+func (itr *projectIterator) Close() error { return itr.input.Close() }
@@ -0,0 +1,93 @@
+package pie_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure EXPLAIN returns the operators used to execute a query.
+func TestDatabase_Execute_Explain(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "id", Type: pie.IntegerType}, {Name: "name"}})
+	db.CreateTable("bar", []*pie.Column{{Name: "foo_id", Type: pie.IntegerType}, {Name: "n", Type: pie.IntegerType}})
+	db.SetTableRows("foo", [][]string{{"1", "a"}, {"2", "b"}, {"3", "c"}})
+	db.CreateIndex("foo", "by_id", "id")
+
+	for i, tt := range []struct {
+		s   string
+		exp [][]string
+	}{
+		{
+			s: `EXPLAIN SELECT * FROM foo`,
+			exp: [][]string{
+				{"1", "", "project", "id, name"},
+				{"2", "1", "scan", "foo; columns: id, name"},
+			},
+		},
+		{
+			s: `EXPLAIN SELECT name FROM foo WHERE id > 1 AND name != 'c' ORDER BY name DESC LIMIT 1 OFFSET 1`,
+			exp: [][]string{
+				{"1", "", "project", "name"},
+				{"2", "1", "limit", "limit: 1; offset: 1"},
+				{"3", "2", "sort", "name DESC"},
+				{"4", "3", "filter", "id > 1 AND name != 'c'"},
+				{"5", "4", "scan", "foo; columns: name, id; condition: id > 1 AND name != 'c'; index: by_id (2 rows)"},
+			},
+		},
+		{
+			s: `EXPLAIN SELECT f.name, sum(b.n) FROM foo f LEFT JOIN bar b ON f.id = b.foo_id GROUP BY f.name HAVING sum(b.n) > 1`,
+			exp: [][]string{
+				{"1", "", "project", "f.name, sum(b.n)"},
+				{"2", "1", "aggregate", "group by: f.name; having: sum(b.n) > 1"},
+				{"3", "2", "join", "LEFT JOIN bar AS b ON f.id = b.foo_id; hash"},
+				{"4", "3", "scan", "foo AS f; columns: name, id"},
+				{"5", "3", "scan", "bar AS b; columns: n, foo_id"},
+			},
+		},
+		{
+			s: `EXPLAIN SELECT count(*) FROM foo JOIN bar ON foo.id < bar.n`,
+			exp: [][]string{
+				{"1", "", "project", "count(*)"},
+				{"2", "1", "aggregate", ""},
+				{"3", "2", "join", "INNER JOIN bar ON foo.id < bar.n; nested loop"},
+				{"4", "3", "scan", "foo; columns: id"},
+				{"5", "3", "scan", "bar; columns: n"},
+			},
+		},
+		{
+			s: `EXPLAIN SELECT count(*) FROM foo JOIN bar ON foo.name = bar.n`,
+			exp: [][]string{
+				{"1", "", "project", "count(*)"},
+				{"2", "1", "aggregate", ""},
+				{"3", "2", "join", "INNER JOIN bar ON foo.name = bar.n; nested loop"},
+				{"4", "3", "scan", "foo; columns: name"},
+				{"5", "3", "scan", "bar; columns: n"},
+			},
+		},
+	} {
+		res, err := db.Execute(MustParseStatement(tt.s))
+		if err != nil {
+			t.Fatalf("%d. %s: %s", i, tt.s, err)
+		} else if !reflect.DeepEqual(res.Columns, []string{"id", "parent", "operator", "detail"}) {
+			t.Fatalf("%d. unexpected columns: %#v", i, res.Columns)
+		} else if !reflect.DeepEqual(res.Rows, tt.exp) {
+			t.Fatalf("%d. unexpected rows: %#v", i, res.Rows)
+		}
+	}
+}
+
+// Ensure EXPLAIN returns the same errors as the query it explains.
+func TestDatabase_Execute_Explain_Err(t *testing.T) {
+	db := OpenMemDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "id"}})
+
+	if _, err := db.Execute(MustParseStatement(`EXPLAIN SELECT * FROM bar`)); err != pie.ErrTableNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := db.Execute(MustParseStatement(`EXPLAIN SELECT x FROM foo`)); err == nil || err.Error() != "column not found: x" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,478 @@
+package pie
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format represents an output format for the results of statements.
+type Format string
+
+// Output formats.
+const (
+	FormatCSV      Format = "csv"
+	FormatTSV      Format = "tsv"
+	FormatJSON     Format = "json"     // array of objects, nested per statement
+	FormatNDJSON   Format = "ndjson"   // object per line
+	FormatMarkdown Format = "markdown" // pipe table per result
+	FormatHTML     Format = "html"     // table element per result
+	FormatXLSX     Format = "xlsx"     // worksheet per result
+	FormatTable    Format = "table"    // aligned plain text
+)
+
+// formats lists every output format with its media type.
+var formats = []struct {
+	format      Format
+	contentType string
+}{
+	{FormatCSV, "text/csv"},
+	{FormatTSV, "text/tab-separated-values"},
+	{FormatJSON, "application/json"},
+	{FormatNDJSON, "application/x-ndjson"},
+	{FormatMarkdown, "text/markdown"},
+	{FormatHTML, "text/html"},
+	{FormatXLSX, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{FormatTable, "text/plain"},
+}
+
+// IsValid returns true if the format is a known output format.
+func (f Format) IsValid() bool {
+	return f.ContentType() != ""
+}
+
+// ContentType returns the media type of the format.
+// Returns a blank string if the format is unknown.
+func (f Format) ContentType() string {
+	for _, a := range formats {
+		if a.format == f {
+			return a.contentType
+		}
+	}
+	return ""
+}
+
+// FormatForContentType returns the output format for a media type.
+// Returns a blank format if no format uses the media type.
+func FormatForContentType(typ string) Format {
+	for _, a := range formats {
+		if a.contentType == typ {
+			return a.format
+		}
+	}
+	return ""
+}
+
+// ResultWriter writes the results of statements in an output format.
+// Rows are written as they're received except by formats that must see
+// every row of a result before writing it.
+type ResultWriter interface {
+	// WriteHeader begins a new result with the given columns.
+	WriteHeader(columns []string) error
+
+	// WriteRow writes a row of the current result.
+	WriteRow(row []string) error
+
+	// Flush writes any buffered output to the underlying writer.
+	Flush() error
+
+	// Close finishes the last result. It doesn't close the underlying writer.
+	Close() error
+}
+
+// NewResultWriter returns a writer of results to w in the given format.
+func NewResultWriter(w io.Writer, f Format) (ResultWriter, error) {
+	switch f {
+	case FormatCSV:
+		return &csvResultWriter{w: w, cw: csv.NewWriter(w)}, nil
+	case FormatTSV:
+		cw := csv.NewWriter(w)
+		cw.Comma = '\t'
+		return &csvResultWriter{w: w, cw: cw}, nil
+	case FormatJSON:
+		return &jsonResultWriter{w: w}, nil
+	case FormatNDJSON:
+		return &jsonResultWriter{w: w, lines: true}, nil
+	case FormatMarkdown:
+		return &markdownResultWriter{w: w}, nil
+	case FormatHTML:
+		return &htmlResultWriter{w: w}, nil
+	case FormatXLSX:
+		return newXLSXResultWriter(w), nil
+	case FormatTable:
+		return &tableResultWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("invalid format: %q", f)
+}
+
+// WriteResults writes every result that returns columns.
+func WriteResults(rw ResultWriter, results []*Result) error {
+	nestResults(rw, len(results))
+	for _, res := range results {
+		if len(res.Columns) == 0 {
+			continue
+		}
+		if err := rw.WriteHeader(res.Columns); err != nil {
+			return err
+		}
+		for _, row := range res.Rows {
+			if err := rw.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+	return rw.Close()
+}
+
+// csvResultWriter writes results as delimited text, separated by a blank line.
+type csvResultWriter struct {
+	w  io.Writer
+	cw *csv.Writer
+	n  int // number of results written
+}
+
+// WriteHeader writes the header row, separated from the previous result by
+// a blank line.
+func (rw *csvResultWriter) WriteHeader(columns []string) error {
+	if rw.n > 0 {
+		rw.cw.Flush()
+		if _, err := io.WriteString(rw.w, "\n"); err != nil {
+			return err
+		}
+	}
+	rw.n++
+	return rw.cw.Write(columns)
+}
+
+// WriteRow writes a record.
+func (rw *csvResultWriter) WriteRow(row []string) error { return rw.cw.Write(row) }
+
+// Flush writes any buffered records.
+func (rw *csvResultWriter) Flush() error {
+	rw.cw.Flush()
+	return rw.cw.Error()
+}
+
+// Close writes any buffered records.
+func (rw *csvResultWriter) Close() error { return rw.Flush() }
+
+// nestResults sets a JSON writer to wrap its results in an outer array when
+// a script has more than one statement so the output is a single document.
+func nestResults(rw ResultWriter, n int) {
+	if rw, ok := rw.(*jsonResultWriter); ok && !rw.lines {
+		rw.nested = n > 1
+	}
+}
+
+// jsonResultWriter writes each row as a JSON object keyed by column name.
+// Each result is written as an array of objects, or as one object per line
+// if lines is set. The arrays of a multi-statement script are wrapped in an
+// outer array if nested is set.
+type jsonResultWriter struct {
+	w       io.Writer
+	lines   bool
+	nested  bool
+	columns []string
+	open    bool // true if an array has been started
+	results int  // number of results written
+	n       int  // number of rows in the current result
+}
+
+// WriteHeader closes the previous array and starts a new one.
+func (rw *jsonResultWriter) WriteHeader(columns []string) error {
+	if err := rw.end(); err != nil {
+		return err
+	}
+	rw.columns, rw.n = columns, 0
+	if rw.lines {
+		return nil
+	}
+
+	s := "["
+	if rw.nested && rw.results == 0 {
+		s = "[\n["
+	} else if rw.nested {
+		s = ",\n["
+	}
+	rw.open = true
+	rw.results++
+	_, err := io.WriteString(rw.w, s)
+	return err
+}
+
+// WriteRow writes the row as an object.
+func (rw *jsonResultWriter) WriteRow(row []string) error {
+	var buf strings.Builder
+	if !rw.lines {
+		if rw.n > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	rw.n++
+
+	// Write keys in column order rather than sorted like a map.
+	buf.WriteString("{")
+	for i, name := range rw.columns {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(name)
+		value, _ := json.Marshal(cellAt(row, i))
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	if rw.lines {
+		buf.WriteString("\n")
+	}
+
+	_, err := io.WriteString(rw.w, buf.String())
+	return err
+}
+
+// Flush is a no-op. Rows are written as they're received.
+func (rw *jsonResultWriter) Flush() error { return nil }
+
+// Close closes the last array and the outer array, if nested.
+func (rw *jsonResultWriter) Close() error {
+	if err := rw.end(); err != nil {
+		return err
+	} else if !rw.nested {
+		return nil
+	}
+
+	s := "\n]\n"
+	if rw.results == 0 {
+		s = "[]\n"
+	}
+	_, err := io.WriteString(rw.w, s)
+	return err
+}
+
+// end closes the current array, if any.
+func (rw *jsonResultWriter) end() error {
+	if !rw.open {
+		return nil
+	}
+	rw.open = false
+
+	s := "\n]"
+	if rw.n == 0 {
+		s = "]"
+	}
+	if !rw.nested {
+		s += "\n"
+	}
+	_, err := io.WriteString(rw.w, s)
+	return err
+}
+
+// markdownResultWriter writes each result as a pipe table, separated by a
+// blank line.
+type markdownResultWriter struct {
+	w io.Writer
+	n int // number of results written
+}
+
+// WriteHeader writes the header row & the delimiter row of a new table.
+func (rw *markdownResultWriter) WriteHeader(columns []string) error {
+	var buf strings.Builder
+	if rw.n > 0 {
+		buf.WriteString("\n")
+	}
+	rw.n++
+
+	buf.WriteString(markdownRow(columns))
+	buf.WriteString("|")
+	for range columns {
+		buf.WriteString(" --- |")
+	}
+	buf.WriteString("\n")
+
+	_, err := io.WriteString(rw.w, buf.String())
+	return err
+}
+
+// WriteRow writes a row of the table.
+func (rw *markdownResultWriter) WriteRow(row []string) error {
+	_, err := io.WriteString(rw.w, markdownRow(row))
+	return err
+}
+
+// Flush is a no-op. Rows are written as they're received.
+func (rw *markdownResultWriter) Flush() error { return nil }
+
+// Close is a no-op.
+func (rw *markdownResultWriter) Close() error { return nil }
+
+// markdownCellReplacer escapes characters that would end a table cell.
+var markdownCellReplacer = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// markdownRow returns a row of a pipe table.
+func markdownRow(cells []string) string {
+	var buf strings.Builder
+	buf.WriteString("|")
+	for _, cell := range cells {
+		buf.WriteString(" ")
+		buf.WriteString(markdownCellReplacer.Replace(cell))
+		buf.WriteString(" |")
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// htmlResultWriter writes each result as a table element.
+type htmlResultWriter struct {
+	w    io.Writer
+	open bool // true if a table has been started
+}
+
+// WriteHeader closes the previous table and starts a new one.
+func (rw *htmlResultWriter) WriteHeader(columns []string) error {
+	if err := rw.end(); err != nil {
+		return err
+	}
+	rw.open = true
+
+	var buf strings.Builder
+	buf.WriteString("<table>\n<thead>\n")
+	buf.WriteString(htmlRow("th", columns))
+	buf.WriteString("</thead>\n<tbody>\n")
+	_, err := io.WriteString(rw.w, buf.String())
+	return err
+}
+
+// WriteRow writes a row of the table body.
+func (rw *htmlResultWriter) WriteRow(row []string) error {
+	_, err := io.WriteString(rw.w, htmlRow("td", row))
+	return err
+}
+
+// Flush is a no-op. Rows are written as they're received.
+func (rw *htmlResultWriter) Flush() error { return nil }
+
+// Close closes the last table.
+func (rw *htmlResultWriter) Close() error { return rw.end() }
+
+// end closes the current table, if any.
+func (rw *htmlResultWriter) end() error {
+	if !rw.open {
+		return nil
+	}
+	rw.open = false
+	_, err := io.WriteString(rw.w, "</tbody>\n</table>\n")
+	return err
+}
+
+// htmlRow returns a table row with each cell in an element named tag.
+func htmlRow(tag string, cells []string) string {
+	var buf strings.Builder
+	buf.WriteString("<tr>")
+	for _, cell := range cells {
+		fmt.Fprintf(&buf, "<%s>%s</%s>", tag, html.EscapeString(cell), tag)
+	}
+	buf.WriteString("</tr>\n")
+	return buf.String()
+}
+
+// tableResultWriter writes each result as plain text with the columns
+// aligned, followed by the number of rows. Rows are held until the result
+// ends so that the width of each column is known.
+type tableResultWriter struct {
+	w       io.Writer
+	columns []string
+	rows    [][]string
+	n       int // number of results written
+}
+
+// WriteHeader writes the previous result and starts a new one.
+func (rw *tableResultWriter) WriteHeader(columns []string) error {
+	if err := rw.end(); err != nil {
+		return err
+	}
+	rw.columns, rw.rows = columns, nil
+	return nil
+}
+
+// WriteRow holds the row until the result ends.
+func (rw *tableResultWriter) WriteRow(row []string) error {
+	rw.rows = append(rw.rows, row)
+	return nil
+}
+
+// Flush is a no-op. Rows are held until the column widths are known.
+func (rw *tableResultWriter) Flush() error { return nil }
+
+// Close writes the last result.
+func (rw *tableResultWriter) Close() error { return rw.end() }
+
+// end writes the current result, if any.
+func (rw *tableResultWriter) end() error {
+	if rw.columns == nil {
+		return nil
+	}
+
+	// Determine the width of each column.
+	widths := make([]int, len(rw.columns))
+	for i, name := range rw.columns {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, row := range rw.rows {
+		for i := range widths {
+			if n := utf8.RuneCountInString(cellAt(row, i)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var buf strings.Builder
+	if rw.n > 0 {
+		buf.WriteString("\n")
+	}
+	rw.n++
+
+	// Write the header, a separator line and then each row.
+	writeTableLine(&buf, rw.columns, widths)
+	for i, width := range widths {
+		if i > 0 {
+			buf.WriteString("+")
+		}
+		buf.WriteString(strings.Repeat("-", width+2))
+	}
+	buf.WriteString("\n")
+	for _, row := range rw.rows {
+		writeTableLine(&buf, row, widths)
+	}
+
+	if len(rw.rows) == 1 {
+		buf.WriteString("(1 row)\n")
+	} else {
+		fmt.Fprintf(&buf, "(%d rows)\n", len(rw.rows))
+	}
+
+	rw.columns, rw.rows = nil, nil
+	_, err := io.WriteString(rw.w, buf.String())
+	return err
+}
+
+// writeTableLine writes the cells of a row padded to the column widths.
+func writeTableLine(buf *strings.Builder, cells []string, widths []int) {
+	var line strings.Builder
+	for i, width := range widths {
+		if i > 0 {
+			line.WriteString("|")
+		}
+		cell := cellAt(cells, i)
+		line.WriteString(" ")
+		line.WriteString(cell)
+		line.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(cell)+1))
+	}
+	buf.WriteString(strings.TrimRight(line.String(), " "))
+	buf.WriteString("\n")
+}
@@ -0,0 +1,85 @@
+package pie_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure results can be written in each text format.
+func TestResultWriter(t *testing.T) {
+	results := []*pie.Result{
+		{Columns: []string{"name", "note"}, Rows: [][]string{{"bob", "a|b"}, {"susy", `<"é">`}}},
+		{RowsAffected: 1},
+		{Columns: []string{"n"}},
+	}
+
+	for _, tt := range []struct {
+		format pie.Format
+		exp    string
+	}{
+		{format: pie.FormatCSV, exp: "name,note\nbob,a|b\nsusy,\"<\"\"é\"\">\"\n\nn\n"},
+		{format: pie.FormatTSV, exp: "name\tnote\nbob\ta|b\nsusy\t\"<\"\"é\"\">\"\n\nn\n"},
+		{format: pie.FormatJSON, exp: "[\n[\n{\"name\":\"bob\",\"note\":\"a|b\"},\n{\"name\":\"susy\",\"note\":\"\\u003c\\\"é\\\"\\u003e\"}\n],\n[]\n]\n"},
+		{format: pie.FormatNDJSON, exp: "{\"name\":\"bob\",\"note\":\"a|b\"}\n{\"name\":\"susy\",\"note\":\"\\u003c\\\"é\\\"\\u003e\"}\n"},
+		{format: pie.FormatMarkdown, exp: "| name | note |\n| --- | --- |\n| bob | a\\|b |\n| susy | <\"é\"> |\n\n| n |\n| --- |\n"},
+		{format: pie.FormatHTML, exp: "<table>\n<thead>\n<tr><th>name</th><th>note</th></tr>\n</thead>\n<tbody>\n<tr><td>bob</td><td>a|b</td></tr>\n<tr><td>susy</td><td>&lt;&#34;é&#34;&gt;</td></tr>\n</tbody>\n</table>\n<table>\n<thead>\n<tr><th>n</th></tr>\n</thead>\n<tbody>\n</tbody>\n</table>\n"},
+		{format: pie.FormatTable, exp: " name | note\n------+-------\n bob  | a|b\n susy | <\"é\">\n(2 rows)\n\n n\n---\n(0 rows)\n"},
+	} {
+		var buf bytes.Buffer
+		rw, err := pie.NewResultWriter(&buf, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := pie.WriteResults(rw, results); err != nil {
+			t.Fatalf("%s: %s", tt.format, err)
+		} else if buf.String() != tt.exp {
+			t.Fatalf("%s: unexpected output: %q", tt.format, buf.String())
+		}
+	}
+
+	if _, err := pie.NewResultWriter(ioutil.Discard, "yaml"); err == nil || err.Error() != `invalid format: "yaml"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure results can be written as a workbook with a worksheet per result.
+func TestResultWriter_XLSX(t *testing.T) {
+	var buf bytes.Buffer
+	rw, _ := pie.NewResultWriter(&buf, pie.FormatXLSX)
+	if err := pie.WriteResults(rw, []*pie.Result{
+		{Columns: []string{"name", "count"}, Rows: [][]string{{"a&b", "10"}, {"c", "007"}}},
+		{Columns: []string{"x"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read each part of the workbook.
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+
+	if len(parts) != 6 {
+		t.Fatalf("unexpected part count: %d", len(parts))
+	} else if s := parts["xl/worksheets/sheet1.xml"]; !strings.Contains(s, `<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">a&amp;b</t></is></c><c r="B2"><v>10</v></c></row>`) {
+		t.Fatalf("unexpected sheet: %s", s)
+	} else if !strings.Contains(s, `<c r="B3" t="inlineStr"><is><t xml:space="preserve">007</t></is></c>`) {
+		t.Fatalf("unexpected sheet: %s", s)
+	} else if s := parts["xl/workbook.xml"]; !strings.Contains(s, `<sheet name="Result 2" sheetId="2" r:id="rId2"/>`) {
+		t.Fatalf("unexpected workbook: %s", s)
+	}
+}
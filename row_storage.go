@@ -0,0 +1,314 @@
+package pie
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// RowStorage stores the rows of each table in a single data file with one
+// JSON array per line. This is the default storage engine.
+type RowStorage struct {
+	root string // database root directory
+	path string // data directory
+}
+
+// NewRowStorage returns a new instance of RowStorage.
+func NewRowStorage() *RowStorage {
+	return &RowStorage{}
+}
+
+// Name returns the name of the backend.
+func (s *RowStorage) Name() string { return "row" }
+
+// Open creates the root & data directories for the database, replays any
+// append that was interrupted and migrates files written by older versions.
+func (s *RowStorage) Open(path string) error {
+	if path == "" {
+		return errors.New("path required")
+	} else if err := os.MkdirAll(filepath.Join(path, "data"), 0700); err != nil {
+		return err
+	}
+	s.root, s.path = path, filepath.Join(path, "data")
+
+	if err := replayWAL(filepath.Join(s.root, "wal"), s.path, s.appendRows); err != nil {
+		s.root, s.path = "", ""
+		return err
+	} else if _, err := Migrate(s.root, false); err != nil {
+		s.root, s.path = "", ""
+		return err
+	}
+	return nil
+}
+
+// Close closes the backend.
+func (s *RowStorage) Close() error {
+	s.root, s.path = "", ""
+	return nil
+}
+
+// LoadMeta reads the tables from the meta file.
+func (s *RowStorage) LoadMeta() ([]*Table, error) {
+	if s.root == "" {
+		return nil, ErrNotOpen
+	}
+	return loadMetaFile(s.root, s.Name())
+}
+
+// SaveMeta writes the tables to the meta file.
+func (s *RowStorage) SaveMeta(tables []*Table) error {
+	if s.root == "" {
+		return ErrNotOpen
+	}
+	return saveMetaFile(s.root, s.Name(), tables)
+}
+
+// RowIterator returns a cursor over the rows in a table's data file. Every
+// column is read. Rows that aren't required by the options are skipped
+// without being decoded.
+func (s *RowStorage) RowIterator(t *Table, opt IteratorOptions) (RowIterator, error) {
+	if s.path == "" {
+		return nil, ErrNotOpen
+	}
+
+	// Open data file for reading. Tables without a data file have no rows.
+	f, err := os.Open(filepath.Join(s.path, t.dataKey()))
+	if os.IsNotExist(err) {
+		return &rowSliceIterator{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+
+	// Data files used to be a single JSON array containing every row.
+	// These are read into memory all at once.
+	if legacy, err := isLegacyRowFormat(r); err != nil {
+		_ = f.Close()
+		return nil, err
+	} else if legacy {
+		defer func() { _ = f.Close() }()
+
+		var rows [][]string
+		if err := json.NewDecoder(r).Decode(&rows); err != nil {
+			return nil, err
+		}
+		return &rowSliceIterator{rows: opt.filterRows(rows)}, nil
+	}
+
+	return &fileRowIterator{f: f, dec: json.NewDecoder(r), opt: opt}, nil
+}
+
+// WriteRows writes the rows to a temporary file alongside the data file and
+// then replaces the data file.
+func (s *RowStorage) WriteRows(t *Table, itr RowIterator) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+
+	return writeFileAtomic(filepath.Join(s.path, t.dataKey()), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		for {
+			row, err := itr.Next()
+			if err != nil {
+				return err
+			} else if row == nil {
+				return nil
+			} else if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// AppendRows appends rows to the end of the table's data file.
+func (s *RowStorage) AppendRows(t *Table, rows [][]string) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+	path := filepath.Join(s.path, t.dataKey())
+
+	// Rewrite data files in the legacy format before appending.
+	if legacy, err := isLegacyRowFile(path); err != nil {
+		return err
+	} else if legacy {
+		itr, err := s.RowIterator(t, IteratorOptions{})
+		if err != nil {
+			return err
+		}
+		existing, err := readRows(itr)
+		if err != nil {
+			return err
+		}
+		return s.WriteRows(t, &rowSliceIterator{rows: append(existing, rows...)})
+	}
+
+	// Log the append so it can be completed if the process stops.
+	e, err := newWALEntry(t, s.path, []string{t.dataKey()}, rows)
+	if err != nil {
+		return err
+	}
+	return writeAhead(filepath.Join(s.root, "wal", t.dataKey()), s.path, e, func() error {
+		return s.appendRows(t, rows)
+	})
+}
+
+// appendRows appends rows to the end of the table's data file and syncs
+// the file to disk.
+func (s *RowStorage) appendRows(t *Table, rows [][]string) error {
+	f, err := os.OpenFile(filepath.Join(s.path, t.dataKey()), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := writeRows(f, rows); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// MoveRows renames the table's data file to key, replacing any existing
+// file. Nothing is changed if the table has no data file.
+func (s *RowStorage) MoveRows(t *Table, key string) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+	path := filepath.Join(s.path, t.dataKey())
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if err := moveIndexFiles(s.root, t.dataKey(), key); err != nil {
+		return err
+	} else if err := os.Rename(path, filepath.Join(s.path, key)); err != nil {
+		return err
+	}
+	return syncDir(s.path)
+}
+
+// DeleteTable removes the table's data file & index files.
+func (s *RowStorage) DeleteTable(t *Table) error {
+	if s.path == "" {
+		return ErrNotOpen
+	}
+	path, err := childPath(s.path, t.dataKey())
+	if err != nil {
+		return err
+	} else if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return deleteIndexFiles(s.root, t.dataKey())
+}
+
+// ReadIndex reads one of the table's index files.
+func (s *RowStorage) ReadIndex(t *Table, name string) (*IndexData, error) {
+	if s.root == "" {
+		return nil, ErrNotOpen
+	}
+	path, err := indexPath(s.root, t.dataKey(), name)
+	if err != nil {
+		return nil, err
+	}
+	return readIndexFile(path)
+}
+
+// WriteIndex replaces one of the table's index files.
+func (s *RowStorage) WriteIndex(t *Table, name string, data *IndexData) error {
+	if s.root == "" {
+		return ErrNotOpen
+	}
+	path, err := indexPath(s.root, t.dataKey(), name)
+	if err != nil {
+		return err
+	}
+	return writeIndexFile(path, data)
+}
+
+// fileRowIterator decodes rows from a data file with one JSON array per line.
+type fileRowIterator struct {
+	f   *os.File
+	dec *json.Decoder
+	opt IteratorOptions
+	pos int // position of the next row
+}
+
+// Next decodes the next row from the file.
+func (itr *fileRowIterator) Next() ([]string, error) {
+	// Skip over rows that aren't required.
+	for !itr.opt.hasRowIn(itr.pos, itr.pos+1) {
+		if itr.opt.rowsDone(itr.pos) {
+			return nil, nil
+		}
+
+		var raw json.RawMessage
+		if err := itr.dec.Decode(&raw); err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		itr.pos++
+	}
+
+	var row []string
+	if err := itr.dec.Decode(&row); err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if row == nil {
+		row = []string{}
+	}
+	itr.pos++
+	return row, nil
+}
+
+// Close closes the underlying file.
+func (itr *fileRowIterator) Close() error { return itr.f.Close() }
+
+// isLegacyRowFile returns true if the data file at path holds all rows in a
+// single JSON array. Returns false if the file doesn't exist.
+func isLegacyRowFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return isLegacyRowFormat(bufio.NewReader(f))
+}
+
+// isLegacyRowFormat peeks at the start of a data file and returns true if it
+// holds all rows in a single JSON array (or null) instead of one row per line.
+// An empty array is legacy since rows always have at least one column.
+func isLegacyRowFormat(r *bufio.Reader) (bool, error) {
+	var n int
+	for i := 1; ; i++ {
+		b, err := r.Peek(i)
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		// Skip whitespace before and between the first two tokens.
+		switch ch := b[i-1]; ch {
+		case ' ', '\t', '\r', '\n':
+			continue
+		default:
+			// The legacy format starts with "null", an empty array or an
+			// array of arrays.
+			if n++; n == 1 && ch != '[' {
+				return ch == 'n', nil
+			} else if n == 2 {
+				return ch == '[' || ch == ']', nil
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package pie
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+)
+
+// RowIterator represents a cursor over a set of rows.
+type RowIterator interface {
+	// Next returns the next row. Returns a nil row when there are no more rows.
+	Next() ([]string, error)
+
+	// Close releases any resources held by the iterator.
+	Close() error
+}
+
+// TableRowIterator returns a cursor over the rows of a table on disk.
+// Rows are decoded one at a time as the cursor is read from a snapshot of
+// the table. The caller must close the iterator when finished.
+func (db *Database) TableRowIterator(name string) (RowIterator, error) {
+	// Keep the transaction open until the iterator is closed.
+	tx, err := db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	itr, err := tx.TableRowIterator(name)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	return &txIterator{RowIterator: itr, tx: tx}, nil
+}
+
+// AppendTableRows adds rows to the end of a table's data without rewriting
+// the existing rows.
+func (db *Database) AppendTableRows(name string, rows [][]string) error {
+	return db.update(func(tx *Tx) error {
+		return tx.AppendTableRows(name, rows)
+	})
+}
+
+// contextRowIterator returns the context's error once it's done.
+type contextRowIterator struct {
+	itr RowIterator
+	ctx context.Context
+}
+
+// Next returns the next row from the underlying iterator.
+func (itr *contextRowIterator) Next() ([]string, error) {
+	if err := itr.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return itr.itr.Next()
+}
+
+// Close closes the underlying iterator.
+func (itr *contextRowIterator) Close() error { return itr.itr.Close() }
+
+// writeRows encodes each row to w as a JSON array on its own line.
+func writeRows(w io.Writer, rows [][]string) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, row := range rows {
+		if row == nil {
+			row = []string{}
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readRows reads every remaining row from the iterator.
+func readRows(itr RowIterator) ([][]string, error) {
+	var rows [][]string
+	for {
+		row, err := itr.Next()
+		if err != nil {
+			return nil, err
+		} else if row == nil {
+			return rows, nil
+		}
+		rows = append(rows, row)
+	}
+}
+
+// rowSliceIterator iterates over rows held in memory.
+type rowSliceIterator struct {
+	rows [][]string
+}
+
+// Next returns the next row from the slice.
+func (itr *rowSliceIterator) Next() ([]string, error) {
+	if len(itr.rows) == 0 {
+		return nil, nil
+	}
+	row := itr.rows[0]
+	itr.rows = itr.rows[1:]
+	return row, nil
+}
+
+// Close is a no-op.
+func (itr *rowSliceIterator) Close() error { return nil }
+
+// multiRowIterator reads the rows from each iterator in order.
+type multiRowIterator struct {
+	itrs []RowIterator
+	i    int // position of the current iterator
+}
+
+// Next returns the next row from the first iterator with rows remaining.
+func (itr *multiRowIterator) Next() ([]string, error) {
+	for ; itr.i < len(itr.itrs); itr.i++ {
+		row, err := itr.itrs[itr.i].Next()
+		if err != nil || row != nil {
+			return row, err
+		}
+	}
+	return nil, nil
+}
+
+// Close closes every iterator.
+func (itr *multiRowIterator) Close() (err error) {
+	for _, other := range itr.itrs {
+		if e := other.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// rowMapIterator passes each row from an iterator through a function.
+// Rows are skipped if the function returns a nil row.
+type rowMapIterator struct {
+	itr RowIterator
+	fn  func(row []string) ([]string, error)
+}
+
+// Next returns the next mapped row.
+func (itr *rowMapIterator) Next() ([]string, error) {
+	for {
+		row, err := itr.itr.Next()
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		if row, err = itr.fn(row); err != nil {
+			return nil, err
+		} else if row != nil {
+			return row, nil
+		}
+	}
+}
+
+// Close closes the underlying iterator.
+func (itr *rowMapIterator) Close() error { return itr.itr.Close() }
@@ -0,0 +1,282 @@
+package pie
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/turingschool-examples/pie/pieql"
+)
+
+// Storage represents a backend that persists the metadata & rows of each table.
+//
+// Rows are stored by the table's data key rather than its name so that a
+// transaction can write new rows for a table while other transactions are
+// still reading the old rows.
+type Storage interface {
+	// Name returns the name of the backend. It is recorded in the metadata
+	// so a database is always reopened with the same backend.
+	Name() string
+
+	// Open initializes the backend at the database's path.
+	Open(path string) error
+
+	// Close releases any resources held by the backend.
+	Close() error
+
+	// LoadMeta returns the tables in the database.
+	LoadMeta() ([]*Table, error)
+
+	// SaveMeta replaces the stored list of tables.
+	SaveMeta(tables []*Table) error
+
+	// RowIterator returns a cursor over the rows of a table.
+	RowIterator(t *Table, opt IteratorOptions) (RowIterator, error)
+
+	// WriteRows replaces the rows of a table with the rows from itr.
+	// The existing rows must remain readable until itr is exhausted.
+	WriteRows(t *Table, itr RowIterator) error
+
+	// AppendRows adds rows to the end of a table.
+	AppendRows(t *Table, rows [][]string) error
+
+	// MoveRows moves the rows & indexes of a table to another data key,
+	// replacing any stored there. Nothing is changed if the table has no
+	// rows stored so that an interrupted move can be repeated.
+	MoveRows(t *Table, key string) error
+
+	// DeleteTable removes all rows & indexes stored for a table.
+	DeleteTable(t *Table) error
+
+	// ReadIndex returns the entries of one of a table's indexes.
+	// Returns nil if the index hasn't been written.
+	ReadIndex(t *Table, name string) (*IndexData, error)
+
+	// WriteIndex replaces the entries of one of a table's indexes.
+	WriteIndex(t *Table, name string, data *IndexData) error
+}
+
+// IteratorOptions represents options for reading the rows of a table.
+type IteratorOptions struct {
+	// Indices of the columns to read. Cells for other columns may be left
+	// blank. Every column is read if nil.
+	Columns []int
+
+	// Condition that rows must match. Column references are unqualified.
+	// Engines may use it to skip rows that can't match but callers must
+	// still evaluate the condition against every row returned.
+	Condition pieql.Expr
+
+	// Positions of the rows to read in ascending order, numbered from zero.
+	// Like the condition, engines may return other rows as well. Every row
+	// is read if nil.
+	Rows []int
+}
+
+// loadMetaFile reads the tables from the meta file within a database's root
+// directory. Returns an error if the file was written by a different backend
+// or in a different format version.
+func loadMetaFile(path, storage string) ([]*Table, error) {
+	f, err := os.Open(filepath.Join(path, "meta"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var dm databaseJSONMarshaler
+	if err := json.NewDecoder(f).Decode(&dm); err != nil {
+		return nil, err
+	}
+
+	// Verify the data was written by the same backend.
+	if dm.Storage == "" {
+		dm.Storage = "row"
+	}
+	if dm.Storage != storage {
+		return nil, fmt.Errorf("database uses %s storage", dm.Storage)
+	}
+
+	// Verify the files don't need to be migrated.
+	if dm.Format != FormatVersion {
+		return nil, fmt.Errorf("database format version %d requires migration to version %d", dm.Format, FormatVersion)
+	}
+
+	return dm.tables(), nil
+}
+
+// saveMetaFile writes the tables to the meta file within a database's root
+// directory. The file is replaced atomically.
+func saveMetaFile(path, storage string, tables []*Table) error {
+	dm := newDatabaseJSONMarshaler(storage, tables)
+	dm.Format = FormatVersion
+	return writeFileAtomic(filepath.Join(path, "meta"), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(dm)
+	})
+}
+
+// hasColumn returns true if the options require the column at index.
+func (opt *IteratorOptions) hasColumn(index int) bool {
+	if opt.Columns == nil {
+		return true
+	}
+	for _, i := range opt.Columns {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRowIn returns true if the options require any row from start up to
+// but not including end.
+func (opt *IteratorOptions) hasRowIn(start, end int) bool {
+	if opt.Rows == nil {
+		return true
+	}
+	i := sort.SearchInts(opt.Rows, start)
+	return i < len(opt.Rows) && opt.Rows[i] < end
+}
+
+// rowsDone returns true if the options don't require any row at or after pos.
+func (opt *IteratorOptions) rowsDone(pos int) bool {
+	return opt.Rows != nil && (len(opt.Rows) == 0 || pos > opt.Rows[len(opt.Rows)-1])
+}
+
+// filterRows returns the rows required by the options.
+func (opt *IteratorOptions) filterRows(rows [][]string) [][]string {
+	if opt.Rows == nil {
+		return rows
+	}
+
+	a := make([][]string, 0, len(opt.Rows))
+	for _, pos := range opt.Rows {
+		if pos < len(rows) {
+			a = append(a, rows[pos])
+		}
+	}
+	return a
+}
+
+// columnRange represents the minimum & maximum cell of a column within a set
+// of rows. Both are nil if the column has no values.
+type columnRange struct {
+	Min *string `json:"min,omitempty"`
+	Max *string `json:"max,omitempty"`
+}
+
+// add expands the range to include a cell.
+// Cells that don't match the column's type are ignored.
+func (r *columnRange) add(c *Column, cell string) {
+	value, err := c.ParseValue(cell)
+	if err != nil || value == nil {
+		return
+	}
+
+	if r.Min == nil {
+		r.Min, r.Max = &cell, &cell
+		return
+	}
+	if min, _ := c.ParseValue(*r.Min); compareValues(value, min) < 0 {
+		r.Min = &cell
+	}
+	if max, _ := c.ParseValue(*r.Max); compareValues(value, max) > 0 {
+		r.Max = &cell
+	}
+}
+
+// canSkipRange returns true if no row with the given column ranges can match
+// expr. Only comparisons between a column & a literal are considered. Any
+// other expression is assumed to match.
+func canSkipRange(t *Table, ranges []columnRange, expr pieql.Expr) bool {
+	switch expr := expr.(type) {
+	case *pieql.ParenExpr:
+		return canSkipRange(t, ranges, expr.Expr)
+	case *pieql.BinaryExpr:
+		switch expr.Op {
+		case pieql.AND:
+			return canSkipRange(t, ranges, expr.LHS) || canSkipRange(t, ranges, expr.RHS)
+		case pieql.OR:
+			return canSkipRange(t, ranges, expr.LHS) && canSkipRange(t, ranges, expr.RHS)
+		case pieql.EQ, pieql.NEQ, pieql.LT, pieql.LTE, pieql.GT, pieql.GTE:
+			// Normalize the comparison so the column is on the left.
+			op, ref, lit := expr.Op, expr.LHS, expr.RHS
+			if _, ok := ref.(*pieql.VarRef); !ok {
+				op, ref, lit = reverseComparison(op), expr.RHS, expr.LHS
+			}
+			if ref, ok := ref.(*pieql.VarRef); ok {
+				return canSkipComparison(t, ranges, ref, op, lit)
+			}
+		}
+	}
+	return false
+}
+
+// canSkipComparison returns true if no value in the column's range can match
+// the comparison against a literal.
+func canSkipComparison(t *Table, ranges []columnRange, ref *pieql.VarRef, op pieql.Token, lit pieql.Expr) bool {
+	index := t.ColumnIndex(ref.Val)
+	if index == -1 || index >= len(ranges) {
+		return false
+	}
+	c := t.Columns[index]
+
+	// Only use literals that compare in the same order as the column's values.
+	value, ok := literalValue(c, lit)
+	if !ok {
+		return false
+	}
+
+	// Comparisons never match missing values.
+	r := ranges[index]
+	if r.Min == nil {
+		return true
+	}
+
+	// Compare the literal to both ends of the range.
+	min, _ := c.ParseValue(*r.Min)
+	max, _ := c.ParseValue(*r.Max)
+	minCmp, ok := pieql.Compare(min, value)
+	if !ok {
+		return false
+	}
+	maxCmp, ok := pieql.Compare(max, value)
+	if !ok {
+		return false
+	}
+
+	switch op {
+	case pieql.EQ:
+		return minCmp > 0 || maxCmp < 0
+	case pieql.NEQ:
+		return minCmp == 0 && maxCmp == 0
+	case pieql.LT:
+		return minCmp >= 0
+	case pieql.LTE:
+		return minCmp > 0
+	case pieql.GT:
+		return maxCmp <= 0
+	case pieql.GTE:
+		return maxCmp < 0
+	}
+	return false
+}
+
+// reverseComparison returns the operator with its operands swapped.
+func reverseComparison(op pieql.Token) pieql.Token {
+	switch op {
+	case pieql.LT:
+		return pieql.GT
+	case pieql.LTE:
+		return pieql.GTE
+	case pieql.GT:
+		return pieql.LT
+	case pieql.GTE:
+		return pieql.LTE
+	}
+	return op
+}
@@ -0,0 +1,662 @@
+package pie
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrTxClosed is returned when using a transaction that has been
+	// committed or rolled back.
+	ErrTxClosed = errors.New("tx closed")
+
+	// ErrTxNotWritable is returned when changing the database from a
+	// read-only transaction.
+	ErrTxNotWritable = errors.New("tx not writable")
+)
+
+// Tx represents a transaction on the database.
+//
+// A transaction sees a snapshot of the tables & rows as they were when it
+// began. Changes made by a writable transaction are only visible to other
+// transactions once it commits. Only one writable transaction can be open at
+// a time. A transaction is not safe for concurrent use.
+type Tx struct {
+	db       *Database
+	ctx      context.Context
+	writable bool
+	closed   bool
+
+	tables map[string]*Table // tables visible to the transaction, by name
+	pinned []string          // data keys held by the transaction
+
+	// Tables whose rows were written by the transaction, by data key,
+	// and rows appended to committed tables, by table name.
+	staged  map[string]*Table
+	appends map[string][][]string
+
+	// Names of tables whose rows or indexes were changed.
+	changed map[string]bool
+}
+
+// Writable returns true if the transaction can change the database.
+func (tx *Tx) Writable() bool { return tx.writable }
+
+// Table returns a table by name.
+func (tx *Tx) Table(name string) *Table {
+	return tx.tables[name]
+}
+
+// Tables returns a list of all tables visible to the transaction, sorted by name.
+func (tx *Tx) Tables() []*Table {
+	var a []*Table
+	for _, t := range tx.tables {
+		a = append(a, t)
+	}
+	sort.Sort(tables(a))
+	return a
+}
+
+// CreateTable creates a new table with an optional primary key.
+// Returns an error if name is blank or invalid or if table already exists.
+// Returns a *SchemaError if a column's default or the primary key is invalid.
+func (tx *Tx) CreateTable(name string, columns []*Column, primaryKey ...string) error {
+	if err := tx.checkWritable(); err != nil {
+		return err
+	} else if err := validateTableName(name); err != nil {
+		return err
+	} else if tx.tables[name] != nil {
+		return ErrTableExists
+	} else if err := validateSchema(columns, primaryKey); err != nil {
+		return err
+	}
+
+	// Remove any rows left behind at the table's data key if the process
+	// stopped before a previous transaction finished. The table starts with
+	// no rows written so they can be moved to its name like any other rows.
+	t := &Table{Name: name, Columns: columns, PrimaryKey: primaryKey, key: tx.newKey(name)}
+	if err := tx.db.Storage.DeleteTable(t); err != nil {
+		return err
+	} else if err := tx.db.Storage.WriteRows(t, &rowSliceIterator{}); err != nil {
+		return err
+	}
+
+	tx.tables[name] = t
+	tx.staged[t.key] = t
+	tx.changed[name] = true
+	return nil
+}
+
+// DeleteTable removes an existing table by name.
+// Returns an error if name is blank or table is not found.
+func (tx *Tx) DeleteTable(name string) error {
+	if err := tx.checkWritable(); err != nil {
+		return err
+	} else if name == "" {
+		return ErrTableNameRequired
+	}
+
+	t := tx.tables[name]
+	if t == nil {
+		return ErrTableNotFound
+	}
+
+	// Rows written by this transaction can be removed immediately.
+	// Committed rows are removed once no transaction is using them.
+	if tx.staged[t.key] != nil {
+		if err := tx.db.Storage.DeleteTable(t); err != nil {
+			return err
+		}
+		delete(tx.staged, t.key)
+	}
+	delete(tx.appends, name)
+	delete(tx.tables, name)
+	delete(tx.changed, name)
+
+	return nil
+}
+
+// RenameTable changes the name of an existing table. Returns an error if
+// either name is blank, the new name is invalid, the table is not found or
+// the new name is taken.
+func (tx *Tx) RenameTable(name, newName string) error {
+	if err := tx.checkWritable(); err != nil {
+		return err
+	} else if name == "" {
+		return ErrTableNameRequired
+	} else if err := validateTableName(newName); err != nil {
+		return err
+	}
+
+	t := tx.tables[name]
+	if t == nil {
+		return ErrTableNotFound
+	} else if tx.tables[newName] != nil {
+		return ErrTableExists
+	}
+
+	// Rows stay under their current data key and are moved to the new name
+	// the next time they're written or the database is opened.
+	other := t.withKey(t.dataKey())
+	other.Name = newName
+	if tx.staged[other.key] != nil {
+		tx.staged[other.key] = other
+	}
+	if rows, ok := tx.appends[name]; ok {
+		tx.appends[newName] = rows
+		delete(tx.appends, name)
+	}
+	if tx.changed[name] {
+		tx.changed[newName] = true
+		delete(tx.changed, name)
+	}
+	delete(tx.tables, name)
+	tx.tables[newName] = other
+
+	return nil
+}
+
+// TableRows retrieves all rows for a table.
+// Returns no rows if the table's rows have never been set.
+func (tx *Tx) TableRows(name string) ([][]string, error) {
+	itr, err := tx.TableRowIterator(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = itr.Close() }()
+
+	return readRows(itr)
+}
+
+// TableRowIterator returns a cursor over the rows of a table.
+// The caller must close the iterator before the transaction is closed.
+func (tx *Tx) TableRowIterator(name string) (RowIterator, error) {
+	return tx.tableRowIterator(name, IteratorOptions{})
+}
+
+// tableRowIterator returns a cursor over the rows of a table using the
+// given options to limit the columns & rows read from storage.
+func (tx *Tx) tableRowIterator(name string, opt IteratorOptions) (RowIterator, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	}
+
+	t := tx.tables[name]
+	if t == nil {
+		return nil, ErrTableNotFound
+	}
+
+	itr, err := tx.db.Storage.RowIterator(t, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Include rows appended by the transaction.
+	if rows := tx.appends[name]; len(rows) > 0 {
+		itr = &multiRowIterator{itrs: []RowIterator{itr, &rowSliceIterator{rows: rows}}}
+	}
+
+	// Stop reading once the transaction's context is done.
+	if tx.ctx.Done() != nil {
+		itr = &contextRowIterator{itr: itr, ctx: tx.ctx}
+	}
+	return itr, nil
+}
+
+// SetTableRows replaces the rows of a table. Empty cells are replaced by
+// their column's default. Returns a *ConstraintError if any row violates the
+// table's constraints.
+func (tx *Tx) SetTableRows(name string, rows [][]string) error {
+	if err := tx.checkWritable(); err != nil {
+		return err
+	}
+
+	t := tx.tables[name]
+	if t == nil {
+		return ErrTableNotFound
+	}
+
+	rows, err := checkRows(t, rows)
+	if err != nil {
+		return err
+	}
+	return tx.writeRows(t, &rowSliceIterator{rows: rows})
+}
+
+// AppendTableRows adds rows to the end of a table without rewriting the
+// existing rows. Empty cells are replaced by their column's default. Returns
+// a *ConstraintError if any row violates the table's constraints, including
+// repeating a unique value or primary key of an existing row.
+func (tx *Tx) AppendTableRows(name string, rows [][]string) error {
+	if err := tx.checkWritable(); err != nil {
+		return err
+	}
+
+	t := tx.tables[name]
+	if t == nil {
+		return ErrTableNotFound
+	}
+
+	// Check the rows against each other & the existing rows.
+	if t.hasConstraints() {
+		chk := newConstraintChecker(t)
+		if chk.comparesRows() {
+			itr, err := tx.tableRowIterator(name, IteratorOptions{})
+			if err != nil {
+				return err
+			}
+			err = chk.seed(itr)
+			_ = itr.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if rows, err = chk.checkAll(rows); err != nil {
+			return err
+		}
+	}
+	return tx.appendTableRows(name, rows)
+}
+
+// appendTableRows adds rows that have already been checked against the
+// table's constraints.
+func (tx *Tx) appendTableRows(name string, rows [][]string) error {
+	t := tx.tables[name]
+
+	// Rows written by this transaction can be appended to directly.
+	// Otherwise the rows are held until commit.
+	tx.changed[name] = true
+	if tx.staged[t.key] != nil {
+		return tx.db.Storage.AppendRows(t, rows)
+	}
+	tx.appends[name] = append(tx.appends[name], rows...)
+	return nil
+}
+
+// rewriteTableRows passes each row of a table through fn and replaces the
+// table's rows with the returned rows. Rows are removed if fn returns a nil
+// row. The existing rows are left unchanged if fn returns an error.
+func (tx *Tx) rewriteTableRows(name string, fn func(row []string) ([]string, error)) error {
+	if err := tx.checkWritable(); err != nil {
+		return err
+	}
+
+	t := tx.tables[name]
+	if t == nil {
+		return ErrTableNotFound
+	}
+
+	itr, err := tx.tableRowIterator(name, IteratorOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = itr.Close() }()
+
+	return tx.writeRows(t, &rowMapIterator{itr: itr, fn: fn})
+}
+
+// writeRows replaces the rows of a table with the rows from itr. Committed
+// rows are left in place for other transactions and the new rows are
+// written under a new data key.
+func (tx *Tx) writeRows(t *Table, itr RowIterator) error {
+	other := t
+	if tx.staged[t.key] == nil {
+		// Clear anything left behind at the new key.
+		other = t.withKey(tx.newKey(t.Name))
+		if err := tx.db.Storage.DeleteTable(other); err != nil {
+			return err
+		}
+		tx.staged[other.key] = other
+	}
+
+	if err := tx.db.Storage.WriteRows(other, itr); err != nil {
+		return err
+	}
+
+	tx.tables[t.Name] = other
+	tx.changed[t.Name] = true
+	delete(tx.appends, t.Name)
+	return nil
+}
+
+// Commit writes the transaction's changes to storage and makes them visible
+// to new transactions. The transaction is rolled back if an error occurs or
+// if its context is done.
+//
+// Written rows are stored at a new data key and take effect when the
+// metadata is atomically replaced. They're then moved to their table's name
+// and any move that doesn't finish is done again when the database is
+// opened. Only rows appended in place are written to the committed rows
+// directly. These appends are logged by the storage before being applied.
+func (tx *Tx) Commit() (err error) {
+	if tx.closed {
+		return ErrTxClosed
+	} else if !tx.writable {
+		return ErrTxNotWritable
+	} else if err := tx.ctx.Err(); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			return
+		}
+		tx.close()
+	}()
+
+	// Write rows & indexes before taking the database lock so that other
+	// transactions can begin while they're written. A lone append to a
+	// table that no other transaction is reading is applied in place once
+	// the metadata is saved. Otherwise appended rows are copied with the
+	// existing rows to a new data key so that every change becomes visible
+	// at once.
+	inPlace := tx.appendInPlace()
+	base := tx.tables[inPlace]
+	for _, name := range sortedKeys(tx.appends) {
+		if name != inPlace {
+			if err := tx.stageAppend(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Rebuild the indexes of changed tables for the new version of their rows.
+	// Versions are only tracked for tables with indexes. Indexes of a table
+	// appended in place are updated after the append.
+	for _, name := range sortedKeys(tx.changed) {
+		t := tx.tables[name]
+		if t == nil || len(t.Indexes) == 0 {
+			continue
+		}
+		other := *t
+		other.version++
+		tx.tables[name] = &other
+
+		if name != inPlace {
+			if err := writeIndexes(tx.db.Storage, &other); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Replace the committed tables. If another transaction began reading
+	// the table appended in place then its rows are copied instead.
+	if ok, err := tx.swap(inPlace); err != nil {
+		return err
+	} else if !ok {
+		if err := tx.stageAppend(inPlace); err != nil {
+			return err
+		} else if t := tx.tables[inPlace]; len(t.Indexes) > 0 {
+			if err := writeIndexes(tx.db.Storage, t); err != nil {
+				return err
+			}
+		}
+		_, err := tx.swap("")
+		return err
+	}
+
+	// Update the indexes of a table appended in place. An index that fails
+	// to be updated is stale & is rebuilt instead.
+	if inPlace != "" {
+		if ok, err := tx.appendIndexes(base, tx.appends[inPlace]); err != nil || !ok {
+			_ = writeIndexes(tx.db.Storage, tx.tables[inPlace])
+		}
+	}
+	return nil
+}
+
+// stageAppend copies the committed rows of a table along with the rows
+// appended by the transaction to a new data key.
+func (tx *Tx) stageAppend(name string) error {
+	s := tx.db.Storage
+	t, rows := tx.tables[name], tx.appends[name]
+
+	other := t.withKey(tx.newKey(name))
+	tx.staged[other.key] = other
+	if err := s.DeleteTable(other); err != nil {
+		return err
+	}
+	itr, err := s.RowIterator(t, IteratorOptions{})
+	if err != nil {
+		return err
+	}
+	err = s.WriteRows(other, &multiRowIterator{itrs: []RowIterator{itr, &rowSliceIterator{rows: rows}}})
+	_ = itr.Close()
+	if err != nil {
+		return err
+	}
+	tx.tables[name] = other
+	delete(tx.appends, name)
+	return nil
+}
+
+// swap saves the transaction's tables as the committed tables & appends
+// rows to the inPlace table, if any. The database lock is only held while
+// the metadata is saved and rows are appended or moved. Returns false
+// without changing anything if the inPlace table is now being read by
+// another transaction.
+func (tx *Tx) swap(inPlace string) (bool, error) {
+	db := tx.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if inPlace != "" && !tx.unpinned(db.tables[inPlace].dataKey()) {
+		return false, nil
+	}
+
+	// Save the new metadata. The commit takes effect once the metadata is
+	// replaced so a failed save leaves the committed tables unchanged.
+	prev := db.tables
+	db.tables = tx.tables
+	if err := db.save(); err != nil {
+		db.tables = prev
+		return false, err
+	}
+	staged := tx.staged
+	tx.staged = nil
+
+	// Append rows in place. The append is written ahead by the storage so
+	// an interrupted append is finished when the database is reopened.
+	if inPlace != "" {
+		if err := db.Storage.AppendRows(prev[inPlace], tx.appends[inPlace]); err != nil {
+			db.tables = prev
+			_ = db.save()
+			return false, err
+		}
+	}
+
+	// Move written rows to the table's name if no other transaction is
+	// using the rows stored there. The metadata already refers to the new
+	// data key so a failed move leaves the rows where they are.
+	var moved bool
+	for _, key := range sortedKeys(staged) {
+		t := db.tables[staged[key].Name]
+		if t == nil || t.dataKey() != key {
+			continue
+		} else if !tx.unpinned(t.Name) || db.keyInUse(t.Name, db.tables) {
+			continue
+		} else if err := db.Storage.MoveRows(t, t.Name); err != nil {
+			continue
+		}
+		db.tables[t.Name] = t.withKey("")
+		moved = true
+	}
+	if moved {
+		_ = db.save()
+	}
+
+	// Remove rows that are no longer used by any table once other
+	// transactions are finished with them.
+	for _, t := range prev {
+		if !db.keyInUse(t.dataKey(), db.tables) {
+			db.garbage[t.dataKey()] = t
+		}
+	}
+
+	return true, nil
+}
+
+// appendInPlace returns the name of a table whose appended rows can be
+// written to its committed rows. Rows are only appended in place if the
+// append is the transaction's only change and no other transaction is
+// using the table's rows.
+func (tx *Tx) appendInPlace() string {
+	db := tx.db
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if len(tx.appends) != 1 || len(tx.staged) != 0 || len(tx.tables) != len(db.tables) {
+		return ""
+	}
+	for name, t := range tx.tables {
+		if db.tables[name] != t {
+			return ""
+		}
+	}
+	for name := range tx.appends {
+		if tx.unpinned(tx.tables[name].dataKey()) {
+			return name
+		}
+	}
+	return ""
+}
+
+// unpinned returns true if no other transaction holds the data key.
+// Must be called with the database lock held.
+func (tx *Tx) unpinned(key string) bool {
+	return tx.db.pins[key] <= tx.pins(key)
+}
+
+// appendIndexes adds rows being appended to a committed table to each of its
+// indexes. The indexes are written for the next version of the table after
+// the rows are appended so an interrupted commit leaves them stale rather
+// than missing rows. Returns false if any index must be rebuilt instead.
+func (tx *Tx) appendIndexes(t *Table, rows [][]string) (bool, error) {
+	s := tx.db.Storage
+
+	// Read every index first so nothing is written if any is stale.
+	var a []*IndexData
+	for _, idx := range t.Indexes {
+		data, err := s.ReadIndex(t, idx.Name)
+		if err != nil {
+			return false, err
+		} else if data == nil || data.Version != t.version {
+			return false, nil
+		}
+		a = append(a, data)
+	}
+
+	for i, idx := range t.Indexes {
+		index := t.ColumnIndex(idx.Column)
+		data := a[i].clone()
+		data.Version = t.version + 1
+		data.append(t.Columns[index], index, rows)
+		if err := s.WriteIndex(t, idx.Name, data); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Rollback discards the transaction's changes and closes the transaction.
+func (tx *Tx) Rollback() error {
+	if tx.closed {
+		return ErrTxClosed
+	}
+	defer tx.close()
+
+	// Remove rows written by the transaction.
+	for _, t := range tx.staged {
+		if err := tx.db.Storage.DeleteTable(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close releases the transaction's data keys and the writer lock.
+func (tx *Tx) close() {
+	tx.closed = true
+	tx.db.release(tx.pinned)
+	tx.pinned, tx.staged, tx.appends, tx.changed = nil, nil, nil, nil
+	if tx.writable {
+		tx.db.writeMu.Unlock()
+	}
+}
+
+// newKey returns an unused data key for new rows of a table.
+func (tx *Tx) newKey(name string) string {
+	tx.db.mu.Lock()
+	defer tx.db.mu.Unlock()
+	return tx.db.nextKey(name, tx.tables)
+}
+
+// pins returns the number of times the transaction holds a data key.
+func (tx *Tx) pins(key string) int {
+	var n int
+	for _, k := range tx.pinned {
+		if k == key {
+			n++
+		}
+	}
+	return n
+}
+
+// validateTableName returns an error if name is blank or can't be used as
+// the name of a table's files.
+func validateTableName(name string) error {
+	if name == "" {
+		return ErrTableNameRequired
+	} else if !isFileName(name) {
+		return ErrInvalidTableName
+	}
+	return nil
+}
+
+// isFileName returns true if name can be used as the name of a file within
+// one of the database's directories. Names can't contain path separators or
+// be a relative directory name. Suffixes used by temporary & replaced files
+// are also reserved.
+func isFileName(name string) bool {
+	if name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return false
+	}
+	return !strings.HasSuffix(name, ".tmp") && !strings.HasSuffix(name, ".old")
+}
+
+// checkWritable returns an error if the transaction can't change the database.
+func (tx *Tx) checkWritable() error {
+	if tx.closed {
+		return ErrTxClosed
+	} else if !tx.writable {
+		return ErrTxNotWritable
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	a := make([]string, 0, len(m))
+	for k := range m {
+		a = append(a, k)
+	}
+	sort.Strings(a)
+	return a
+}
+
+// txIterator closes a transaction when the underlying iterator is closed.
+type txIterator struct {
+	RowIterator
+	tx *Tx
+}
+
+// Close closes the underlying iterator and rolls back the transaction.
+func (itr *txIterator) Close() error {
+	defer func() { _ = itr.tx.Rollback() }()
+	return itr.RowIterator.Close()
+}
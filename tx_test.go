@@ -0,0 +1,313 @@
+package pie_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure a transaction's changes are only visible to others once committed.
+func TestTx_Commit(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := tx.CreateTable("foo", []*pie.Column{{Name: "n"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.SetTableRows("foo", [][]string{{"1"}, {"2"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.AppendTableRows("foo", [][]string{{"3"}}); err != nil {
+		t.Fatal(err)
+	} else if rows, err := tx.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}, {"3"}}) {
+		t.Fatalf("unexpected rows in tx: %#v", rows)
+	}
+
+	// Verify the table isn't visible outside the transaction.
+	if db.Table("foo") != nil {
+		t.Fatal("unexpected table before commit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	} else if err := tx.Commit(); err != pie.ErrTxClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Verify the rows are stored under the table's name after reopening.
+	path := db.Path()
+	db.Database.Close()
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	} else if rows, err := db.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}, {"3"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	} else if names := dataFiles(t, db); !reflect.DeepEqual(names, []string{"foo"}) {
+		t.Fatalf("unexpected data files: %v", names)
+	}
+}
+
+// Ensure a rolled back transaction leaves nothing behind.
+func TestTx_Rollback(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n"}})
+	db.SetTableRows("foo", [][]string{{"1"}})
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := tx.CreateTable("bar", []*pie.Column{{Name: "n"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.SetTableRows("bar", [][]string{{"1"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.SetTableRows("foo", [][]string{{"2"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.AppendTableRows("foo", [][]string{{"3"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Table("bar") != nil {
+		t.Fatal("unexpected table")
+	} else if rows, err := db.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	} else if names := dataFiles(t, db); !reflect.DeepEqual(names, []string{"foo"}) {
+		t.Fatalf("unexpected data files: %v", names)
+	}
+}
+
+// Ensure a commit that fails to save the metadata leaves the committed
+// tables unchanged, in memory & on disk.
+func TestTx_Commit_ErrSave(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n"}})
+	db.SetTableRows("foo", [][]string{{"1"}})
+	db.CreateTable("bar", []*pie.Column{{Name: "n"}})
+	db.SetTableRows("bar", [][]string{{"2"}})
+
+	// Block the metadata from being replaced.
+	tmp := filepath.Join(db.Path(), "meta.tmp")
+	if err := os.Mkdir(tmp, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin(true)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := tx.SetTableRows("foo", [][]string{{"3"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.AppendTableRows("bar", [][]string{{"4"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.CreateTable("baz", []*pie.Column{{Name: "n"}}); err != nil {
+		t.Fatal(err)
+	} else if err := tx.Commit(); err == nil {
+		t.Fatal("expected error")
+	} else if err := os.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(desc string) {
+		if rows, err := db.TableRows("foo"); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(rows, [][]string{{"1"}}) {
+			t.Fatalf("%s: unexpected foo rows: %#v", desc, rows)
+		} else if rows, err := db.TableRows("bar"); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(rows, [][]string{{"2"}}) {
+			t.Fatalf("%s: unexpected bar rows: %#v", desc, rows)
+		} else if db.Table("baz") != nil {
+			t.Fatalf("%s: unexpected table", desc)
+		} else if names := dataFiles(t, db); !reflect.DeepEqual(names, []string{"bar", "foo"}) {
+			t.Fatalf("%s: unexpected data files: %v", desc, names)
+		}
+	}
+	verify("before reopen")
+
+	path := db.Path()
+	db.Database.Close()
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	verify("after reopen")
+}
+
+// Ensure rows left at a data key by a commit are moved to the table's name
+// when the database is opened, including after the move itself was done.
+func TestDatabase_Open_MoveRows(t *testing.T) {
+	for _, moved := range []bool{false, true} {
+		db := OpenDatabase()
+		db.CreateTable("foo", []*pie.Column{{Name: "n"}})
+		db.SetTableRows("foo", [][]string{{"1"}})
+
+		// Hold the committed rows so the new rows are left at their key.
+		tx, err := db.Begin(false)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := db.SetTableRows("foo", [][]string{{"2"}}); err != nil {
+			t.Fatal(err)
+		} else if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		names := dataFiles(t, db)
+		if len(names) != 1 || names[0] == "foo" {
+			t.Fatalf("unexpected data files: %v", names)
+		}
+
+		// Simulate a move that finished before its metadata was saved.
+		if moved {
+			dir := filepath.Join(db.Path(), "data")
+			if err := os.Rename(filepath.Join(dir, names[0]), filepath.Join(dir, "foo")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		path := db.Path()
+		db.Database.Close()
+		if err := db.Open(path); err != nil {
+			t.Fatal(err)
+		} else if rows, err := db.TableRows("foo"); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(rows, [][]string{{"2"}}) {
+			t.Fatalf("moved=%v: unexpected rows: %#v", moved, rows)
+		} else if names := dataFiles(t, db); !reflect.DeepEqual(names, []string{"foo"}) {
+			t.Fatalf("moved=%v: unexpected data files: %v", moved, names)
+		}
+		db.Close()
+	}
+}
+
+// Ensure readers see a consistent snapshot while rows are written to the
+// same table by another transaction.
+func TestTx_Snapshot(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		fn   func(tx *pie.Tx) error
+		exp  [][]string
+	}{
+		{name: "append", fn: func(tx *pie.Tx) error {
+			for _, row := range [][]string{{"3"}, {"4"}} {
+				if err := tx.AppendTableRows("foo", [][]string{row}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, exp: [][]string{{"1"}, {"2"}, {"3"}, {"4"}}},
+		{name: "set", fn: func(tx *pie.Tx) error {
+			return tx.SetTableRows("foo", [][]string{{"3"}, {"4"}})
+		}, exp: [][]string{{"3"}, {"4"}}},
+		{name: "recreate", fn: func(tx *pie.Tx) error {
+			if err := tx.DeleteTable("foo"); err != nil {
+				return err
+			} else if err := tx.CreateTable("foo", []*pie.Column{{Name: "n"}}); err != nil {
+				return err
+			}
+			return tx.SetTableRows("foo", [][]string{{"3"}, {"4"}})
+		}, exp: [][]string{{"3"}, {"4"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := OpenDatabase()
+			defer db.Close()
+			db.CreateTable("foo", []*pie.Column{{Name: "n"}})
+			db.SetTableRows("foo", [][]string{{"1"}, {"2"}})
+
+			// Start reading before the write begins.
+			itr, err := db.TableRowIterator("foo")
+			if err != nil {
+				t.Fatal(err)
+			} else if row, err := itr.Next(); err != nil || !reflect.DeepEqual(row, []string{"1"}) {
+				t.Fatalf("unexpected row: %#v (%v)", row, err)
+			}
+
+			// Write rows and begin another read before committing.
+			tx, err := db.Begin(true)
+			if err != nil {
+				t.Fatal(err)
+			} else if err := tt.fn(tx); err != nil {
+				t.Fatal(err)
+			}
+			rtx, err := db.Begin(false)
+			if err != nil {
+				t.Fatal(err)
+			} else if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Verify both readers only see the original rows.
+			if rows, err := rtx.TableRows("foo"); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}}) {
+				t.Fatalf("unexpected rows in read tx: %#v", rows)
+			} else if row, err := itr.Next(); err != nil || !reflect.DeepEqual(row, []string{"2"}) {
+				t.Fatalf("unexpected row: %#v (%v)", row, err)
+			} else if row, err := itr.Next(); err != nil || row != nil {
+				t.Fatalf("unexpected row: %#v (%v)", row, err)
+			}
+
+			// Verify new readers see the committed rows.
+			if rows, err := db.TableRows("foo"); err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(rows, tt.exp) {
+				t.Fatalf("unexpected rows: %#v", rows)
+			}
+
+			// Verify the original rows are removed once the readers close.
+			itr.Close()
+			rtx.Rollback()
+			if names := dataFiles(t, db); len(names) != 1 {
+				t.Fatalf("unexpected data files: %v", names)
+			}
+		})
+	}
+}
+
+// Ensure a read-only transaction can't change the database.
+func TestTx_ErrTxNotWritable(t *testing.T) {
+	db := OpenMemDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "n"}})
+
+	tx, err := db.Begin(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.CreateTable("bar", nil); err != pie.ErrTxNotWritable {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := tx.AppendTableRows("foo", [][]string{{"1"}}); err != pie.ErrTxNotWritable {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := tx.Execute(MustParseStatement(`INSERT INTO foo VALUES (1)`)); err != pie.ErrTxNotWritable {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := tx.Execute(MustParseStatement(`SELECT * FROM foo`)); err != nil {
+		t.Fatal(err)
+	} else if err := tx.Commit(); err != pie.ErrTxNotWritable {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// dataFiles returns the names of the files in the database's data directory.
+func dataFiles(t *testing.T, db *Database) []string {
+	fis, err := ioutil.ReadDir(filepath.Join(db.Path(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return names
+}
@@ -0,0 +1,174 @@
+package pie
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walEntry represents an append to a table's files. The size of each file
+// before the append is recorded so that a partial append can be undone and
+// then applied again.
+//
+// Only appends are logged. Other writes are stored at a new data key and
+// are committed by replacing the metadata so they're never partly visible.
+type walEntry struct {
+	Table   string           `json:"table"`
+	Key     string           `json:"key,omitempty"`
+	Columns []*Column        `json:"columns,omitempty"`
+	Files   map[string]int64 `json:"files"`
+	Rows    [][]string       `json:"rows"`
+}
+
+// table returns the table the entry was written for.
+func (e *walEntry) table() *Table {
+	return &Table{Name: e.Table, Columns: e.Columns, key: e.Key}
+}
+
+// newWALEntry returns an entry for appending rows to the given files.
+// Paths are relative to dir. Missing files are recorded with a size of zero.
+func newWALEntry(t *Table, dir string, paths []string, rows [][]string) (*walEntry, error) {
+	e := &walEntry{Table: t.Name, Key: t.key, Columns: t.Columns, Files: make(map[string]int64), Rows: rows}
+	for _, path := range paths {
+		fi, err := os.Stat(filepath.Join(dir, path))
+		if os.IsNotExist(err) {
+			e.Files[path] = 0
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		e.Files[path] = fi.Size()
+	}
+	return e, nil
+}
+
+// undo truncates each file to its size before the append. Files are
+// relative to dir.
+func (e *walEntry) undo(dir string) error {
+	for name, size := range e.Files {
+		if err := os.Truncate(filepath.Join(dir, name), size); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAhead writes an entry to the log at path before calling apply. The
+// log is removed once apply succeeds or its changes are undone. If the
+// process stops before then, the entry is applied again by replayWAL when
+// the database is reopened. Files in the entry are relative to dir.
+func writeAhead(path, dir string, e *walEntry, apply func() error) error {
+	if err := writeFileAtomic(path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(e)
+	}); err != nil {
+		return err
+	}
+
+	// Remove any partial append if it fails. The log is kept if the
+	// files can't be restored so they are fixed on the next open.
+	if err := apply(); err != nil {
+		if e.undo(dir) == nil {
+			_ = os.Remove(path)
+		}
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// replayWAL applies the entry in each log within walDir. Each file is first
+// truncated to its size before the append. Files are relative to dir.
+func replayWAL(walDir, dir string, apply func(t *Table, rows [][]string) error) error {
+	if err := os.MkdirAll(walDir, 0700); err != nil {
+		return err
+	}
+
+	fis, err := ioutil.ReadDir(walDir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		// Skip logs that were never completely written.
+		if strings.HasSuffix(fi.Name(), ".tmp") {
+			continue
+		} else if err := replayWALEntry(filepath.Join(walDir, fi.Name()), dir, apply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayWALEntry applies the entry in the log at path.
+func replayWALEntry(path, dir string, apply func(t *Table, rows [][]string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	var e walEntry
+	if err := json.NewDecoder(bufio.NewReader(f)).Decode(&e); err != nil {
+		return err
+	}
+
+	// Undo any part of the append that was written.
+	if err := e.undo(dir); err != nil {
+		return err
+	}
+
+	if err := apply(e.table(), e.Rows); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	} else if err := os.Remove(path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// writeFileAtomic calls fn to write a temporary file alongside path. The
+// temporary file is synced to disk and then renamed over path so a crash
+// never leaves a partially written file.
+func writeFileAtomic(path string, fn func(w io.Writer) error) error {
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close(); _ = os.Remove(f.Name()) }()
+
+	w := bufio.NewWriter(f)
+	if err := fn(w); err != nil {
+		return err
+	} else if err := w.Flush(); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	} else if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes a directory's entries to disk so that renamed & removed
+// files are durable.
+func syncDir(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,130 @@
+package pie_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/turingschool-examples/pie"
+)
+
+// Ensure an interrupted append is completed when the database is reopened.
+func TestDatabase_Open_ReplayWAL(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}})
+	db.SetTableRows("foo", [][]string{{"1"}, {"2"}})
+	path := db.Path()
+	db.Database.Close()
+
+	// Simulate a crash after part of an append was written.
+	fi, err := os.Stat(filepath.Join(path, "data", "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.OpenFile(filepath.Join(path, "data", "foo"), os.O_WRONLY|os.O_APPEND, 0666)
+	f.Write([]byte(`["3"]` + "\n" + `["4`))
+	f.Close()
+	wal := fmt.Sprintf(`{"table":"foo","columns":[{"name":"a"}],"files":{"foo":%d},"rows":[["3"],["4"]]}`, fi.Size())
+	if err := os.MkdirAll(filepath.Join(path, "wal"), 0700); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(path, "wal", "foo"), []byte(wal), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the database and verify the append was completed once.
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	} else if rows, err := db.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}, {"3"}, {"4"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	} else if _, err := os.Stat(filepath.Join(path, "wal", "foo")); !os.IsNotExist(err) {
+		t.Fatalf("expected log to be removed: %v", err)
+	}
+}
+
+// Ensure an interrupted columnar append is completed when the database is reopened.
+func TestColumnarStorage_Open_ReplayWAL(t *testing.T) {
+	db := OpenColumnarDatabase(0)
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a", Type: pie.IntegerType}})
+	db.SetTableRows("foo", [][]string{{"1"}, {"2"}})
+	path := db.Path()
+	db.Database.Close()
+
+	// Simulate a crash after the stats of the new block were written.
+	dir := filepath.Join(path, "data", "foo")
+	stats, _ := os.Stat(filepath.Join(dir, "stats"))
+	column, _ := os.Stat(filepath.Join(dir, "0"))
+	f, _ := os.OpenFile(filepath.Join(dir, "stats"), os.O_WRONLY|os.O_APPEND, 0666)
+	f.Write([]byte(`{"n":1,"ranges":[{"min":"3","max":"3"}]}` + "\n"))
+	f.Close()
+	wal := fmt.Sprintf(`{"table":"foo","columns":[{"name":"a","type":"integer"}],"files":{"foo/stats":%d,"foo/0":%d},"rows":[["3"]]}`, stats.Size(), column.Size())
+	if err := os.MkdirAll(filepath.Join(path, "wal"), 0700); err != nil {
+		t.Fatal(err)
+	} else if err := ioutil.WriteFile(filepath.Join(path, "wal", "foo"), []byte(wal), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	} else if rows, err := db.TableRows("foo"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rows, [][]string{{"1"}, {"2"}, {"3"}}) {
+		t.Fatalf("unexpected rows: %#v", rows)
+	}
+}
+
+// Ensure a columnar table is restored if its directory was being replaced
+// when the process stopped.
+func TestColumnarStorage_Open_Recover(t *testing.T) {
+	db := OpenColumnarDatabase(0)
+	defer db.Close()
+	db.CreateTable("foo", []*pie.Column{{Name: "a"}})
+	db.CreateTable("bar", []*pie.Column{{Name: "a"}})
+	db.SetTableRows("foo", [][]string{{"1"}})
+	db.SetTableRows("bar", [][]string{{"2"}})
+	path := db.Path()
+	db.Database.Close()
+
+	// Simulate crashes before & after the new directory was complete.
+	data := filepath.Join(path, "data")
+	if err := os.Rename(filepath.Join(data, "foo"), filepath.Join(data, "foo.old")); err != nil {
+		t.Fatal(err)
+	} else if err := os.Rename(filepath.Join(data, "bar"), filepath.Join(data, "bar.tmp")); err != nil {
+		t.Fatal(err)
+	} else if err := os.Mkdir(filepath.Join(data, "bar.old"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	} else if rows, err := db.TableRows("foo"); err != nil || !reflect.DeepEqual(rows, [][]string{{"1"}}) {
+		t.Fatalf("unexpected rows: %#v (%v)", rows, err)
+	} else if rows, err := db.TableRows("bar"); err != nil || !reflect.DeepEqual(rows, [][]string{{"2"}}) {
+		t.Fatalf("unexpected rows: %#v (%v)", rows, err)
+	} else if _, err := os.Stat(filepath.Join(data, "foo.old")); !os.IsNotExist(err) {
+		t.Fatalf("expected old directory to be removed: %v", err)
+	}
+}
+
+// Ensure the metadata is not affected by a partially written temporary file.
+func TestDatabase_Open_PartialMeta(t *testing.T) {
+	db := OpenDatabase()
+	defer db.Close()
+	db.CreateTable("foo", nil)
+	path := db.Path()
+	db.Database.Close()
+
+	if err := ioutil.WriteFile(filepath.Join(path, "meta.tmp"), []byte(`{"tab`), 0666); err != nil {
+		t.Fatal(err)
+	} else if err := db.Open(path); err != nil {
+		t.Fatal(err)
+	} else if db.Table("foo") == nil {
+		t.Fatal("expected table")
+	}
+}
@@ -0,0 +1,148 @@
+package pie
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// xlsxResultWriter writes results as an Office Open XML workbook with a
+// worksheet per result. Rows are streamed into each worksheet as they're
+// written. The workbook parts that list the worksheets are written on close.
+type xlsxResultWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer // current worksheet, if any
+	n     int       // number of worksheets
+	row   int       // number of rows in the current worksheet
+}
+
+// newXLSXResultWriter returns a writer of a workbook to w.
+func newXLSXResultWriter(w io.Writer) *xlsxResultWriter {
+	return &xlsxResultWriter{zw: zip.NewWriter(w)}
+}
+
+// WriteHeader finishes the previous worksheet and starts a new one with the
+// columns as its first row.
+func (rw *xlsxResultWriter) WriteHeader(columns []string) error {
+	if err := rw.end(); err != nil {
+		return err
+	}
+
+	rw.n++
+	f, err := rw.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", rw.n))
+	if err != nil {
+		return err
+	}
+	rw.sheet, rw.row = f, 0
+
+	if _, err := io.WriteString(f, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return err
+	}
+	return rw.WriteRow(columns)
+}
+
+// WriteRow writes a row to the current worksheet.
+func (rw *xlsxResultWriter) WriteRow(row []string) error {
+	rw.row++
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, `<row r="%d">`, rw.row)
+	for i, cell := range row {
+		ref := xlsxColumnName(i) + strconv.Itoa(rw.row)
+		if isXLSXNumber(cell) {
+			fmt.Fprintf(&buf, `<c r="%s"><v>%s</v></c>`, ref, cell)
+			continue
+		}
+		fmt.Fprintf(&buf, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		_ = xml.EscapeText(&buf, []byte(cell))
+		buf.WriteString(`</t></is></c>`)
+	}
+	buf.WriteString(`</row>`)
+
+	_, err := io.WriteString(rw.sheet, buf.String())
+	return err
+}
+
+// Flush writes data buffered by the archive to the underlying writer. Data
+// held by the compressor is written as the worksheet grows.
+func (rw *xlsxResultWriter) Flush() error { return rw.zw.Flush() }
+
+// Close finishes the last worksheet and writes the workbook parts. A
+// workbook must have a worksheet so an empty one is added if there were no
+// results.
+func (rw *xlsxResultWriter) Close() error {
+	if rw.n == 0 {
+		if err := rw.WriteHeader(nil); err != nil {
+			return err
+		}
+	}
+	if err := rw.end(); err != nil {
+		return err
+	}
+
+	var contentTypes, workbook, rels strings.Builder
+	for i := 1; i <= rw.n; i++ {
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+		fmt.Fprintf(&workbook, `<sheet name="Result %d" sheetId="%d" r:id="rId%d"/>`, i, i, i)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+
+	for _, part := range []struct {
+		name, data string
+	}{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			contentTypes.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbook.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+	} {
+		f, err := rw.zw.Create(part.name)
+		if err != nil {
+			return err
+		} else if _, err := io.WriteString(f, xml.Header+part.data); err != nil {
+			return err
+		}
+	}
+
+	return rw.zw.Close()
+}
+
+// end finishes the current worksheet, if any.
+func (rw *xlsxResultWriter) end() error {
+	if rw.sheet == nil {
+		return nil
+	}
+	_, err := io.WriteString(rw.sheet, `</sheetData></worksheet>`)
+	rw.sheet = nil
+	return err
+}
+
+// xlsxColumnName returns the letters used to reference the column at index.
+func xlsxColumnName(index int) string {
+	var name []byte
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = append([]byte{byte('A' + (index-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+// isXLSXNumber returns true if the cell can be stored as a number without
+// changing how it's displayed. Values such as "007" are kept as text.
+func isXLSXNumber(s string) bool {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return false
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64) == s
+}